@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/virakt/imgshrink/internal/api"
 	"github.com/virakt/imgshrink/internal/compressor"
@@ -23,6 +24,12 @@ func main() {
 		}
 	}()
 
-	batchResult, _ := imageAPI.BatchCompress(files, options, progressChan)
+	// Nothing is compressed when the batch cannot start, for example when
+	// two inputs would write the same output
+	batchResult, err := imageAPI.BatchCompress(files, options, progressChan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 	fmt.Printf("Total reduction: %.1f%%\n", batchResult.TotalReduction)
 }
@@ -3,7 +3,6 @@ package api
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"sync"
 
 	"github.com/virakt/imgshrink/internal/compressor"
@@ -13,6 +12,10 @@ import (
 type ImageAPI struct {
 	jpegCompressor *compressor.JPEGCompressor
 	pngCompressor  *compressor.PNGCompressor
+	tiffCompressor *compressor.TIFFCompressor
+	bmpCompressor  *compressor.BMPCompressor
+	qoiCompressor  *compressor.QOICompressor
+	svgCompressor  *compressor.SVGCompressor
 }
 
 // NewImageAPI creates a new ImageAPI instance
@@ -20,11 +23,67 @@ func NewImageAPI() *ImageAPI {
 	return &ImageAPI{
 		jpegCompressor: compressor.NewJPEGCompressor(),
 		pngCompressor:  compressor.NewPNGCompressor(),
+		tiffCompressor: compressor.NewTIFFCompressor(),
+		bmpCompressor:  compressor.NewBMPCompressor(),
+		qoiCompressor:  compressor.NewQOICompressor(),
+		svgCompressor:  compressor.NewSVGCompressor(),
 	}
 }
 
-// CompressImage compresses a single image with the given options
+// CompressImage compresses a single image with the given options. Unless
+// options.Force is set, files tagged by options.TagOutputs runs with the same
+// version and options are skipped, as are inputs a manifest lists as
+// unchanged; new outputs are recorded in it.
 func (api *ImageAPI) CompressImage(inputPath string, options compressor.CompressionOptions) (*compressor.CompressionResult, error) {
+	if !options.Force {
+		if result := api.skipProcessed(inputPath, options); result != nil {
+			return result, nil
+		}
+	}
+
+	result, err := api.compress(inputPath, options)
+	if err == nil && result.Success && !result.Skipped && options.Manifest != nil && !options.InPlace {
+		if err := options.Manifest.Record(inputPath, result, options); err != nil {
+			result.Success = false
+			result.Error = fmt.Errorf("failed to update manifest: %w", err)
+			return result, result.Error
+		}
+	}
+	return result, err
+}
+
+// skipProcessed returns a skipped result for an input that imgshrink already
+// produced, or that the manifest lists as unchanged, and nil otherwise
+func (api *ImageAPI) skipProcessed(inputPath string, options compressor.CompressionOptions) *compressor.CompressionResult {
+	result := &compressor.CompressionResult{InputPath: inputPath, Skipped: true}
+
+	if options.TagOutputs {
+		if tag, err := options.Tags.ReadTag(inputPath); err == nil && tag == compressor.ProcessedTag(options) {
+			if stat, err := os.Stat(inputPath); err == nil {
+				result.InputSize = stat.Size()
+				result.OutputSize = stat.Size()
+			}
+			result.SkipReason = "already processed by " + tag
+			return result
+		}
+	}
+
+	if options.Manifest != nil && !options.InPlace {
+		if entry, ok := options.Manifest.Unchanged(inputPath, options); ok {
+			result.OutputPath = entry.Outputs[0].Path
+			result.Placeholder = entry.Placeholder
+			result.InputSize = entry.Size
+			result.OutputSize = entry.Size
+			result.SkipReason = "unchanged since the last run"
+			return result
+		}
+	}
+
+	return nil
+}
+
+// compress dispatches an image to the compressor for its format
+func (api *ImageAPI) compress(inputPath string, options compressor.CompressionOptions) (*compressor.CompressionResult, error) {
 	format, err := compressor.GetImageFormat(inputPath)
 	if err != nil {
 		return nil, err
@@ -35,16 +94,43 @@ func (api *ImageAPI) CompressImage(inputPath string, options compressor.Compress
 		return api.jpegCompressor.Compress(inputPath, options)
 	case compressor.FormatPNG:
 		return api.pngCompressor.Compress(inputPath, options)
+	case compressor.FormatTIFF:
+		return api.tiffCompressor.Compress(inputPath, options)
+	case compressor.FormatBMP:
+		return api.bmpCompressor.Compress(inputPath, options)
+	case compressor.FormatQOI:
+		return api.qoiCompressor.Compress(inputPath, options)
+	case compressor.FormatSVG:
+		return api.svgCompressor.Compress(inputPath, options)
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
 }
 
+// CompressInPlace replaces an image with its compressed version when that is
+// smaller, keeping its permissions and modification time. The original is
+// copied under options.BackupDir first when set, or next to options.Journal.
+func (api *ImageAPI) CompressInPlace(inputPath string, options compressor.CompressionOptions) (*compressor.CompressionResult, error) {
+	options.InPlace = true
+	return api.CompressImage(inputPath, options)
+}
+
+// Undo reverts the files recorded in a journal, newest first
+func (api *ImageAPI) Undo(journalPath string) ([]compressor.UndoResult, error) {
+	return compressor.Undo(journalPath)
+}
+
 // GetImageInfo returns information about an image
 func (api *ImageAPI) GetImageInfo(inputPath string) (*compressor.ImageInfo, error) {
 	return compressor.GetImageInfo(inputPath)
 }
 
+// GetImageInfoWithOptions returns information about an image, decoding it to
+// tell whether its transparency is used when options ask for it
+func (api *ImageAPI) GetImageInfoWithOptions(inputPath string, options compressor.InfoOptions) (*compressor.ImageInfo, error) {
+	return compressor.GetImageInfoWithOptions(inputPath, options)
+}
+
 // EstimateSize estimates the compressed size of an image
 func (api *ImageAPI) EstimateSize(inputPath string, options compressor.CompressionOptions) (int64, error) {
 	format, err := compressor.GetImageFormat(inputPath)
@@ -57,11 +143,39 @@ func (api *ImageAPI) EstimateSize(inputPath string, options compressor.Compressi
 		return api.jpegCompressor.EstimateSize(inputPath, options)
 	case compressor.FormatPNG:
 		return api.pngCompressor.EstimateSize(inputPath, options)
+	case compressor.FormatTIFF:
+		return api.tiffCompressor.EstimateSize(inputPath, options)
+	case compressor.FormatBMP:
+		return api.bmpCompressor.EstimateSize(inputPath, options)
+	case compressor.FormatQOI:
+		return api.qoiCompressor.EstimateSize(inputPath, options)
+	case compressor.FormatSVG:
+		return api.svgCompressor.EstimateSize(inputPath, options)
 	default:
 		return 0, fmt.Errorf("unsupported format: %s", format)
 	}
 }
 
+// GenerateFavicons produces favicon.ico, apple-touch and Android icons and a
+// web manifest from one source image
+func (api *ImageAPI) GenerateFavicons(inputPath, outputDir string, options compressor.CompressionOptions) (*compressor.FaviconSet, error) {
+	if err := api.ValidateImage(inputPath); err != nil {
+		return nil, err
+	}
+	return compressor.GenerateFavicons(inputPath, outputDir, options)
+}
+
+// PackAtlas packs a batch of images (e.g. from ScanDirectory) into one
+// optimized PNG with JSON and CSS coordinate maps
+func (api *ImageAPI) PackAtlas(inputPaths []string, atlasOptions compressor.AtlasOptions, options compressor.CompressionOptions) (*compressor.AtlasResult, error) {
+	for _, path := range inputPaths {
+		if err := api.ValidateImage(path); err != nil {
+			return nil, err
+		}
+	}
+	return compressor.PackAtlas(inputPaths, atlasOptions, options)
+}
+
 // BatchResult contains results for batch compression
 type BatchResult struct {
 	Results        []*compressor.CompressionResult
@@ -70,86 +184,120 @@ type BatchResult struct {
 	TotalReduction float64
 	SuccessCount   int
 	FailCount      int
+	SkipCount      int // Inputs left alone, counted in neither total
 }
 
-// BatchCompress compresses multiple images concurrently
+// BatchCompress compresses multiple images concurrently. Jobs are weighed by
+// their decoded size so the running ones stay within options.MemoryBudget,
+// on at most options.Workers workers. A *compressor.CollisionError is returned
+// before any work starts when two inputs would write the same output.
 func (api *ImageAPI) BatchCompress(inputPaths []string, options compressor.CompressionOptions, progressChan chan<- *compressor.CompressionResult) (*BatchResult, error) {
-	batchResult := &BatchResult{
-		Results: make([]*compressor.CompressionResult, 0, len(inputPaths)),
+	if options.OutputTemplate != "" {
+		if err := compressor.ValidateTemplate(options.OutputTemplate); err != nil {
+			return nil, err
+		}
 	}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-
-	// Limit concurrency to avoid overwhelming the system
-	semaphore := make(chan struct{}, 4)
-
-	for _, path := range inputPaths {
-		wg.Add(1)
-		go func(inputPath string) {
-			defer wg.Done()
-
-			semaphore <- struct{}{}        // Acquire
-			defer func() { <-semaphore }() // Release
-
-			result, _ := api.CompressImage(inputPath, options)
-
-			mu.Lock()
-			batchResult.Results = append(batchResult.Results, result)
-			if result.Success {
-				batchResult.SuccessCount++
-				batchResult.TotalInput += result.InputSize
-				batchResult.TotalOutput += result.OutputSize
-			} else {
-				batchResult.FailCount++
-			}
-			mu.Unlock()
-
-			if progressChan != nil {
-				progressChan <- result
-			}
-		}(path)
+	// Inputs that would overwrite each other's outputs stop the batch before
+	// anything is written
+	collisions, err := compressor.FindCollisions(inputPaths, options)
+	if err != nil {
+		return nil, err
 	}
-
-	wg.Wait()
-
-	if batchResult.TotalInput > 0 {
-		batchResult.TotalReduction = compressor.CalculateReduction(batchResult.TotalInput, batchResult.TotalOutput)
+	if len(collisions) > 0 {
+		return nil, &compressor.CollisionError{Collisions: collisions}
 	}
 
+	batchResult := &BatchResult{
+		Results: make([]*compressor.CompressionResult, 0, len(inputPaths)),
+	}
+	jobs := planBatch(inputPaths, options)
+	newScheduler(options.Workers, options.MemoryBudget).run(jobs, api.batchWorker(batchResult, options, progressChan))
 	return batchResult, nil
 }
 
-// ScanDirectory scans a directory for supported images
-func (api *ImageAPI) ScanDirectory(dirPath string, recursive bool) ([]string, error) {
-	var images []string
-
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// BatchCompressStream compresses images as they arrive on inputs, such as
+// the Paths of a Scan, until it is closed, so work starts while a scan is
+// still running. Jobs are scheduled like in BatchCompress, except that
+// LargestFirst has no effect. Since later inputs are not known up front, an
+// input whose output an earlier one already claims fails with a
+// *compressor.CollisionError instead of stopping the batch.
+func (api *ImageAPI) BatchCompressStream(inputs <-chan string, options compressor.CompressionOptions, progressChan chan<- *compressor.CompressionResult) (*BatchResult, error) {
+	if options.OutputTemplate != "" {
+		if err := compressor.ValidateTemplate(options.OutputTemplate); err != nil {
+			return nil, err
 		}
+	}
 
-		if info.IsDir() {
-			if !recursive && path != dirPath {
-				return filepath.SkipDir
+	s := newScheduler(options.Workers, options.MemoryBudget)
+	jobs := make(chan batchJob)
+	go func() {
+		defer close(jobs)
+		claims := make(map[string]string) // Output path to the input claiming it
+		for path := range inputs {
+			job := batchJob{path: path, weight: estimateMemory(path)}
+			if outputs, err := compressor.PredictOutputPaths(path, options); err == nil && !options.InPlace {
+				for _, output := range outputs {
+					if first, ok := claims[output]; ok && first != path {
+						job.err = &compressor.CollisionError{Collisions: []compressor.OutputCollision{
+							{OutputPath: output, Inputs: []string{first, path}},
+						}}
+						break
+					}
+				}
+				if job.err == nil {
+					for _, output := range outputs {
+						claims[output] = path
+					}
+				}
 			}
-			return nil
+			jobs <- job
 		}
+	}()
+
+	batchResult := &BatchResult{}
+	s.runStream(jobs, s.workers*4, api.batchWorker(batchResult, options, progressChan))
+	return batchResult, nil
+}
+
+// batchWorker returns the scheduler callback that compresses a job and adds
+// its result to batchResult
+func (api *ImageAPI) batchWorker(batchResult *BatchResult, options compressor.CompressionOptions, progressChan chan<- *compressor.CompressionResult) func(batchJob) {
+	var mu sync.Mutex
+	if options.TagOutputs && options.Tags == nil {
+		options.Tags = compressor.NewTagCache()
+	}
 
-		// Check if it's a supported image format
-		_, err = compressor.GetImageFormat(path)
+	return func(job batchJob) {
+		var result *compressor.CompressionResult
+		err := job.err
 		if err == nil {
-			images = append(images, path)
+			result, err = api.CompressImage(job.path, options)
+		}
+		if result == nil {
+			result = &compressor.CompressionResult{InputPath: job.path, Error: err}
 		}
 
-		return nil
-	}
+		mu.Lock()
+		batchResult.Results = append(batchResult.Results, result)
+		if result.Skipped {
+			batchResult.SkipCount++
+		} else if result.Success {
+			batchResult.SuccessCount++
+			batchResult.TotalInput += result.InputSize
+			batchResult.TotalOutput += result.OutputSize
+		} else {
+			batchResult.FailCount++
+		}
+		if batchResult.TotalInput > 0 {
+			batchResult.TotalReduction = compressor.CalculateReduction(batchResult.TotalInput, batchResult.TotalOutput)
+		}
+		mu.Unlock()
 
-	if err := filepath.Walk(dirPath, walkFn); err != nil {
-		return nil, fmt.Errorf("failed to scan directory: %w", err)
+		if progressChan != nil {
+			progressChan <- result
+		}
 	}
-
-	return images, nil
 }
 
 // ValidateImage checks if a file is a valid supported image
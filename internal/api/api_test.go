@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/virakt/imgshrink/internal/compressor"
+)
+
+func TestCompressImageSkipsTagged(t *testing.T) {
+	tests := []struct {
+		name     string
+		rerun    func(options *compressor.CompressionOptions)
+		wantSkip bool
+	}{
+		{"same options", func(options *compressor.CompressionOptions) {}, true},
+		{"changed options", func(options *compressor.CompressionOptions) { options.Quality-- }, false},
+		{"tags off", func(options *compressor.CompressionOptions) { options.TagOutputs = false }, false},
+		{"forced", func(options *compressor.CompressionOptions) { options.Force = true }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := filepath.Join(t.TempDir(), "a.png")
+			writeFile(t, input, pngFile(t, image.Pt(64, 64)))
+
+			api := NewImageAPI()
+			options := compressor.DefaultOptions()
+			options.InPlace = true
+			options.TagOutputs = true
+			options.Tags = compressor.NewTagCache()
+			result, err := api.CompressImage(input, options)
+			if err != nil {
+				t.Fatalf("first run error = %v", err)
+			}
+			if result.Skipped {
+				t.Fatalf("first run skipped: %s", result.SkipReason)
+			}
+
+			tt.rerun(&options)
+			result, err = api.CompressImage(input, options)
+			if err != nil {
+				t.Fatalf("rerun error = %v", err)
+			}
+			tagged := result.Skipped && strings.HasPrefix(result.SkipReason, "already processed")
+			if tagged != tt.wantSkip {
+				t.Errorf("rerun skipped = %v (%s), want %v", result.Skipped, result.SkipReason, tt.wantSkip)
+			}
+		})
+	}
+}
+
+// pngFile returns a blank uncompressed PNG, which compressing always shrinks
+func pngFile(t *testing.T, size image.Point) string {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.NoCompression}
+	if err := encoder.Encode(&buf, image.NewGray(image.Rectangle{Max: size})); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/virakt/imgshrink/internal/compressor"
+)
+
+// ExtensionFix is the outcome of renaming one misnamed image
+type ExtensionFix struct {
+	compressor.Misnamed
+	Renamed bool  `json:"renamed"` // False in a dry run or on error
+	Error   error `json:"-"`
+}
+
+// MarshalJSON encodes the fix with its error as a message string
+func (f ExtensionFix) MarshalJSON() ([]byte, error) {
+	type plain ExtensionFix
+	var message string
+	if f.Error != nil {
+		message = f.Error.Error()
+	}
+	return json.Marshal(struct {
+		plain
+		Error string `json:"error,omitempty"`
+	}{plain(f), message})
+}
+
+// FindMisnamed scans a directory by file signature, whatever scan says, and
+// returns the images whose extension does not match their format, sorted by
+// path. Files that could not be checked are joined into the error, which is
+// returned along with the images that could.
+func (api *ImageAPI) FindMisnamed(dirPath string, scan ScanOptions) ([]compressor.Misnamed, error) {
+	scan.SniffContent = true
+	s, err := api.StreamDirectory(dirPath, scan)
+	if err != nil {
+		return nil, err
+	}
+
+	var misnamed []compressor.Misnamed
+	var errs []error
+	for path := range s.Paths() {
+		m, err := compressor.CheckExtension(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		} else if m != nil {
+			misnamed = append(misnamed, *m)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(misnamed, func(a, b int) bool {
+		return misnamed[a].Path < misnamed[b].Path
+	})
+	return misnamed, errors.Join(errs...)
+}
+
+// FixExtensions renames misnamed images to their suggested paths, or with
+// dryRun only checks that they could be. A file is never renamed over an
+// existing one or over another image's new name.
+func (api *ImageAPI) FixExtensions(misnamed []compressor.Misnamed, dryRun bool) []ExtensionFix {
+	fixes := make([]ExtensionFix, len(misnamed))
+	claimed := make(map[string]string) // New path to the image taking it
+	for i, m := range misnamed {
+		fix := &fixes[i]
+		fix.Misnamed = m
+
+		if other, ok := claimed[m.Suggested]; ok {
+			fix.Error = fmt.Errorf("%s is also renamed to %s", other, m.Suggested)
+			continue
+		}
+		claimed[m.Suggested] = m.Path
+
+		if dryRun {
+			if err := compressor.CanFixExtension(m); err != nil {
+				fix.Error = err
+			}
+			continue
+		}
+		if err := compressor.FixExtension(m); err != nil {
+			fix.Error = err
+			continue
+		}
+		fix.Renamed = true
+	}
+	return fixes
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/virakt/imgshrink/internal/compressor"
+)
+
+func TestFindMisnamed(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"right.png", "wrong.jpg", "noext", "sub/wrong.jpeg"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		writeFile(t, path, pngFile(t, image.Pt(2, 2)))
+	}
+	writeFile(t, filepath.Join(root, "notes.txt"), "not an image")
+
+	// Files without an image extension are found by their contents even when
+	// scan does not sniff
+	scan := DefaultScanOptions()
+	scan.SniffContent = false
+	misnamed, err := NewImageAPI().FindMisnamed(root, scan)
+	if err != nil {
+		t.Fatalf("FindMisnamed() error = %v", err)
+	}
+
+	var got []string
+	for _, m := range misnamed {
+		if m.Format != compressor.FormatPNG {
+			t.Errorf("%s sniffed as %s, want png", m.Path, m.Format)
+		}
+		rel, _ := filepath.Rel(root, m.Suggested)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"noext.png", "sub/wrong.png", "wrong.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("suggested %v, want %v", got, want)
+	}
+}
+
+func TestFixExtensions(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{"rename", false},
+		{"dry run", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			misnamed := []compressor.Misnamed{
+				{Path: "a.jpg", Suggested: "a.png"},
+				{Path: "b.jpg", Suggested: "b.png"}, // b.png exists
+				{Path: "c.jpg", Suggested: "c.png"},
+				{Path: "c.jpeg", Suggested: "c.png"}, // Claimed by c.jpg
+				{Path: "missing.jpg", Suggested: "missing.png"},
+			}
+			for _, name := range []string{"a.jpg", "b.jpg", "b.png", "c.jpg", "c.jpeg"} {
+				writeFile(t, filepath.Join(root, name), name)
+			}
+			for i := range misnamed {
+				misnamed[i].Path = filepath.Join(root, misnamed[i].Path)
+				misnamed[i].Suggested = filepath.Join(root, misnamed[i].Suggested)
+			}
+
+			fixes := NewImageAPI().FixExtensions(misnamed, tt.dryRun)
+
+			wantError := []bool{false, true, false, true, true}
+			for i, fix := range fixes {
+				name := filepath.Base(fix.Path)
+				if (fix.Error != nil) != wantError[i] {
+					t.Errorf("%s: error = %v, want error %v", name, fix.Error, wantError[i])
+				}
+				if want := !wantError[i] && !tt.dryRun; fix.Renamed != want {
+					t.Errorf("%s: renamed = %v, want %v", name, fix.Renamed, want)
+				}
+				_, err := os.Stat(fix.Path)
+				if moved := os.IsNotExist(err); moved != fix.Renamed && name != "missing.jpg" {
+					t.Errorf("%s: moved = %v, renamed = %v", name, moved, fix.Renamed)
+				}
+			}
+			if data, err := os.ReadFile(filepath.Join(root, "b.png")); err != nil || string(data) != "b.png" {
+				t.Errorf("b.png was replaced")
+			}
+			if !strings.Contains(fixes[3].Error.Error(), "c.jpg") {
+				t.Errorf("claimed error = %v, want it to name c.jpg", fixes[3].Error)
+			}
+		})
+	}
+}
+
+func TestExtensionFixJSON(t *testing.T) {
+	fix := ExtensionFix{Misnamed: compressor.Misnamed{Path: "a.jpg", Format: compressor.FormatPNG, Suggested: "a.png"}}
+	data, err := json.Marshal(fix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"path":"a.jpg","format":"png","suggested":"a.png","renamed":false}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+
+	fix.Error = os.ErrExist
+	data, err = json.Marshal(fix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), `"error":"file already exists"}`) {
+		t.Errorf("Marshal() = %s, want the error message", data)
+	}
+}
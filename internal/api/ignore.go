@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is read from every scanned directory; its patterns use
+// gitignore syntax and apply to the directory and everything below it
+const IgnoreFileName = ".imgshrinkignore"
+
+// ignoreRule is one gitignore-style pattern, from an ignore file or a glob
+type ignoreRule struct {
+	base    string         // Directory the pattern is relative to
+	pattern *regexp.Regexp // Matched against the slash path relative to base
+	negate  bool           // "!pattern" re-includes what earlier rules excluded
+	dirOnly bool           // "pattern/" only matches directories
+}
+
+// parseIgnoreRule compiles one line of an ignore file; blank lines and
+// comments yield no rule
+func parseIgnoreRule(line, base string) (*ignoreRule, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	rule := &ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+
+	// Patterns without an inner slash match at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	pattern, err := globPattern(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	if !anchored {
+		pattern = `(.*/)?` + pattern
+	}
+	if rule.pattern, err = regexp.Compile(`^` + pattern + `$`); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", line, err)
+	}
+	return rule, nil
+}
+
+// globPattern translates a gitignore glob into a regular expression
+func globPattern(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				switch {
+				case strings.HasPrefix(glob[i:], "**/"):
+					b.WriteString(`(.*/)?`)
+					i += 2
+				default:
+					b.WriteString(`.*`)
+					i++
+				}
+				continue
+			}
+			b.WriteString(`[^/]*`)
+		case '?':
+			b.WriteString(`[^/]`)
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", errors.New("unclosed [")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// readIgnoreFile loads the rules of a directory's ignore file, if it has one
+func readIgnoreFile(dir string) ([]*ignoreRule, error) {
+	file, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file: %w", err)
+	}
+	defer file.Close()
+
+	var rules []*ignoreRule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		rule, err := parseIgnoreRule(scanner.Text(), dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filepath.Join(dir, IgnoreFileName), line, err)
+		}
+		if rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %w", err)
+	}
+	return rules, nil
+}
+
+// compileGlobs turns include or exclude globs into rules relative to root
+func compileGlobs(globs []string, root string) ([]*ignoreRule, error) {
+	var rules []*ignoreRule
+	for _, glob := range globs {
+		rule, err := parseIgnoreRule(glob, root)
+		if err != nil {
+			return nil, err
+		}
+		if rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// matchRules returns whether the last rule matching path excludes it
+func matchRules(rules []*ignoreRule, path string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.matches(path, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchIncludes returns whether include rules admit a file below root. Like
+// excludes, the rules apply to each directory on the way down as well as to
+// the file, so "photos/" admits everything in photos; a deeper match
+// overrides a shallower one.
+func matchIncludes(rules []*ignoreRule, root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+
+	included := false
+	parts := strings.Split(rel, string(filepath.Separator))
+	current := root
+	for i, part := range parts {
+		current = filepath.Join(current, part)
+		isDir := i < len(parts)-1
+		for _, rule := range rules {
+			if rule.matches(current, isDir) {
+				included = !rule.negate
+			}
+		}
+	}
+	return included
+}
+
+// matches reports whether the rule's pattern matches path
+func (rule *ignoreRule) matches(path string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(rule.base, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return rule.pattern.MatchString(filepath.ToSlash(rel))
+}
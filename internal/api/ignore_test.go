@@ -0,0 +1,123 @@
+package api
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestGlobPattern(t *testing.T) {
+	tests := []struct {
+		glob      string
+		matches   []string
+		misses    []string
+		wantError bool
+	}{
+		{glob: "*.jpg", matches: []string{"a.jpg", ".jpg"}, misses: []string{"a.png", "dir/a.jpg"}},
+		{glob: "photo?.png", matches: []string{"photo1.png"}, misses: []string{"photo.png", "photo12.png", "photo/.png"}},
+		{glob: "**/raw", matches: []string{"raw", "a/raw", "a/b/raw"}, misses: []string{"araw"}},
+		{glob: "raw/**", matches: []string{"raw/a", "raw/a/b"}, misses: []string{"raw"}},
+		{glob: "a/**/b", matches: []string{"a/b", "a/x/b", "a/x/y/b"}, misses: []string{"ab", "a/xb"}},
+		{glob: "[abc].png", matches: []string{"a.png", "c.png"}, misses: []string{"d.png"}},
+		{glob: "[!abc].png", matches: []string{"d.png"}, misses: []string{"a.png"}},
+		{glob: "[a-c].png", matches: []string{"b.png"}, misses: []string{"x.png"}},
+		{glob: `\*.png`, matches: []string{"*.png"}, misses: []string{"a.png"}},
+		{glob: "a+b(1).png", matches: []string{"a+b(1).png"}, misses: []string{"aab1.png"}},
+		{glob: "[abc.png", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			pattern, err := globPattern(tt.glob)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("globPattern() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			re := regexp.MustCompile(`^` + pattern + `$`)
+			for _, path := range tt.matches {
+				if !re.MatchString(path) {
+					t.Errorf("%q does not match %q", pattern, path)
+				}
+			}
+			for _, path := range tt.misses {
+				if re.MatchString(path) {
+					t.Errorf("%q matches %q", pattern, path)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	root := filepath.FromSlash("/scan")
+
+	tests := []struct {
+		name  string
+		lines []string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"no rules", nil, "a.jpg", false, false},
+		{"any depth", []string{"*.png"}, "x/y/a.png", false, true},
+		{"anchored", []string{"/a.png"}, "x/a.png", false, false},
+		{"anchored at the root", []string{"/a.png"}, "a.png", false, true},
+		{"inner slash anchors", []string{"x/a.png"}, "y/x/a.png", false, false},
+		{"directory only on a file", []string{"raw/"}, "raw", false, false},
+		{"directory only on a directory", []string{"raw/"}, "x/raw", true, true},
+		{"negated", []string{"*.png", "!keep.png"}, "keep.png", false, false},
+		{"last rule wins", []string{"!keep.png", "*.png"}, "keep.png", false, true},
+		{"comment", []string{"# *.png"}, "a.png", false, false},
+		{"escaped hash", []string{`\#a.png`}, "#a.png", false, true},
+		{"outside the base", []string{"*.png"}, "../a.png", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileGlobs(tt.lines, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(root, filepath.FromSlash(tt.path))
+			if got := matchRules(rules, path, tt.isDir); got != tt.want {
+				t.Errorf("matchRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchIncludes(t *testing.T) {
+	root := filepath.FromSlash("/scan")
+
+	tests := []struct {
+		name  string
+		lines []string
+		path  string
+		want  bool
+	}{
+		{"file glob", []string{"*.jpg"}, "x/a.jpg", true},
+		{"file glob misses", []string{"*.jpg"}, "x/a.png", false},
+		{"directory only", []string{"photos/"}, "photos/a.jpg", true},
+		{"directory only nested", []string{"photos/"}, "2024/photos/trip/a.jpg", true},
+		{"directory only misses", []string{"photos/"}, "photos.jpg", false},
+		{"anchored directory", []string{"/photos/"}, "x/photos/a.jpg", false},
+		{"directory glob", []string{"photos/**"}, "photos/trip/a.jpg", true},
+		{"deeper negation", []string{"photos/", "!photos/raw/"}, "photos/raw/a.jpg", false},
+		{"deeper negation elsewhere", []string{"photos/", "!photos/raw/"}, "photos/a.jpg", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileGlobs(tt.lines, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(root, filepath.FromSlash(tt.path))
+			if got := matchIncludes(rules, root, path); got != tt.want {
+				t.Errorf("matchIncludes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
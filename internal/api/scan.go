@@ -0,0 +1,392 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/virakt/imgshrink/internal/compressor"
+)
+
+// ScanOptions selects the images a directory scan returns
+type ScanOptions struct {
+	Recursive      bool      // Descend into subdirectories
+	MaxDepth       int       // Subdirectory levels to descend, 0 means unlimited
+	IgnoreFiles    bool      // Honor .imgshrinkignore files (gitignore syntax)
+	Include        []string  // Gitignore-style globs, relative to the root, that files or their directories must match; empty means all
+	Exclude        []string  // Gitignore-style globs of files and directories to leave out
+	Hidden         bool      // Include dot files and dot directories
+	FollowSymlinks bool      // Descend into symlinked directories, each real directory once
+	MinSize        int64     // Bytes, 0 means no minimum
+	MaxSize        int64     // Bytes, 0 means no maximum
+	MinWidth       int       // Pixels, 0 means no minimum
+	MinHeight      int       // Pixels, 0 means no minimum
+	ModifiedSince  time.Time // Zero admits any modification time
+	Workers        int       // Directories read at once, 0 means GOMAXPROCS
+	SniffContent   bool      // Recognize images by file signature instead of extension
+}
+
+// DefaultScanOptions returns a recursive scan of visible files that honors
+// ignore files
+func DefaultScanOptions() ScanOptions {
+	return ScanOptions{
+		Recursive:   true,
+		IgnoreFiles: true,
+	}
+}
+
+// ScanDirectory scans a directory for supported images and returns them
+// sorted
+func (api *ImageAPI) ScanDirectory(dirPath string, scan ScanOptions) ([]string, error) {
+	s, err := api.StreamDirectory(dirPath, scan)
+	if err != nil {
+		return nil, err
+	}
+	return s.collect()
+}
+
+// ScanInputs scans a directory like ScanDirectory but leaves out what
+// compressing with options produces: files named with its suffix or
+// template, the output and backup directories, and the manifest's outputs.
+// With options.TagOutputs, files tagged by a run with the same options are
+// left out too unless options.Force is set.
+func (api *ImageAPI) ScanInputs(dirPath string, scan ScanOptions, options compressor.CompressionOptions) ([]string, error) {
+	s, err := api.StreamInputs(dirPath, scan, options)
+	if err != nil {
+		return nil, err
+	}
+	return s.collect()
+}
+
+// StreamDirectory starts a scan that reads directories concurrently and sends
+// each image on Paths as soon as it is found, in no particular order
+func (api *ImageAPI) StreamDirectory(dirPath string, scan ScanOptions) (*Scan, error) {
+	return startScan(dirPath, scan, nil)
+}
+
+// StreamInputs starts a streaming scan that leaves out outputs like
+// ScanInputs
+func (api *ImageAPI) StreamInputs(dirPath string, scan ScanOptions, options compressor.CompressionOptions) (*Scan, error) {
+	return startScan(dirPath, scan, compressor.NewOutputFilter(options))
+}
+
+// Scan is a directory scan in progress
+type Scan struct {
+	paths    chan string
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	err      error // Set before done is closed
+}
+
+// Paths returns the images found so far; it is closed when the scan ends
+func (s *Scan) Paths() <-chan string {
+	return s.paths
+}
+
+// Stop ends the scan early. Paths is closed once the directories being read
+// are done.
+func (s *Scan) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Err waits for the scan to end and returns the error that stopped it, if any
+func (s *Scan) Err() error {
+	<-s.done
+	return s.err
+}
+
+// collect gathers every path and sorts them
+func (s *Scan) collect() ([]string, error) {
+	var images []string
+	for path := range s.paths {
+		images = append(images, path)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// dirJob is a directory waiting to be read, with the ignore rules of its
+// ancestors
+type dirJob struct {
+	path  string
+	depth int // Levels below the root
+	rules []*ignoreRule
+}
+
+// scanner walks one directory tree on a pool of workers. Directories found
+// are queued for any idle worker, so a slow subtree does not hold up the
+// others.
+type scanner struct {
+	scan    *Scan
+	root    string
+	options ScanOptions
+	include []*ignoreRule
+	exclude []*ignoreRule
+	filter  *compressor.OutputFilter // Nil keeps earlier outputs
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []dirJob
+	pending int             // Directories queued or being read
+	visited map[string]bool // Real paths of entered directories
+	errOnce sync.Once
+}
+
+func startScan(dirPath string, scan ScanOptions, filter *compressor.OutputFilter) (*Scan, error) {
+	s := &scanner{
+		scan: &Scan{
+			paths: make(chan string),
+			stop:  make(chan struct{}),
+			done:  make(chan struct{}),
+		},
+		root:    dirPath,
+		options: scan,
+		filter:  filter,
+		visited: make(map[string]bool),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	var err error
+	if s.include, err = compileGlobs(scan.Include, dirPath); err != nil {
+		return nil, fmt.Errorf("invalid include glob: %w", err)
+	}
+	if s.exclude, err = compileGlobs(scan.Exclude, dirPath); err != nil {
+		return nil, fmt.Errorf("invalid exclude glob: %w", err)
+	}
+
+	workers := scan.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	s.enter(dirPath)
+	s.push(dirJob{path: dirPath})
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(s.scan.paths)
+		close(s.scan.done)
+	}()
+
+	return s.scan, nil
+}
+
+// push queues a directory
+func (s *scanner) push(job dirJob) {
+	s.mu.Lock()
+	s.queue = append(s.queue, job)
+	s.pending++
+	s.cond.Signal()
+	s.mu.Unlock()
+}
+
+// work reads queued directories until none are queued or being read. The
+// newest directory is taken first, which keeps the queue as short as a
+// depth-first walk would.
+func (s *scanner) work() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		for len(s.queue) == 0 && s.pending > 0 {
+			s.cond.Wait()
+		}
+		if s.pending == 0 {
+			return
+		}
+
+		job := s.queue[len(s.queue)-1]
+		s.queue = s.queue[:len(s.queue)-1]
+		s.mu.Unlock()
+
+		if !s.stopped() {
+			if err := s.readDir(job); err != nil {
+				s.fail(err)
+			}
+		}
+
+		s.mu.Lock()
+		s.pending--
+		if s.pending == 0 {
+			s.cond.Broadcast()
+		}
+	}
+}
+
+// stopped reports whether the scan was stopped or failed
+func (s *scanner) stopped() bool {
+	select {
+	case <-s.scan.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail stops the scan with its first error
+func (s *scanner) fail(err error) {
+	s.errOnce.Do(func() {
+		s.scan.err = fmt.Errorf("failed to scan directory: %w", err)
+		s.scan.Stop()
+	})
+}
+
+// emit sends an image unless the scan is stopped first
+func (s *scanner) emit(path string) {
+	select {
+	case s.scan.paths <- path:
+	case <-s.scan.stop:
+	}
+}
+
+// readDir sends the images in a directory and queues its subdirectories
+func (s *scanner) readDir(job dirJob) error {
+	rules := job.rules
+	if s.options.IgnoreFiles {
+		own, err := readIgnoreFile(job.path)
+		if err != nil {
+			return err
+		}
+		// Siblings must not see each other's rules
+		rules = append(rules[:len(rules):len(rules)], own...)
+	}
+
+	entries, err := os.ReadDir(job.path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !s.options.Hidden && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(job.path, entry.Name())
+		info, err := s.stat(path, entry)
+		if err != nil {
+			// Broken symlinks and files removed during the scan
+			continue
+		}
+
+		if !info.IsDir() {
+			if s.accept(path, info, rules) {
+				s.emit(path)
+			}
+			continue
+		}
+
+		if !s.options.Recursive || s.options.MaxDepth > 0 && job.depth >= s.options.MaxDepth {
+			continue
+		}
+		if matchRules(rules, path, true) || matchRules(s.exclude, path, true) {
+			continue
+		}
+		if s.filter != nil && s.filter.SkipDir(path, s.root) {
+			continue
+		}
+		if !s.enter(path) {
+			continue
+		}
+		s.push(dirJob{path: path, depth: job.depth + 1, rules: rules})
+	}
+	return nil
+}
+
+// stat describes an entry, resolving symlinks. Symlinked files are always
+// scanned, symlinked directories only when following symlinks.
+func (s *scanner) stat(path string, entry os.DirEntry) (os.FileInfo, error) {
+	if entry.Type()&os.ModeSymlink == 0 {
+		return entry.Info()
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() && !s.options.FollowSymlinks {
+		return nil, fmt.Errorf("not following symlink %s", path)
+	}
+	return info, nil
+}
+
+// enter records a directory by its real path and reports whether it was new,
+// so symlink loops and repeated links are walked once
+func (s *scanner) enter(dir string) bool {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.visited[real] {
+		return false
+	}
+	s.visited[real] = true
+	return true
+}
+
+// accept applies the file filters, cheapest first
+func (s *scanner) accept(path string, info os.FileInfo, rules []*ignoreRule) bool {
+	if !s.options.SniffContent {
+		if _, err := compressor.GetImageFormat(path); err != nil {
+			return false
+		}
+	}
+	if matchRules(rules, path, false) || matchRules(s.exclude, path, false) {
+		return false
+	}
+	if len(s.include) > 0 && !matchIncludes(s.include, s.root, path) {
+		return false
+	}
+	if s.filter != nil && s.filter.IsOutput(path) {
+		return false
+	}
+
+	if s.options.MinSize > 0 && info.Size() < s.options.MinSize {
+		return false
+	}
+	if s.options.MaxSize > 0 && info.Size() > s.options.MaxSize {
+		return false
+	}
+	if !s.options.ModifiedSince.IsZero() && info.ModTime().Before(s.options.ModifiedSince) {
+		return false
+	}
+
+	if s.options.SniffContent {
+		if _, err := compressor.SniffFormat(path); err != nil {
+			return false
+		}
+	}
+
+	if s.options.MinWidth > 0 || s.options.MinHeight > 0 {
+		width, height, err := compressor.ImageDimensions(path)
+		if err != nil || width < s.options.MinWidth || height < s.options.MinHeight {
+			return false
+		}
+	}
+
+	if s.filter != nil && s.filter.IsProcessed(path) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/virakt/imgshrink/internal/compressor"
+)
+
+func TestScanDirectory(t *testing.T) {
+	tree := []string{
+		"a.jpg",
+		"notes.txt",
+		".hidden.png",
+		"photos/b.png",
+		"photos/raw/c.jpg",
+		"cache/d.jpg",
+		"deep/1/2/e.jpg",
+		"a_compressed.jpg",
+	}
+
+	tests := []struct {
+		name    string
+		scan    func(scan *ScanOptions)
+		ignore  map[string]string // Ignore file contents by directory
+		outputs bool              // Leave out the outputs of the default options
+		want    []string
+	}{
+		{
+			name: "everything",
+			want: []string{"a.jpg", "a_compressed.jpg", "cache/d.jpg", "deep/1/2/e.jpg", "photos/b.png", "photos/raw/c.jpg"},
+		},
+		{
+			name: "not recursive",
+			scan: func(scan *ScanOptions) { scan.Recursive = false },
+			want: []string{"a.jpg", "a_compressed.jpg"},
+		},
+		{
+			name: "max depth",
+			scan: func(scan *ScanOptions) { scan.MaxDepth = 1 },
+			want: []string{"a.jpg", "a_compressed.jpg", "cache/d.jpg", "photos/b.png"},
+		},
+		{
+			name: "hidden",
+			scan: func(scan *ScanOptions) { scan.Hidden = true; scan.Recursive = false },
+			want: []string{".hidden.png", "a.jpg", "a_compressed.jpg"},
+		},
+		{
+			name:   "ignore file",
+			ignore: map[string]string{"": "cache/\n*.png\n", "photos": "!b.png\nraw/\n"},
+			want:   []string{"a.jpg", "a_compressed.jpg", "deep/1/2/e.jpg", "photos/b.png"},
+		},
+		{
+			name:   "ignore files disabled",
+			scan:   func(scan *ScanOptions) { scan.IgnoreFiles = false },
+			ignore: map[string]string{"": "*\n"},
+			want:   []string{"a.jpg", "a_compressed.jpg", "cache/d.jpg", "deep/1/2/e.jpg", "photos/b.png", "photos/raw/c.jpg"},
+		},
+		{
+			name: "include directory",
+			scan: func(scan *ScanOptions) { scan.Include = []string{"photos/"} },
+			want: []string{"photos/b.png", "photos/raw/c.jpg"},
+		},
+		{
+			name: "include and exclude",
+			scan: func(scan *ScanOptions) { scan.Include = []string{"*.jpg"}; scan.Exclude = []string{"deep", "raw/"} },
+			want: []string{"a.jpg", "a_compressed.jpg", "cache/d.jpg"},
+		},
+		{
+			name:    "outputs left out",
+			outputs: true,
+			want:    []string{"a.jpg", "cache/d.jpg", "deep/1/2/e.jpg", "photos/b.png", "photos/raw/c.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, name := range tree {
+				writeFile(t, filepath.Join(root, filepath.FromSlash(name)), "")
+			}
+			for dir, content := range tt.ignore {
+				writeFile(t, filepath.Join(root, dir, IgnoreFileName), content)
+			}
+
+			scan := DefaultScanOptions()
+			if tt.scan != nil {
+				tt.scan(&scan)
+			}
+			api := NewImageAPI()
+			var got []string
+			var err error
+			if tt.outputs {
+				got, err = api.ScanInputs(root, scan, compressor.DefaultOptions())
+			} else {
+				got, err = api.ScanDirectory(root, scan)
+			}
+			if err != nil {
+				t.Fatalf("scan error = %v", err)
+			}
+			if rel := relPaths(t, root, got); !reflect.DeepEqual(rel, tt.want) {
+				t.Errorf("scan = %v, want %v", rel, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanDirectorySymlinks(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "photos", "a.jpg"), "")
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "c.jpg"), "")
+	links := map[string]string{
+		filepath.Join(root, "shared"):         outside,              // Only reachable through the link
+		filepath.Join(root, "photos", "loop"): "..",                 // Back to the root
+		filepath.Join(root, "again"):          "photos",             // The same directory twice
+		filepath.Join(root, "b.jpg"):          "photos/a.jpg",       // A symlinked file
+		filepath.Join(root, "broken.jpg"):     "does-not-exist.jpg", // Left out
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks are not supported here: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		follow bool
+		want   int // Number of paths, since which link reaches photos first varies
+	}{
+		{"not followed", false, 2},
+		{"followed, each directory once", true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan := DefaultScanOptions()
+			scan.FollowSymlinks = tt.follow
+			got, err := NewImageAPI().ScanDirectory(root, scan)
+			if err != nil {
+				t.Fatalf("ScanDirectory() error = %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("ScanDirectory() = %v, want %d paths", relPaths(t, root, got), tt.want)
+			}
+		})
+	}
+}
+
+func TestScanInputsSkipsTagged(t *testing.T) {
+	tests := []struct {
+		name   string
+		rescan func(options *compressor.CompressionOptions)
+		want   []string
+	}{
+		{"same options", func(options *compressor.CompressionOptions) {}, []string{"b.png"}},
+		{"changed options", func(options *compressor.CompressionOptions) { options.CompressionLevel-- }, []string{"a.png", "b.png"}},
+		{"tags off", func(options *compressor.CompressionOptions) { options.TagOutputs = false }, []string{"a.png", "b.png"}},
+		{"forced", func(options *compressor.CompressionOptions) { options.Force = true }, []string{"a.png", "b.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, name := range []string{"a.png", "b.png"} {
+				writeFile(t, filepath.Join(root, name), pngFile(t, image.Pt(32, 32)))
+			}
+
+			api := NewImageAPI()
+			options := compressor.DefaultOptions()
+			options.InPlace = true
+			options.TagOutputs = true
+			if _, err := api.CompressImage(filepath.Join(root, "a.png"), options); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.rescan(&options)
+			got, err := api.ScanInputs(root, DefaultScanOptions(), options)
+			if err != nil {
+				t.Fatalf("ScanInputs() error = %v", err)
+			}
+			if rel := relPaths(t, root, got); !reflect.DeepEqual(rel, tt.want) {
+				t.Errorf("ScanInputs() = %v, want %v", rel, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanStop(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		writeFile(t, filepath.Join(root, name), "")
+	}
+
+	s, err := NewImageAPI().StreamDirectory(root, DefaultScanOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-s.Paths()
+	s.Stop()
+	for range s.Paths() {
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Err() = %v after Stop", err)
+	}
+}
+
+// writeFile writes content to path, creating its directory
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// relPaths makes scanned paths relative to root, with slashes
+func relPaths(t *testing.T, root string, paths []string) []string {
+	t.Helper()
+	var rel []string
+	for _, path := range paths {
+		r, err := filepath.Rel(root, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	return rel
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"image"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/virakt/imgshrink/internal/compressor"
+)
+
+// maxPassOver is how many later jobs may start ahead of a pending job that
+// does not fit the budget before it is waited for, so it cannot starve
+const maxPassOver = 4
+
+// batchJob is one input of a batch, weighted by the memory it is expected to
+// need while being compressed
+type batchJob struct {
+	path   string
+	weight int64
+	err    error // Fails the job without running it
+}
+
+// scheduler runs batch jobs on a bounded number of workers while keeping the
+// summed weight of running jobs within a memory budget
+type scheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	workers int
+	budget  int64 // 0 means unlimited
+	running int
+	inUse   int64
+	passed  int // Jobs started ahead of the first pending job
+}
+
+func newScheduler(workers int, budget int64) *scheduler {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	s := &scheduler{workers: workers, budget: budget}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// run starts every job as soon as a worker and enough budget are free. When
+// the next job does not fit, up to maxPassOver later smaller jobs may start
+// first; a job larger than the whole budget runs alone.
+func (s *scheduler) run(jobs []batchJob, do func(batchJob)) {
+	feed := make(chan batchJob, len(jobs))
+	for _, job := range jobs {
+		feed <- job
+	}
+	close(feed)
+	s.runStream(feed, len(jobs), do)
+}
+
+// runStream runs jobs like run as they arrive, until the channel is closed.
+// Only up to lookahead received jobs wait for a worker, so a slow consumer
+// holds back the producer.
+func (s *scheduler) runStream(jobs <-chan batchJob, lookahead int, do func(batchJob)) {
+	var wg sync.WaitGroup
+	var pending []batchJob
+	open := true
+	lookahead = max(lookahead, 1)
+
+	go func() {
+		for job := range jobs {
+			s.mu.Lock()
+			for len(pending) >= lookahead {
+				s.cond.Wait()
+			}
+			pending = append(pending, job)
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		}
+		s.mu.Lock()
+		open = false
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}()
+
+	s.mu.Lock()
+	for open || len(pending) > 0 {
+		i := s.next(pending)
+		if i < 0 {
+			s.cond.Wait()
+			continue
+		}
+
+		job := pending[i]
+		pending = append(pending[:i], pending[i+1:]...)
+		if i == 0 {
+			s.passed = 0
+		} else {
+			s.passed++
+		}
+		s.running++
+		s.inUse += job.weight
+		s.cond.Broadcast()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			do(job)
+
+			s.mu.Lock()
+			s.running--
+			s.inUse -= job.weight
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		}()
+	}
+	s.mu.Unlock()
+
+	wg.Wait()
+}
+
+// next returns the index of the first pending job that fits, or -1. Once the
+// first job has been passed over maxPassOver times, only it may start.
+func (s *scheduler) next(pending []batchJob) int {
+	if s.running >= s.workers {
+		return -1
+	}
+	for i, job := range pending {
+		if i > 0 && s.passed >= maxPassOver {
+			break
+		}
+		if s.running == 0 || s.budget <= 0 || s.inUse+job.weight <= s.budget {
+			return i
+		}
+	}
+	return -1
+}
+
+// planBatch weighs every input and orders the jobs, largest first if asked
+func planBatch(inputPaths []string, options compressor.CompressionOptions) []batchJob {
+	jobs := make([]batchJob, len(inputPaths))
+	for i, path := range inputPaths {
+		jobs[i] = batchJob{path: path, weight: estimateMemory(path)}
+	}
+	if options.LargestFirst {
+		sort.SliceStable(jobs, func(a, b int) bool {
+			return jobs[a].weight > jobs[b].weight
+		})
+	}
+	return jobs
+}
+
+// estimateMemory approximates the peak memory compressing a file takes: the
+// decoded RGBA image plus one working copy for resizing or format conversion.
+// Files without a readable header are weighed by their size.
+func estimateMemory(path string) int64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	if config, _, err := image.DecodeConfig(file); err == nil {
+		return int64(config.Width) * int64(config.Height) * 4 * 2
+	}
+	if stat, err := file.Stat(); err == nil {
+		return stat.Size()
+	}
+	return 0
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"image"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/virakt/imgshrink/internal/compressor"
+)
+
+func TestScheduler(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		budget  int64
+		weights []int64
+	}{
+		{"one worker", 1, 0, []int64{1, 2, 3, 4}},
+		{"unlimited budget", 3, 0, []int64{5, 5, 5, 5, 5, 5}},
+		{"budget", 4, 10, []int64{6, 3, 4, 2, 5, 1, 6}},
+		{"job larger than the budget", 4, 10, []int64{3, 25, 3, 4}},
+		{"no jobs", 2, 10, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := make([]batchJob, len(tt.weights))
+			for i, weight := range tt.weights {
+				jobs[i] = batchJob{path: strconv.Itoa(i), weight: weight}
+			}
+
+			var mu sync.Mutex
+			var running, maxRunning int
+			var inUse int64
+			ran := make(map[string]int)
+			do := func(job batchJob) {
+				mu.Lock()
+				running++
+				inUse += job.weight
+				maxRunning = max(maxRunning, running)
+				if tt.budget > 0 && inUse > tt.budget && running > 1 {
+					t.Errorf("%d jobs weighing %d running, budget %d", running, inUse, tt.budget)
+				}
+				ran[job.path]++
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				running--
+				inUse -= job.weight
+				mu.Unlock()
+			}
+
+			newScheduler(tt.workers, tt.budget).run(jobs, do)
+
+			if maxRunning > tt.workers {
+				t.Errorf("%d jobs ran at once on %d workers", maxRunning, tt.workers)
+			}
+			for _, job := range jobs {
+				if ran[job.path] != 1 {
+					t.Errorf("job %s ran %d times", job.path, ran[job.path])
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerPassOver(t *testing.T) {
+	// A large job waits behind a small one, with a long line of small jobs
+	// that would each fit next to the small ones
+	jobs := []batchJob{{path: "small", weight: 3}, {path: "large", weight: 9}}
+	for i := range 20 {
+		jobs = append(jobs, batchJob{path: strconv.Itoa(i), weight: 2})
+	}
+
+	var mu sync.Mutex
+	var started []string
+	newScheduler(4, 10).run(jobs, func(job batchJob) {
+		mu.Lock()
+		started = append(started, job.path)
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+	})
+
+	for i, path := range started {
+		if path == "large" {
+			if i > 1+maxPassOver {
+				t.Errorf("large job started after %d jobs, want at most %d", i, 1+maxPassOver)
+			}
+			return
+		}
+	}
+	t.Error("large job never started")
+}
+
+func TestSchedulerStream(t *testing.T) {
+	const count = 20
+	jobs := make(chan batchJob)
+	go func() {
+		defer close(jobs)
+		for i := range count {
+			jobs <- batchJob{path: strconv.Itoa(i), weight: int64(i%3 + 1)}
+		}
+	}()
+
+	var mu sync.Mutex
+	ran := make(map[string]bool)
+	newScheduler(2, 4).runStream(jobs, 2, func(job batchJob) {
+		mu.Lock()
+		ran[job.path] = true
+		mu.Unlock()
+	})
+
+	if len(ran) != count {
+		t.Errorf("ran %d jobs, want %d", len(ran), count)
+	}
+}
+
+func TestPlanBatch(t *testing.T) {
+	dir := t.TempDir()
+	sizes := map[string]image.Point{"small.png": {4, 4}, "large.png": {64, 32}, "medium.png": {16, 16}}
+	var inputs []string
+	for _, name := range []string{"small.png", "large.png", "medium.png"} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, pngFile(t, sizes[name]))
+		inputs = append(inputs, path)
+	}
+	notImage := filepath.Join(dir, "notes.png")
+	writeFile(t, notImage, "not an image")
+	inputs = append(inputs, notImage)
+
+	tests := []struct {
+		name         string
+		largestFirst bool
+		want         []string
+	}{
+		{"input order", false, []string{"small.png", "large.png", "medium.png", "notes.png"}},
+		{"largest first", true, []string{"large.png", "medium.png", "small.png", "notes.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := compressor.DefaultOptions()
+			options.LargestFirst = tt.largestFirst
+			jobs := planBatch(inputs, options)
+
+			for i, job := range jobs {
+				if name := filepath.Base(job.path); name != tt.want[i] {
+					t.Fatalf("job %d is %s, want %s", i, name, tt.want[i])
+				}
+				want := int64(len("not an image"))
+				if size, ok := sizes[filepath.Base(job.path)]; ok {
+					want = int64(size.X) * int64(size.Y) * 4 * 2
+				}
+				if job.weight != want {
+					t.Errorf("%s weighs %d, want %d", filepath.Base(job.path), job.weight, want)
+				}
+			}
+		})
+	}
+}
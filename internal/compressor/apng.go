@@ -0,0 +1,339 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+)
+
+// ErrAnimatedPNG is returned when an operation would drop the animation of an
+// animated PNG, such as resizing it or converting it to another format
+var ErrAnimatedPNG = errors.New("animated PNG would lose its animation")
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngChunk is a single chunk of a PNG stream
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+// pngMetadataChunks lists ancillary chunks that carry metadata only and are
+// dropped when stripping metadata
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+	"eXIf": true,
+}
+
+// readPNGChunks splits a PNG stream into its chunks, stopping after IEND
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if len(data) < len(pngSignature) || string(data[:len(pngSignature)]) != pngSignature {
+		return nil, errors.New("png: invalid signature")
+	}
+
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if length < 0 || pos+12+length > len(data) {
+			return nil, errors.New("png: chunk exceeds file size")
+		}
+		chunk := pngChunk{
+			Type: string(data[pos+4 : pos+8]),
+			Data: data[pos+8 : pos+8+length],
+		}
+		chunks = append(chunks, chunk)
+		pos += 12 + length
+		if chunk.Type == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// writePNGChunk writes a chunk with its length and CRC
+func writePNGChunk(w io.Writer, chunkType string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	w.Write(header[:])
+	w.Write(data)
+	w.Write(footer[:])
+}
+
+// apngFrameCount returns the number of frames declared in the acTL chunk, or
+// 0 if the PNG is not animated
+func apngFrameCount(chunks []pngChunk) int {
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "acTL":
+			if len(chunk.Data) >= 4 {
+				return int(binary.BigEndian.Uint32(chunk.Data[:4]))
+			}
+		case "IDAT":
+			// acTL must precede the image data
+			return 0
+		}
+	}
+	return 0
+}
+
+// scanAPNGFrames reads the chunk headers of a PNG stream, seeking over chunk
+// data, and returns the frame count declared by acTL and the size of every
+// frame control chunk. A static PNG has neither.
+func scanAPNGFrames(r io.ReadSeeker) (int, []image.Point, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || string(signature) != pngSignature {
+		return 0, nil, errors.New("png: invalid signature")
+	}
+
+	declared := 0
+	var sizes []image.Point
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			// A truncated stream ends the scan like IEND
+			return declared, sizes, nil
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:8])
+		if chunkType == "IEND" {
+			return declared, sizes, nil
+		}
+
+		var data []byte
+		switch chunkType {
+		case "acTL":
+			data = make([]byte, 4)
+		case "fcTL":
+			data = make([]byte, 12)
+		}
+		if int64(len(data)) > length {
+			return 0, nil, fmt.Errorf("png: %s chunk too short", chunkType)
+		}
+		if data != nil {
+			if _, err := io.ReadFull(r, data); err != nil {
+				return declared, sizes, nil
+			}
+		}
+		// Skip the rest of the data and the CRC
+		if _, err := r.Seek(length-int64(len(data))+4, io.SeekCurrent); err != nil {
+			return declared, sizes, nil
+		}
+
+		switch chunkType {
+		case "acTL":
+			declared = int(binary.BigEndian.Uint32(data[:4]))
+		case "fcTL":
+			sizes = append(sizes, image.Pt(int(binary.BigEndian.Uint32(data[4:8])), int(binary.BigEndian.Uint32(data[8:12]))))
+		}
+	}
+}
+
+// pngDimensions returns the image size recorded in the IHDR chunk
+func pngDimensions(chunks []pngChunk) (int, int) {
+	if len(chunks) == 0 || chunks[0].Type != "IHDR" || len(chunks[0].Data) < 8 {
+		return 0, 0
+	}
+	return int(binary.BigEndian.Uint32(chunks[0].Data[0:4])), int(binary.BigEndian.Uint32(chunks[0].Data[4:8]))
+}
+
+// pngRawSize returns the size of the filtered scanlines of a width x height
+// image in the pixel format and interlacing of the IHDR chunk, which is what
+// its image data inflates to
+func pngRawSize(ihdr []byte, width, height int) (int64, error) {
+	if len(ihdr) < 13 {
+		return 0, errors.New("png: truncated IHDR chunk")
+	}
+	channels := map[byte]int64{0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[ihdr[9]]
+	if channels == 0 || width <= 0 || height <= 0 {
+		return 0, errors.New("png: invalid image header")
+	}
+	bitsPerPixel := int64(ihdr[8]) * channels
+
+	rows := func(w, h int64) int64 {
+		if w <= 0 || h <= 0 {
+			return 0
+		}
+		return h * (1 + (w*bitsPerPixel+7)/8)
+	}
+	w, h := int64(width), int64(height)
+	if ihdr[12] == 0 {
+		return rows(w, h), nil
+	}
+
+	// Adam7 passes, as starting column and row and their steps
+	var size int64
+	for _, pass := range [7][4]int64{{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4}, {0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2}} {
+		size += rows((w-pass[0]+pass[2]-1)/pass[2], (h-pass[1]+pass[3]-1)/pass[3])
+	}
+	return size, nil
+}
+
+// recompressAPNG recompresses the image data of every frame of an animated PNG
+// without decoding pixels, so frames, timing and blending are kept intact
+func recompressAPNG(chunks []pngChunk, options CompressionOptions) ([]byte, error) {
+	level := zlibLevel(options.CompressionLevel)
+
+	// Image data may inflate to no more than its frame's declared size
+	if len(chunks) == 0 || chunks[0].Type != "IHDR" {
+		return nil, errors.New("png: missing IHDR chunk")
+	}
+	ihdr := chunks[0].Data
+	width, height := pngDimensions(chunks)
+	defaultSize, err := pngRawSize(ihdr, width, height)
+	if err != nil {
+		return nil, err
+	}
+	var frameSize int64
+
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+
+	var sequence uint32
+	var frame int
+	nextSequence := func() []byte {
+		var seq [4]byte
+		binary.BigEndian.PutUint32(seq[:], sequence)
+		sequence++
+		return seq[:]
+	}
+
+	for i := 0; i < len(chunks); i++ {
+		chunk := chunks[i]
+
+		switch {
+		case chunk.Type == "IDAT":
+			// Gather consecutive IDAT chunks into one zlib stream
+			var stream []byte
+			for ; i < len(chunks) && chunks[i].Type == "IDAT"; i++ {
+				stream = append(stream, chunks[i].Data...)
+			}
+			i--
+			data, err := recompressZlib(stream, level, defaultSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to recompress default image: %w", err)
+			}
+			writePNGChunk(&out, "IDAT", data)
+
+		case chunk.Type == "fdAT":
+			// Gather consecutive fdAT chunks, dropping their sequence numbers
+			var stream []byte
+			for ; i < len(chunks) && chunks[i].Type == "fdAT"; i++ {
+				if len(chunks[i].Data) < 4 {
+					return nil, errors.New("png: truncated fdAT chunk")
+				}
+				stream = append(stream, chunks[i].Data[4:]...)
+			}
+			i--
+			if frameSize == 0 {
+				return nil, errors.New("png: fdAT chunk without fcTL")
+			}
+			data, err := recompressZlib(stream, level, frameSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to recompress frame %d: %w", frame, err)
+			}
+			writePNGChunk(&out, "fdAT", append(nextSequence(), data...))
+
+		case chunk.Type == "fcTL":
+			// Renumber, chunk counts change when streams are merged
+			if len(chunk.Data) < 12 {
+				return nil, errors.New("png: truncated fcTL chunk")
+			}
+			frameSize, err = pngRawSize(ihdr,
+				int(binary.BigEndian.Uint32(chunk.Data[4:8])), int(binary.BigEndian.Uint32(chunk.Data[8:12])))
+			if err != nil {
+				return nil, fmt.Errorf("invalid frame %d: %w", frame+1, err)
+			}
+			frame++
+			writePNGChunk(&out, "fcTL", append(nextSequence(), chunk.Data[4:]...))
+
+		case options.StripMetadata && pngMetadataChunks[chunk.Type]:
+			// Drop metadata
+
+		default:
+			writePNGChunk(&out, chunk.Type, chunk.Data)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// recompressZlib inflates a zlib stream of at most limit bytes and deflates
+// it again at level, keeping the original if that is smaller
+func recompressZlib(stream []byte, level int, limit int64) ([]byte, error) {
+	raw, err := inflateLimited(stream, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer, err := zlib.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() >= len(stream) {
+		return stream, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// errInflateLimit is returned when a zlib stream inflates past its limit
+var errInflateLimit = errors.New("zlib stream exceeds its declared size")
+
+// inflateLimited inflates a zlib stream, failing once it exceeds limit bytes
+// rather than exhausting memory on a compression bomb
+func inflateLimited(stream []byte, limit int64) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		return nil, errInflateLimit
+	}
+	return raw, nil
+}
+
+// zlibLevel maps a compression level (0-9) to a zlib level the same way
+// pngCompressionLevel does for the PNG encoder
+func zlibLevel(level int) int {
+	switch {
+	case level <= 0:
+		return zlib.NoCompression
+	case level <= 3:
+		return zlib.BestSpeed
+	case level <= 6:
+		return zlib.DefaultCompression
+	default:
+		return zlib.BestCompression
+	}
+}
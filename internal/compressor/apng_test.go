@@ -0,0 +1,193 @@
+package compressor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testIHDR returns an IHDR chunk for an 8-bit RGBA image
+func testIHDR(width, height int, interlaced bool) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8] = 8
+	ihdr[9] = 6
+	if interlaced {
+		ihdr[12] = 1
+	}
+	return ihdr
+}
+
+// testDeflate compresses data as a zlib stream at the fastest level
+func testDeflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, _ := zlib.NewWriterLevel(&buf, zlib.BestSpeed)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testScanlines returns the filtered scanlines of an RGBA image of one color
+func testScanlines(width, height int, value byte) []byte {
+	var raw []byte
+	for y := 0; y < height; y++ {
+		raw = append(raw, 0)
+		raw = append(raw, bytes.Repeat([]byte{value}, width*4)...)
+	}
+	return raw
+}
+
+// testFcTL returns a frame control chunk for a frame of the given size
+func testFcTL(sequence uint32, width, height int) []byte {
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], sequence)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(width))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(height))
+	binary.BigEndian.PutUint16(fctl[20:], 1)
+	binary.BigEndian.PutUint16(fctl[22:], 10)
+	return fctl
+}
+
+// testAPNG builds a two-frame animated PNG, the second frame smaller than the
+// canvas; idat and fdat replace the default image and frame data when set
+func testAPNG(t *testing.T, idat, fdat []byte) []pngChunk {
+	t.Helper()
+	if idat == nil {
+		idat = testDeflate(t, testScanlines(4, 4, 0x80))
+	}
+	if fdat == nil {
+		fdat = testDeflate(t, testScanlines(2, 2, 0x40))
+	}
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl, 2)
+
+	return []pngChunk{
+		{"IHDR", testIHDR(4, 4, false)},
+		{"acTL", actl},
+		{"fcTL", testFcTL(0, 4, 4)},
+		{"tEXt", []byte("Comment\x00hello")},
+		{"IDAT", idat},
+		{"fcTL", testFcTL(1, 2, 2)},
+		{"fdAT", append([]byte{0, 0, 0, 2}, fdat...)},
+		{"IEND", nil},
+	}
+}
+
+func encodeTestPNG(chunks []pngChunk) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+	for _, chunk := range chunks {
+		writePNGChunk(&buf, chunk.Type, chunk.Data)
+	}
+	return buf.Bytes()
+}
+
+func TestRecompressAPNGRoundTrip(t *testing.T) {
+	for _, strip := range []bool{false, true} {
+		options := DefaultOptions()
+		options.CompressionLevel = 9
+		options.StripMetadata = strip
+
+		data, err := recompressAPNG(testAPNG(t, nil, nil), options)
+		if err != nil {
+			t.Fatalf("recompressAPNG: %v", err)
+		}
+
+		chunks, err := readPNGChunks(data)
+		if err != nil {
+			t.Fatalf("readPNGChunks: %v", err)
+		}
+		if frames := apngFrameCount(chunks); frames != 2 {
+			t.Errorf("frames = %d, want 2", frames)
+		}
+
+		// Sequence numbers must count up across fcTL and fdAT
+		var sequence uint32
+		hasText := false
+		for _, chunk := range chunks {
+			switch chunk.Type {
+			case "fcTL", "fdAT":
+				if got := binary.BigEndian.Uint32(chunk.Data); got != sequence {
+					t.Errorf("%s sequence = %d, want %d", chunk.Type, got, sequence)
+				}
+				sequence++
+			case "tEXt":
+				hasText = true
+			}
+			if chunk.Type == "fdAT" {
+				raw, err := inflateLimited(chunk.Data[4:], 1<<20)
+				if err != nil || !bytes.Equal(raw, testScanlines(2, 2, 0x40)) {
+					t.Errorf("frame data changed: %v", err)
+				}
+			}
+		}
+		if hasText == strip {
+			t.Errorf("tEXt kept = %v with StripMetadata = %v", hasText, strip)
+		}
+
+		// The default image still decodes as a plain PNG
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("png.Decode: %v", err)
+		}
+		if c := color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA); c.R != 0x80 {
+			t.Errorf("default image red = %#x, want 0x80", c.R)
+		}
+	}
+}
+
+func TestRecompressAPNGBomb(t *testing.T) {
+	// Megabytes of zeros deflate to a few kilobytes, far beyond what a 4x4
+	// image or a 2x2 frame can hold
+	bomb := testDeflate(t, make([]byte, 8<<20))
+
+	tests := []struct {
+		name       string
+		idat, fdat []byte
+	}{
+		{"default image", bomb, nil},
+		{"frame", nil, bomb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := recompressAPNG(testAPNG(t, tt.idat, tt.fdat), DefaultOptions())
+			if !errors.Is(err, errInflateLimit) {
+				t.Errorf("err = %v, want errInflateLimit", err)
+			}
+		})
+	}
+}
+
+func TestPNGRawSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		interlaced    bool
+		want          int64
+	}{
+		{"plain", 8, 8, false, 8 * (1 + 32)},
+		{"one pixel", 1, 1, false, 5},
+		{"adam7", 8, 8, true, 271},
+		{"adam7 one pixel", 1, 1, true, 5},
+	}
+	for _, tt := range tests {
+		got, err := pngRawSize(testIHDR(tt.width, tt.height, tt.interlaced), tt.width, tt.height)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: pngRawSize = %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := pngRawSize(testIHDR(0, 4, false), 0, 4); err == nil {
+		t.Error("pngRawSize accepted a zero width")
+	}
+}
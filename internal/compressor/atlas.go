@@ -0,0 +1,385 @@
+package compressor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// AtlasOptions holds the settings for packing a texture atlas
+type AtlasOptions struct {
+	Name       string // Base name of the written files (e.g. "atlas" for atlas.png)
+	OutputDir  string // Output directory, empty means the current directory
+	Padding    int    // Transparent pixels between sprites and around the edges
+	PowerOfTwo bool   // Round the atlas width and height up to powers of two
+	MaxSize    int    // Maximum atlas width and height
+}
+
+// DefaultAtlasOptions returns sensible default atlas options
+func DefaultAtlasOptions() AtlasOptions {
+	return AtlasOptions{
+		Name:       "atlas",
+		OutputDir:  "",
+		Padding:    2,
+		PowerOfTwo: false,
+		MaxSize:    4096,
+	}
+}
+
+// AtlasSprite is the position of one source image inside the atlas
+type AtlasSprite struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// AtlasResult contains the files written for a texture atlas
+type AtlasResult struct {
+	Image    *CompressionResult // The packed PNG; InputSize is the sum of all sources
+	JSONPath string
+	CSSPath  string
+	Sprites  []AtlasSprite
+}
+
+// atlasMap is the JSON coordinate map
+type atlasMap struct {
+	Image   string        `json:"image"`
+	Width   int           `json:"width"`
+	Height  int           `json:"height"`
+	Sprites []AtlasSprite `json:"sprites"`
+}
+
+var cssClassUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// PackAtlas bin-packs the images at inputPaths into one PNG and writes JSON and
+// CSS coordinate maps next to it. options.IfExists applies to the PNG; the
+// maps follow it when it is renamed and are not written when it is skipped.
+func PackAtlas(inputPaths []string, atlasOptions AtlasOptions, options CompressionOptions) (*AtlasResult, error) {
+	if len(inputPaths) == 0 {
+		return nil, errors.New("no images to pack")
+	}
+	if atlasOptions.Name == "" {
+		atlasOptions.Name = "atlas"
+	}
+	if atlasOptions.MaxSize <= 0 {
+		atlasOptions.MaxSize = DefaultAtlasOptions().MaxSize
+	}
+
+	// Load every sprite
+	images := make([]image.Image, len(inputPaths))
+	sprites := make([]AtlasSprite, len(inputPaths))
+	names := spriteNames(inputPaths)
+	var inputSize int64
+	for i, path := range inputPaths {
+		if format, err := GetImageFormat(path); err == nil && format == FormatSVG {
+			return nil, fmt.Errorf("%s: rasterizing SVG sprites is not supported", path)
+		}
+		if err := CheckLimits(path, options.Limits); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		img, err := imaging.Open(path, imaging.AutoOrientation(true))
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to open image: %w", path, err)
+		}
+		if stat, err := os.Stat(path); err == nil {
+			inputSize += stat.Size()
+		}
+
+		images[i] = img
+		sprites[i] = AtlasSprite{
+			Name:   names[i],
+			Source: path,
+			Width:  img.Bounds().Dx(),
+			Height: img.Bounds().Dy(),
+		}
+	}
+
+	width, height, err := packSprites(sprites, atlasOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Draw the atlas
+	atlas := imaging.New(width, height, image.Transparent.C)
+	for i, sprite := range sprites {
+		atlas = imaging.Paste(atlas, images[i], image.Pt(sprite.X, sprite.Y))
+	}
+
+	data, err := NewPNGCompressor().Encode(atlas, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode atlas: %w", err)
+	}
+
+	outputDir := atlasOptions.OutputDir
+	// The atlas goes through the same existing output handling, backups,
+	// tags and journal as compressed images, attributed to the first source
+	options.InPlace = false
+	imageResult := &CompressionResult{
+		InputPath: strings.Join(inputPaths, ", "),
+		InputSize: inputSize,
+		Width:     width,
+		Height:    height,
+		Format:    FormatPNG,
+	}
+	if err := writeOutputTo(inputPaths[0], filepath.Join(outputDir, atlasOptions.Name+".png"), data, FormatPNG, options, imageResult); err != nil {
+		return nil, err
+	}
+	imageResult.Reduction = CalculateReduction(imageResult.InputSize, imageResult.OutputSize)
+	imageResult.Success = true
+
+	// The maps are named after the image, renamed or not, and left alone
+	// with it when it is skipped
+	imageName := filepath.Base(imageResult.OutputPath)
+	base := strings.TrimSuffix(imageResult.OutputPath, ".png")
+	result := &AtlasResult{
+		Image:    imageResult,
+		JSONPath: base + ".json",
+		CSSPath:  base + ".css",
+		Sprites:  sprites,
+	}
+	if imageResult.Skipped {
+		return result, nil
+	}
+	options.IfExists = ExistingOverwrite
+
+	// JSON coordinate map
+	mapData, err := json.MarshalIndent(atlasMap{
+		Image:   imageName,
+		Width:   width,
+		Height:  height,
+		Sprites: sprites,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode atlas map: %w", err)
+	}
+	if err := writeOutputTo(inputPaths[0], result.JSONPath, append(mapData, '\n'), "", options, &CompressionResult{}); err != nil {
+		return nil, err
+	}
+
+	// CSS coordinate map
+	var css strings.Builder
+	class := cssClassUnsafe.ReplaceAllString(atlasOptions.Name, "-")
+	fmt.Fprintf(&css, ".%s {\n  display: inline-block;\n  background-image: url(%q);\n  background-repeat: no-repeat;\n}\n", class, imageName)
+	for _, sprite := range sprites {
+		fmt.Fprintf(&css, ".%s-%s {\n  width: %dpx;\n  height: %dpx;\n  background-position: %s %s;\n}\n",
+			class, cssClassUnsafe.ReplaceAllString(sprite.Name, "-"),
+			sprite.Width, sprite.Height, cssOffset(sprite.X), cssOffset(sprite.Y))
+	}
+	if err := writeOutputTo(inputPaths[0], result.CSSPath, []byte(css.String()), "", options, &CompressionResult{}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func cssOffset(v int) string {
+	if v == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("-%dpx", v)
+}
+
+// spriteNames names each sprite after its file. Files sharing a name are
+// numbered name-2, name-3, ... skipping numbers another file is named with.
+func spriteNames(paths []string) []string {
+	names := make([]string, len(paths))
+	used := make(map[string]bool)
+	for i, path := range paths {
+		names[i] = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	for _, name := range names {
+		used[name] = true
+	}
+
+	seen := make(map[string]bool)
+	for i, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			continue
+		}
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s-%d", name, n)
+			if !used[candidate] {
+				names[i] = candidate
+				used[candidate] = true
+				break
+			}
+		}
+	}
+	return names
+}
+
+// packSprites assigns a position to every sprite and returns the atlas size.
+// Several bin widths are tried and the arrangement with the smallest area wins.
+func packSprites(sprites []AtlasSprite, options AtlasOptions) (int, int, error) {
+	padding := options.Padding
+	if padding < 0 {
+		padding = 0
+	}
+
+	// Pack in order of decreasing longest side
+	order := make([]int, len(sprites))
+	var area, widest int
+	for i, s := range sprites {
+		order[i] = i
+		area += (s.Width + padding) * (s.Height + padding)
+		if s.Width+2*padding > widest {
+			widest = s.Width + 2*padding
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		sa, sb := sprites[order[a]], sprites[order[b]]
+		return max(sa.Width, sa.Height) > max(sb.Width, sb.Height)
+	})
+
+	// Candidate widths between the widest sprite and the maximum size
+	var widths []int
+	if options.PowerOfTwo {
+		for w := nextPowerOfTwo(widest); w <= options.MaxSize; w *= 2 {
+			widths = append(widths, w)
+		}
+	} else {
+		base := int(math.Sqrt(float64(area)))
+		for _, factor := range []float64{0.5, 0.75, 1, 1.25, 1.5, 2, 3} {
+			w := max(widest, int(float64(base)*factor)+padding)
+			if w <= options.MaxSize {
+				widths = append(widths, w)
+			}
+		}
+		if len(widths) == 0 && widest <= options.MaxSize {
+			widths = append(widths, widest)
+		}
+	}
+
+	bestArea := -1
+	var bestWidth, bestHeight int
+	var bestPositions []image.Point
+	for _, w := range widths {
+		positions, usedHeight, ok := maxRectsPack(sprites, order, w, options.MaxSize, padding)
+		if !ok {
+			continue
+		}
+		width, height := w, usedHeight
+		if options.PowerOfTwo {
+			height = nextPowerOfTwo(height)
+		} else {
+			// Trim unused columns
+			width = 0
+			for i, p := range positions {
+				width = max(width, p.X+sprites[i].Width+padding)
+			}
+		}
+		if height > options.MaxSize {
+			continue
+		}
+		if bestArea < 0 || width*height < bestArea {
+			bestArea = width * height
+			bestWidth, bestHeight = width, height
+			bestPositions = positions
+		}
+	}
+
+	if bestArea < 0 {
+		return 0, 0, fmt.Errorf("sprites do not fit in a %dx%d atlas", options.MaxSize, options.MaxSize)
+	}
+
+	for i, p := range bestPositions {
+		sprites[i].X = p.X
+		sprites[i].Y = p.Y
+	}
+	return bestWidth, bestHeight, nil
+}
+
+// maxRectsPack places sprites into a width x height bin using the MaxRects
+// best-short-side-fit heuristic. It returns the sprite positions and the
+// height actually used.
+func maxRectsPack(sprites []AtlasSprite, order []int, width, height, padding int) ([]image.Point, int, bool) {
+	// Each sprite reserves padding to its right and bottom; the bin is inset
+	// by padding so the top and left edges get it too
+	free := []image.Rectangle{image.Rect(padding, padding, width, height)}
+	positions := make([]image.Point, len(sprites))
+	usedHeight := 0
+
+	for _, i := range order {
+		w := sprites[i].Width + padding
+		h := sprites[i].Height + padding
+
+		best := -1
+		bestShort, bestLong := math.MaxInt, math.MaxInt
+		for j, r := range free {
+			if w > r.Dx() || h > r.Dy() {
+				continue
+			}
+			short := min(r.Dx()-w, r.Dy()-h)
+			long := max(r.Dx()-w, r.Dy()-h)
+			if short < bestShort || (short == bestShort && long < bestLong) {
+				best, bestShort, bestLong = j, short, long
+			}
+		}
+		if best < 0 {
+			return nil, 0, false
+		}
+
+		placed := image.Rect(free[best].Min.X, free[best].Min.Y, free[best].Min.X+w, free[best].Min.Y+h)
+		positions[i] = placed.Min
+		usedHeight = max(usedHeight, placed.Max.Y)
+
+		// Split every free rectangle that overlaps the placed sprite
+		var next []image.Rectangle
+		for _, r := range free {
+			if !r.Overlaps(placed) {
+				next = append(next, r)
+				continue
+			}
+			if placed.Min.X > r.Min.X {
+				next = append(next, image.Rect(r.Min.X, r.Min.Y, placed.Min.X, r.Max.Y))
+			}
+			if placed.Max.X < r.Max.X {
+				next = append(next, image.Rect(placed.Max.X, r.Min.Y, r.Max.X, r.Max.Y))
+			}
+			if placed.Min.Y > r.Min.Y {
+				next = append(next, image.Rect(r.Min.X, r.Min.Y, r.Max.X, placed.Min.Y))
+			}
+			if placed.Max.Y < r.Max.Y {
+				next = append(next, image.Rect(r.Min.X, placed.Max.Y, r.Max.X, r.Max.Y))
+			}
+		}
+
+		// Drop free rectangles contained in another
+		free = free[:0]
+		for a, r := range next {
+			contained := false
+			for b, other := range next {
+				if a != b && r.In(other) && (r != other || a > b) {
+					contained = true
+					break
+				}
+			}
+			if !contained {
+				free = append(free, r)
+			}
+		}
+	}
+
+	return positions, usedHeight, true
+}
+
+func nextPowerOfTwo(v int) int {
+	p := 1
+	for p < v {
+		p *= 2
+	}
+	return p
+}
@@ -0,0 +1,133 @@
+package compressor
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestSpriteNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{"distinct", []string{"a.png", "b.png"}, []string{"a", "b"}},
+		{"same name", []string{"x/a.png", "y/a.png", "z/a.jpg"}, []string{"a", "a-2", "a-3"}},
+		{"numbered file after", []string{"x/a.png", "y/a.png", "a-2.png"}, []string{"a", "a-3", "a-2"}},
+		{"numbered file before", []string{"a-2.png", "x/a.png", "y/a.png"}, []string{"a-2", "a", "a-3"}},
+		{"numbered file twice", []string{"x/a-2.png", "y/a-2.png", "a-2-2.png"}, []string{"a-2", "a-2-3", "a-2-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, path := range tt.paths {
+				paths = append(paths, filepath.FromSlash(path))
+			}
+			if got := spriteNames(paths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("spriteNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackSprites(t *testing.T) {
+	tests := []struct {
+		name      string
+		sizes     []image.Point
+		options   AtlasOptions
+		wantError bool
+	}{
+		{"one sprite", []image.Point{{16, 16}}, AtlasOptions{MaxSize: 64}, false},
+		{"mixed sizes", []image.Point{{32, 8}, {8, 32}, {16, 16}, {4, 4}, {20, 10}}, AtlasOptions{Padding: 2, MaxSize: 256}, false},
+		{"power of two", []image.Point{{30, 30}, {10, 40}, {5, 5}}, AtlasOptions{Padding: 1, PowerOfTwo: true, MaxSize: 256}, false},
+		{"many equal sprites", equalSizes(40, 10, 10), AtlasOptions{Padding: 1, MaxSize: 128}, false},
+		{"too large", []image.Point{{100, 100}}, AtlasOptions{MaxSize: 64}, true},
+		{"too many", equalSizes(20, 30, 30), AtlasOptions{MaxSize: 64}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sprites := make([]AtlasSprite, len(tt.sizes))
+			for i, size := range tt.sizes {
+				sprites[i] = AtlasSprite{Width: size.X, Height: size.Y}
+			}
+
+			width, height, err := packSprites(sprites, tt.options)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("packSprites() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			if width > tt.options.MaxSize || height > tt.options.MaxSize {
+				t.Errorf("atlas is %dx%d, larger than %d", width, height, tt.options.MaxSize)
+			}
+			if tt.options.PowerOfTwo && (width != nextPowerOfTwo(width) || height != nextPowerOfTwo(height)) {
+				t.Errorf("atlas is %dx%d, not powers of two", width, height)
+			}
+
+			padding := tt.options.Padding
+			bounds := image.Rect(padding, padding, width-padding, height-padding)
+			for i, a := range sprites {
+				ra := image.Rect(a.X, a.Y, a.X+a.Width, a.Y+a.Height)
+				if !ra.In(bounds) {
+					t.Errorf("sprite %d at %v leaves the padded atlas %v", i, ra, bounds)
+				}
+				for j := i + 1; j < len(sprites); j++ {
+					b := sprites[j]
+					rb := image.Rect(b.X, b.Y, b.X+b.Width, b.Y+b.Height)
+					if ra.Inset(-padding).Overlaps(rb) {
+						t.Errorf("sprites %d %v and %d %v are closer than %d pixels", i, ra, j, rb, padding)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPackAtlas(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for i, size := range []image.Point{{8, 8}, {16, 4}, {4, 12}} {
+		path := filepath.Join(dir, "icons", "icon"+strconv.Itoa(i)+".png")
+		writeTestPNG(t, path, size.X, size.Y)
+		inputs = append(inputs, path)
+	}
+
+	atlasOptions := DefaultAtlasOptions()
+	atlasOptions.OutputDir = filepath.Join(dir, "out")
+	result, err := PackAtlas(inputs, atlasOptions, DefaultOptions())
+	if err != nil {
+		t.Fatalf("PackAtlas() error = %v", err)
+	}
+	if len(result.Sprites) != len(inputs) {
+		t.Errorf("got %d sprites, want %d", len(result.Sprites), len(inputs))
+	}
+	for _, path := range []string{result.Image.OutputPath, result.JSONPath, result.CSSPath} {
+		if filepath.Dir(path) != atlasOptions.OutputDir {
+			t.Errorf("%s written outside %s", path, atlasOptions.OutputDir)
+		}
+	}
+	width, height, err := ImageDimensions(result.Image.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sprite := range result.Sprites {
+		if sprite.X+sprite.Width > width || sprite.Y+sprite.Height > height {
+			t.Errorf("sprite %s lies outside the %dx%d atlas", sprite.Name, width, height)
+		}
+	}
+}
+
+// equalSizes returns count sprite sizes of width x height
+func equalSizes(count, width, height int) []image.Point {
+	sizes := make([]image.Point, count)
+	for i := range sizes {
+		sizes[i] = image.Pt(width, height)
+	}
+	return sizes
+}
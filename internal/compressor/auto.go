@@ -0,0 +1,210 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// FormatCandidate describes one encoding tried by automatic format selection
+type FormatCandidate struct {
+	Format   ImageFormat `json:"format"`
+	Variant  string      `json:"variant"` // "truecolor", "palette" or "lossy"
+	Size     int64       `json:"size"`    // Encoded size in bytes, 0 when the candidate was never encoded
+	PSNR     float64     `json:"-"`       // Quality against the source in dB, +Inf for lossless encodings
+	Eligible bool        `json:"eligible"`
+	Selected bool        `json:"selected"`
+	Reason   string      `json:"reason,omitempty"` // Why the candidate was not eligible
+}
+
+// MarshalJSON encodes the candidate with PSNR as null for lossless and skipped
+// candidates, since JSON has no infinity
+func (c FormatCandidate) MarshalJSON() ([]byte, error) {
+	type plain FormatCandidate
+	var value *float64
+	if c.Size > 0 && !math.IsInf(c.PSNR, 0) && !math.IsNaN(c.PSNR) {
+		value = &c.PSNR
+	}
+	return json.Marshal(struct {
+		plain
+		PSNR *float64 `json:"psnr"`
+	}{plain(c), value})
+}
+
+// Name returns a short label such as "png-palette" for reports
+func (c FormatCandidate) Name() string {
+	if c.Variant == "" || c.Variant == "truecolor" || c.Variant == "lossy" {
+		return string(c.Format)
+	}
+	return string(c.Format) + "-" + c.Variant
+}
+
+// formatSelection is the outcome of automatic format selection
+type formatSelection struct {
+	format     ImageFormat
+	data       []byte
+	candidates []FormatCandidate
+}
+
+// selectFormat encodes img as every eligible candidate and keeps the smallest
+// one that meets the quality threshold in options
+func selectFormat(img image.Image, options CompressionOptions) (*formatSelection, error) {
+	src := imaging.Clone(img)
+
+	var candidates []FormatCandidate
+	var encoded [][]byte
+
+	try := func(candidate FormatCandidate, encodeFn func() ([]byte, error)) error {
+		if candidate.Reason == "" {
+			data, err := encodeFn()
+			if err != nil {
+				return fmt.Errorf("failed to encode %s candidate: %w", candidate.Name(), err)
+			}
+			candidate.Size = int64(len(data))
+			candidate.Eligible = true
+			encoded = append(encoded, data)
+		} else {
+			encoded = append(encoded, nil)
+		}
+		candidates = append(candidates, candidate)
+		return nil
+	}
+
+	// Lossless truecolor PNG is always a candidate
+	err := try(FormatCandidate{Format: FormatPNG, Variant: "truecolor", PSNR: math.Inf(1)}, func() ([]byte, error) {
+		return encodeBytes(src, FormatPNG, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Palette PNG is lossless for flat graphics with few colors
+	paletted := toPaletted(src)
+	palette := FormatCandidate{Format: FormatPNG, Variant: "palette", PSNR: math.Inf(1)}
+	if paletted == nil {
+		palette.Reason = "more than 256 colors"
+	}
+	err = try(palette, func() ([]byte, error) {
+		return encodeBytes(paletted, FormatPNG, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// JPEG only when the alpha channel carries no information
+	lossy := FormatCandidate{Format: FormatJPEG, Variant: "lossy"}
+	if hasAlpha(src) {
+		lossy.Reason = "image uses transparency"
+	}
+	err = try(lossy, func() ([]byte, error) {
+		return encodeBytes(src, FormatJPEG, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Measure the lossy candidate against the source
+	last := &candidates[len(candidates)-1]
+	if last.Eligible {
+		decoded, err := imaging.Decode(bytes.NewReader(encoded[len(encoded)-1]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode jpeg candidate: %w", err)
+		}
+		last.PSNR = psnr(src, imaging.Clone(decoded))
+		if last.PSNR < options.AutoMinPSNR {
+			last.Eligible = false
+			last.Reason = fmt.Sprintf("PSNR %.1f dB below %.1f dB", last.PSNR, options.AutoMinPSNR)
+		}
+	}
+
+	best := -1
+	for i, candidate := range candidates {
+		if candidate.Eligible && (best < 0 || candidate.Size < candidates[best].Size) {
+			best = i
+		}
+	}
+	candidates[best].Selected = true
+
+	return &formatSelection{
+		format:     candidates[best].Format,
+		data:       encoded[best],
+		candidates: candidates,
+	}, nil
+}
+
+// encodeBytes encodes img in format and returns the encoded bytes
+func encodeBytes(img image.Image, format ImageFormat, options CompressionOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeImage(&buf, img, format, options); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toPaletted converts img to a paletted image without loss, or returns nil if
+// it has more than 256 distinct colors
+func toPaletted(img *image.NRGBA) *image.Paletted {
+	index := make(map[color.NRGBA]uint8)
+	var palette color.Palette
+
+	bounds := img.Bounds()
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.NRGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: img.Pix[i+3]}
+		if c.A == 0 {
+			c = color.NRGBA{}
+		}
+		if _, ok := index[c]; ok {
+			continue
+		}
+		if len(palette) == 256 {
+			return nil
+		}
+		index[c] = uint8(len(palette))
+		palette = append(palette, c)
+	}
+
+	paletted := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A == 0 {
+				c = color.NRGBA{}
+			}
+			paletted.SetColorIndex(x, y, index[c])
+		}
+	}
+	return paletted
+}
+
+// psnr returns the peak signal-to-noise ratio between two images of equal size
+// over their RGB channels, or +Inf if they are identical
+func psnr(a, b *image.NRGBA) float64 {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return 0
+	}
+
+	var sum float64
+	var n int
+	for y := 0; y < a.Bounds().Dy(); y++ {
+		rowA := a.Pix[y*a.Stride : y*a.Stride+a.Bounds().Dx()*4]
+		rowB := b.Pix[y*b.Stride : y*b.Stride+b.Bounds().Dx()*4]
+		for i := 0; i < len(rowA); i += 4 {
+			for c := 0; c < 3; c++ {
+				d := float64(rowA[i+c]) - float64(rowB[i+c])
+				sum += d * d
+			}
+			n += 3
+		}
+	}
+
+	if n == 0 || sum == 0 {
+		return math.Inf(1)
+	}
+	mse := sum / float64(n)
+	return 10 * math.Log10(255*255/mse)
+}
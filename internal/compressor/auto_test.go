@@ -0,0 +1,140 @@
+package compressor
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// testPhoto returns an opaque image with smooth gradients and mild noise,
+// which JPEG encodes much smaller than PNG
+func testPhoto(alpha uint8) *image.NRGBA {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			noise := uint8(rng.IntN(4))
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x) + noise, uint8(y) + noise, uint8((x+y)/2) + noise, alpha})
+		}
+	}
+	return img
+}
+
+func TestSelectFormat(t *testing.T) {
+	flat := imaging.New(64, 64, color.NRGBA{200, 40, 40, 255})
+	for x := 0; x < 32; x++ {
+		flat.SetNRGBA(x, x, color.NRGBA{0, 0, 255, 255})
+	}
+
+	tests := []struct {
+		name       string
+		img        image.Image
+		minPSNR    float64
+		want       string            // Name of the selected candidate
+		wantReason map[string]string // Expected reasons by candidate name
+	}{
+		{"flat graphic", flat, 38, "png-palette", nil},
+		{"photo", testPhoto(255), 38, "jpeg", map[string]string{"png-palette": "more than 256 colors"}},
+		{"transparent photo", testPhoto(128), 38, "png", map[string]string{"jpeg": "image uses transparency"}},
+		{"quality threshold", testPhoto(255), 99, "png", map[string]string{"jpeg": "PSNR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.AutoMinPSNR = tt.minPSNR
+			selection, err := selectFormat(tt.img, options)
+			if err != nil {
+				t.Fatalf("selectFormat() error = %v", err)
+			}
+
+			var selected []string
+			for _, candidate := range selection.candidates {
+				if candidate.Selected {
+					selected = append(selected, candidate.Name())
+					if int64(len(selection.data)) != candidate.Size || selection.format != candidate.Format {
+						t.Errorf("selection does not hold the %s candidate", candidate.Name())
+					}
+				}
+				if want, ok := tt.wantReason[candidate.Name()]; ok && (candidate.Eligible || !strings.Contains(candidate.Reason, want)) {
+					t.Errorf("%s: eligible %v, reason %q, want %q", candidate.Name(), candidate.Eligible, candidate.Reason, want)
+				}
+			}
+			if len(selected) != 1 || selected[0] != tt.want {
+				t.Errorf("selected %v, want %s: %+v", selected, tt.want, selection.candidates)
+			}
+		})
+	}
+}
+
+func TestToPaletted(t *testing.T) {
+	few := imaging.New(4, 4, color.NRGBA{1, 2, 3, 255})
+	few.SetNRGBA(0, 0, color.NRGBA{9, 9, 9, 0})
+	few.SetNRGBA(1, 0, color.NRGBA{8, 8, 8, 0})
+
+	paletted := toPaletted(few)
+	if paletted == nil {
+		t.Fatal("toPaletted() = nil for two colors")
+	}
+	if len(paletted.Palette) != 2 {
+		t.Errorf("palette has %d colors, want 2 with transparent pixels merged", len(paletted.Palette))
+	}
+	if got := color.NRGBAModel.Convert(paletted.At(2, 2)); got != few.At(2, 2) {
+		t.Errorf("opaque pixel = %v, want %v", got, few.At(2, 2))
+	}
+	if got := color.NRGBAModel.Convert(paletted.At(1, 0)); got != (color.NRGBA{}) {
+		t.Errorf("transparent pixel = %v, want transparent black", got)
+	}
+
+	if toPaletted(testPhoto(255)) != nil {
+		t.Error("toPaletted() accepted more than 256 colors")
+	}
+}
+
+func TestPSNR(t *testing.T) {
+	a := imaging.New(8, 8, color.NRGBA{100, 100, 100, 255})
+	b := imaging.New(8, 8, color.NRGBA{110, 100, 100, 255})
+
+	if got := psnr(a, a); !math.IsInf(got, 1) {
+		t.Errorf("psnr(a, a) = %v, want +Inf", got)
+	}
+	// One of three channels is off by 10 everywhere: MSE = 100/3
+	if got, want := psnr(a, b), 10*math.Log10(255*255/(100.0/3)); math.Abs(got-want) > 1e-9 {
+		t.Errorf("psnr(a, b) = %v, want %v", got, want)
+	}
+	if got := psnr(a, imaging.New(4, 4, color.White)); got != 0 {
+		t.Errorf("psnr() of different sizes = %v, want 0", got)
+	}
+}
+
+func TestFormatCandidateJSON(t *testing.T) {
+	tests := []struct {
+		candidate FormatCandidate
+		want      string
+	}{
+		{FormatCandidate{Format: FormatPNG, Size: 10, PSNR: math.Inf(1)}, `null`},
+		{FormatCandidate{Format: FormatJPEG, Size: 10, PSNR: 41.5}, `41.5`},
+		{FormatCandidate{Format: FormatJPEG, PSNR: 0, Reason: "image uses transparency"}, `null`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.candidate)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		var decoded map[string]any
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(decoded["psnr"])
+		if string(got) != tt.want {
+			t.Errorf("psnr = %s, want %s in %s", got, tt.want, data)
+		}
+	}
+}
@@ -1,21 +1,74 @@
 package compressor
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"image"
 	"os"
 	"path/filepath"
 	"strings"
+
+	// Register the QOI decoder for image.Decode and image.DecodeConfig
+	_ "github.com/virakt/imgshrink/internal/qoi"
 )
 
+// Version is the imgshrink release, recorded in the tags left on outputs
+const Version = "1.0.0"
+
 // ImageFormat represents supported image formats
 type ImageFormat string
 
 const (
 	FormatJPEG ImageFormat = "jpeg"
 	FormatPNG  ImageFormat = "png"
+	FormatTIFF ImageFormat = "tiff"
+	FormatBMP  ImageFormat = "bmp"
+	FormatQOI  ImageFormat = "qoi"
+	FormatSVG  ImageFormat = "svg"
+
+	// FormatAuto is only valid as an output format: every eligible format is
+	// encoded and the smallest acceptable result is kept
+	FormatAuto ImageFormat = "auto"
 )
 
+// Extension returns the canonical file extension for the format
+func (f ImageFormat) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatTIFF:
+		return ".tif"
+	default:
+		return "." + string(f)
+	}
+}
+
+// ParseOutputFormat parses an output format name as given on the command line
+func ParseOutputFormat(name string) (ImageFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "same", "original":
+		return "", nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "png":
+		return FormatPNG, nil
+	case "tif", "tiff":
+		return FormatTIFF, nil
+	case "bmp":
+		return FormatBMP, nil
+	case "qoi":
+		return FormatQOI, nil
+	case "svg":
+		return FormatSVG, nil
+	case "auto":
+		return FormatAuto, nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", name)
+	}
+}
+
 // CompressionOptions holds all compression settings
 type CompressionOptions struct {
 	// Common options
@@ -27,9 +80,60 @@ type CompressionOptions struct {
 	OutputDir     string  // Output directory, empty means same as input
 	OutputSuffix  string  // Suffix to add to filename (e.g., "_compressed")
 
+	// Output naming
+	OutputTemplate string // Output path template such as "{dir}/{name}.{w}x{h}.{ext}", overrides OutputSuffix
+	SourceRoot     string // Directory {rel} and mirrored outputs are relative to, empty means the working directory
+	MirrorTree     bool   // Reproduce each input's directory relative to SourceRoot under OutputDir
+
+	// Handling of outputs that already exist
+	IfExists ExistingPolicy
+
+	// Copy the source's permissions, access and modification times and user
+	// xattrs to every output
+	PreserveAttributes bool
+
+	// Mark written files as processed so later runs with the same options
+	// leave them alone
+	TagOutputs bool
+
+	// Sidecar tags read so far in a batch, nil reads them for every file
+	Tags *TagCache `json:"-"`
+
+	// In-place replacement
+	InPlace   bool   // Replace the input when the encode is smaller, ignoring OutputDir and OutputSuffix
+	BackupDir string // Keep replaced originals and overwritten outputs here, mirroring their paths; journaled runs default to Journal.BackupDir
+
+	// Undo journal, nil disables journaling
+	Journal *Journal `json:"-"`
+
+	// Manifest of earlier runs, nil disables incremental runs
+	Manifest *Manifest `json:"-"`
+	Force    bool      // Redo inputs the manifest reports as unchanged and tagged inputs
+
+	// Resource limits checked before decoding
+	Limits Limits
+
+	// Batch scheduling
+	Workers      int   // Concurrent jobs, 0 means GOMAXPROCS
+	MemoryBudget int64 // Bytes of estimated decoded image data in flight, 0 means unlimited
+	LargestFirst bool  // Start the largest jobs first
+
+	// Output format
+	OutputFormat ImageFormat // Empty keeps the input format (TIFF/BMP default to FormatAuto)
+	AutoMinPSNR  float64     // Minimum PSNR (dB) a lossy candidate needs in auto mode
+	AllPages     bool        // Write every page of multi-page inputs as separate outputs
+
+	// Placeholders
+	Placeholder     bool // Compute a BlurHash, dominant color and tiny preview per result
+	PlaceholderSize int  // Longest side of the inline preview in pixels
+
+	// SVG specific
+	SVGPrecision int // Decimal places kept in coordinates and lengths
+
 	// JPEG specific
-	Progressive     bool   // Progressive JPEG encoding
-	ChromaSubsample string // "4:4:4", "4:2:2", "4:2:0"
+	Progressive     bool                // Progressive JPEG encoding
+	ChromaSubsample string              // "4:4:4", "4:2:2", "4:2:0"
+	SourceQuality   SourceQualityPolicy // Handling of sources saved at or below Quality
 
 	// PNG specific
 	CompressionLevel int  // 0-9, higher = more compression
@@ -39,41 +143,94 @@ type CompressionOptions struct {
 // DefaultOptions returns sensible default compression options
 func DefaultOptions() CompressionOptions {
 	return CompressionOptions{
-		Quality:          85,
-		ResizePercent:    0,
-		ResizeWidth:      0,
-		ResizeHeight:     0,
-		StripMetadata:    true,
-		OutputDir:        "",
-		OutputSuffix:     "_compressed",
-		Progressive:      true,
-		ChromaSubsample:  "4:2:0",
-		CompressionLevel: 6,
-		Interlaced:       false,
+		Quality:            85,
+		ResizePercent:      0,
+		ResizeWidth:        0,
+		ResizeHeight:       0,
+		StripMetadata:      true,
+		OutputDir:          "",
+		OutputSuffix:       "_compressed",
+		OutputTemplate:     "",
+		SourceRoot:         "",
+		MirrorTree:         false,
+		IfExists:           ExistingOverwrite,
+		PreserveAttributes: false,
+		TagOutputs:         false,
+		InPlace:            false,
+		BackupDir:          "",
+		Limits:             DefaultLimits(),
+		Workers:            0,
+		MemoryBudget:       2 << 30,
+		LargestFirst:       false,
+		OutputFormat:       "",
+		AutoMinPSNR:        38,
+		AllPages:           false,
+		Placeholder:        false,
+		PlaceholderSize:    16,
+		SVGPrecision:       3,
+		Progressive:        true,
+		ChromaSubsample:    "4:2:0",
+		SourceQuality:      SourceQualityIgnore,
+		CompressionLevel:   6,
+		Interlaced:         false,
 	}
 }
 
 // ImageInfo contains information about an image
 type ImageInfo struct {
-	Path      string
-	Format    ImageFormat
-	Width     int
-	Height    int
-	Size      int64
-	ColorMode string
+	Path              string      `json:"path"`
+	Format            ImageFormat `json:"format"`
+	Width             int         `json:"width"`
+	Height            int         `json:"height"`
+	Size              int64       `json:"size"`
+	ColorMode         string      `json:"colorMode"`                   // "Gray", "GrayA", "RGB", "RGBA", "Indexed", "YCbCr", "CMYK" or "vector"
+	BitDepth          int         `json:"bitDepth,omitempty"`          // Bits per channel, or per pixel for indexed images
+	HasAlpha          bool        `json:"hasAlpha"`                    // The image stores transparency
+	AlphaUsed         bool        `json:"alphaUsed"`                   // At least one pixel is not fully opaque
+	AlphaChecked      bool        `json:"alphaChecked"`                // The image was decoded to set AlphaUsed
+	Progressive       bool        `json:"progressive"`                 // Progressive JPEG or interlaced PNG
+	ChromaSubsampling string      `json:"chromaSubsampling,omitempty"` // JPEG only, e.g. "4:2:0"
+	Quality           int         `json:"quality,omitempty"`           // JPEG only, estimated from the quantization tables
+	DPIX              float64     `json:"dpiX,omitempty"`
+	DPIY              float64     `json:"dpiY,omitempty"`
+	ICCProfile        string      `json:"iccProfile,omitempty"` // Description of the embedded color profile
+	EXIF              *EXIFInfo   `json:"exif,omitempty"`
+	Chunks            []string    `json:"chunks,omitempty"` // PNG chunk types in file order
+	Frames            int         `json:"frames"`           // Number of pages or animation frames
 }
 
 // CompressionResult contains the result of a compression operation
 type CompressionResult struct {
-	InputPath  string
-	OutputPath string
-	InputSize  int64
-	OutputSize int64
-	Reduction  float64 // Percentage reduction
-	Width      int
-	Height     int
-	Success    bool
-	Error      error
+	InputPath   string               `json:"inputPath"`
+	OutputPath  string               `json:"outputPath,omitempty"`
+	InputSize   int64                `json:"inputSize"`
+	OutputSize  int64                `json:"outputSize"`
+	Reduction   float64              `json:"reduction"` // Percentage reduction
+	Width       int                  `json:"width"`
+	Height      int                  `json:"height"`
+	Format      ImageFormat          `json:"format,omitempty"`      // Format the output was written in
+	Candidates  []FormatCandidate    `json:"candidates,omitempty"`  // Formats tried when OutputFormat is FormatAuto
+	Pages       []*CompressionResult `json:"pages,omitempty"`       // Per-page results when AllPages splits a multi-page input
+	Placeholder *Placeholder         `json:"placeholder,omitempty"` // Set when options.Placeholder is enabled
+	BackupPath  string               `json:"backupPath,omitempty"`  // Copy of the file the output replaced
+	Existing    string               `json:"existing,omitempty"`    // Policy applied because the output already existed
+	Success     bool                 `json:"success"`
+	Skipped     bool                 `json:"skipped,omitempty"`    // Nothing was written; OutputSize equals InputSize
+	SkipReason  string               `json:"skipReason,omitempty"` // Why the input was left alone
+	Error       error                `json:"-"`
+}
+
+// MarshalJSON encodes the result with its error as a message string
+func (r CompressionResult) MarshalJSON() ([]byte, error) {
+	type plain CompressionResult
+	var message string
+	if r.Error != nil {
+		message = r.Error.Error()
+	}
+	return json.Marshal(struct {
+		plain
+		Error string `json:"error,omitempty"`
+	}{plain(r), message})
 }
 
 // Compressor interface defines the compression operations
@@ -91,27 +248,58 @@ func GetImageFormat(path string) (ImageFormat, error) {
 		return FormatJPEG, nil
 	case ".png":
 		return FormatPNG, nil
+	case ".tif", ".tiff":
+		return FormatTIFF, nil
+	case ".bmp":
+		return FormatBMP, nil
+	case ".qoi":
+		return FormatQOI, nil
+	case ".svg":
+		return FormatSVG, nil
 	default:
 		return "", fmt.Errorf("unsupported image format: %s", ext)
 	}
 }
 
-// GetImageInfo returns information about an image file
+// InfoOptions controls the work GetImageInfoWithOptions does beyond reading
+// headers and metadata
+type InfoOptions struct {
+	CheckAlpha bool   // Decode images that store transparency to tell whether they use it
+	Limits     Limits // Files over MaxFileSize are refused unread, images beyond the rest are not decoded for CheckAlpha
+}
+
+// GetImageInfo returns information about an image file from its headers and
+// metadata, without decoding it
 func GetImageInfo(path string) (*ImageInfo, error) {
-	file, err := os.Open(path)
+	return GetImageInfoWithOptions(path, InfoOptions{})
+}
+
+// GetImageInfoWithOptions returns information about an image file, decoding
+// it to set AlphaUsed when options.CheckAlpha is set and it is within
+// options.Limits
+func GetImageInfoWithOptions(path string, options InfoOptions) (*ImageInfo, error) {
+	// Vector images have no raster decoder
+	if format, err := GetImageFormat(path); err == nil && format == FormatSVG {
+		return getSVGInfo(path)
+	}
+
+	// Oversized files are refused before they are loaded into memory
+	stat, err := os.Stat(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
-	defer file.Close()
+	if err := options.Limits.checkFileSize(path, stat.Size()); err != nil {
+		return nil, err
+	}
 
-	// Get file size
-	stat, err := file.Stat()
+	// Headers and metadata are read from memory
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file stats: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 
 	// Decode image config (doesn't load full image)
-	config, format, err := image.DecodeConfig(file)
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image config: %w", err)
 	}
@@ -124,32 +312,140 @@ func GetImageInfo(path string) (*ImageInfo, error) {
 			imgFormat = FormatJPEG
 		case "png":
 			imgFormat = FormatPNG
+		case "tiff":
+			imgFormat = FormatTIFF
+		case "bmp":
+			imgFormat = FormatBMP
+		case "qoi":
+			imgFormat = FormatQOI
 		default:
 			return nil, fmt.Errorf("unsupported format: %s", format)
 		}
 	}
 
-	return &ImageInfo{
-		Path:      path,
-		Format:    imgFormat,
-		Width:     config.Width,
-		Height:    config.Height,
-		Size:      stat.Size(),
-		ColorMode: format,
-	}, nil
+	info := &ImageInfo{
+		Path:   path,
+		Format: imgFormat,
+		Width:  config.Width,
+		Height: config.Height,
+		Size:   int64(len(data)),
+		Frames: 1,
+	}
+
+	switch imgFormat {
+	case FormatTIFF:
+		if offsets, err := tiffPageOffsets(bytes.NewReader(data), int64(len(data))); err == nil {
+			info.Frames = len(offsets)
+		}
+	case FormatPNG:
+		if chunks, err := readPNGChunks(data); err == nil {
+			info.Frames = max(1, apngFrameCount(chunks))
+		}
+	}
+
+	inspectImage(data, info)
+
+	// Only a full decode tells whether transparency is actually used
+	if options.CheckAlpha && info.HasAlpha && withinLimits(options.Limits, info) {
+		if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			info.AlphaUsed = hasAlpha(img)
+			info.AlphaChecked = true
+		}
+	}
+
+	return info, nil
 }
 
-// GenerateOutputPath creates the output path based on options
-func GenerateOutputPath(inputPath string, options CompressionOptions) string {
+// withinLimits reports whether an inspected image may be decoded
+func withinLimits(limits Limits, info *ImageInfo) bool {
+	if limits.MaxFileSize > 0 && info.Size > limits.MaxFileSize {
+		return false
+	}
+	if limits.MaxFrames > 0 && info.Frames > limits.MaxFrames {
+		return false
+	}
+	return limits.checkDimensions(info.Path, info.Width, info.Height) == nil
+}
+
+// ImageDimensions returns the pixel size of an image from its header, or
+// from the root element of an SVG
+func ImageDimensions(path string) (int, int, error) {
+	if format, err := GetImageFormat(path); err == nil && format == FormatSVG {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read input file: %w", err)
+		}
+		width, height := svgDimensions(data)
+		return width, height, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(bufio.NewReader(file))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode image config: %w", err)
+	}
+	return config.Width, config.Height, nil
+}
+
+// ResolveOutputFormat returns the format an input of the given format is written in
+func ResolveOutputFormat(inputFormat ImageFormat, options CompressionOptions) ImageFormat {
+	if options.OutputFormat == "" {
+		// Re-emitting scanner and legacy formats rarely makes sense, unless
+		// the file is replaced in place
+		if !options.InPlace && (inputFormat == FormatTIFF || inputFormat == FormatBMP) {
+			return FormatAuto
+		}
+		return inputFormat
+	}
+	return options.OutputFormat
+}
+
+// GenerateOutputPath creates the output path based on options. Templates
+// using {w}, {h} or {hash} are expanded with the input's dimensions and
+// content, as the output is not encoded yet.
+func GenerateOutputPath(inputPath string, options CompressionOptions) (string, error) {
+	return outputPathForFormat(inputPath, options.OutputFormat, options, nil)
+}
+
+// outputPathForFormat creates the output path for an image written in format,
+// replacing the extension when the image is converted
+func outputPathForFormat(inputPath string, format ImageFormat, options CompressionOptions, output *encodedOutput) (string, error) {
+	if options.InPlace {
+		return inputPath, nil
+	}
+	if options.OutputTemplate != "" {
+		return expandTemplate(inputPath, format, options, output)
+	}
+
 	dir := filepath.Dir(inputPath)
 	if options.OutputDir != "" {
 		dir = options.OutputDir
+		if options.MirrorTree {
+			rel, err := relativePath(options.SourceRoot, inputPath)
+			if err != nil {
+				return "", err
+			}
+			dir = filepath.Join(dir, filepath.Dir(rel))
+		}
 	}
 
-	ext := filepath.Ext(inputPath)
-	base := strings.TrimSuffix(filepath.Base(inputPath), ext)
+	base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	return filepath.Join(dir, base+options.OutputSuffix+outputExtension(inputPath, format)), nil
+}
 
-	return filepath.Join(dir, base+options.OutputSuffix+ext)
+// outputExtension keeps the input's extension unless the image is converted
+func outputExtension(inputPath string, format ImageFormat) string {
+	if format != "" && format != FormatAuto {
+		if current, err := GetImageFormat(inputPath); err != nil || current != format {
+			return format.Extension()
+		}
+	}
+	return filepath.Ext(inputPath)
 }
 
 // FormatBytes formats bytes into human-readable string
@@ -0,0 +1,52 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LoadOptions reads compression options from a JSON config file. Fields use
+// the CompressionOptions names, e.g. {"Quality": 80, "OutputTemplate":
+// "dist/{hash:8}.{ext}"}; fields left out keep their defaults, and unknown
+// fields are an error so a misspelled one is not silently ignored.
+func LoadOptions(path string) (CompressionOptions, error) {
+	options := DefaultOptions()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return options, fmt.Errorf("failed to read config: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&options); err != nil {
+		return options, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return options, fmt.Errorf("failed to parse config %s: data after the options", path)
+	}
+
+	// Names are checked and normalized like the command line flags
+	if options.OutputFormat, err = ParseOutputFormat(string(options.OutputFormat)); err != nil {
+		return options, fmt.Errorf("config %s: %w", path, err)
+	}
+	if options.SourceQuality, err = ParseSourceQuality(string(options.SourceQuality)); err != nil {
+		return options, fmt.Errorf("config %s: %w", path, err)
+	}
+	if options.IfExists != ExistingOverwrite {
+		policy, err := ParseExistingPolicy(string(options.IfExists))
+		if err != nil {
+			return options, fmt.Errorf("config %s: %w", path, err)
+		}
+		options.IfExists = policy
+	}
+	if options.OutputTemplate != "" {
+		if err := ValidateTemplate(options.OutputTemplate); err != nil {
+			return options, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,46 @@
+package compressor
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		check     func(options CompressionOptions) bool
+		wantError bool
+	}{
+		{"defaults", `{}`, func(o CompressionOptions) bool { return o.Quality == DefaultOptions().Quality }, false},
+		{"quality", `{"Quality": 70}`, func(o CompressionOptions) bool { return o.Quality == 70 }, false},
+		{"format alias", `{"OutputFormat": "JPG"}`, func(o CompressionOptions) bool { return o.OutputFormat == FormatJPEG }, false},
+		{"automatic format", `{"OutputFormat": "auto"}`, func(o CompressionOptions) bool { return o.OutputFormat == FormatAuto }, false},
+		{"unknown format", `{"OutputFormat": "webp"}`, nil, true},
+		{"source quality", `{"SourceQuality": "cap"}`, func(o CompressionOptions) bool { return o.SourceQuality == SourceQualityCap }, false},
+		{"source quality ignore", `{"SourceQuality": "ignore"}`, func(o CompressionOptions) bool { return o.SourceQuality == SourceQualityIgnore }, false},
+		{"unknown source quality", `{"SourceQuality": "lower"}`, nil, true},
+		{"existing policy", `{"IfExists": "rename"}`, func(o CompressionOptions) bool { return o.IfExists == ExistingRename }, false},
+		{"unknown existing policy", `{"IfExists": "replace"}`, nil, true},
+		{"invalid template", `{"OutputTemplate": "{name.{ext}"}`, nil, true},
+		{"invalid json", `{"Quality": }`, nil, true},
+		{"unknown field", `{"Template": "{name}.{ext}"}`, nil, true},
+		{"field name case", `{"quality": 70}`, func(o CompressionOptions) bool { return o.Quality == 70 }, false},
+		{"trailing data", `{"Quality": 70} {}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "imgshrink.json")
+			writeTestFile(t, path, tt.config)
+
+			options, err := LoadOptions(path)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("LoadOptions() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.check != nil && !tt.check(options) {
+				t.Errorf("LoadOptions() = %+v", options)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/virakt/imgshrink/internal/qoi"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// writeImage encodes img in the output format resolved from options, writes it
+// to the generated output path and records the output details in result
+func writeImage(inputPath string, img image.Image, inputFormat ImageFormat, options CompressionOptions, result *CompressionResult) error {
+	return writeImageQuality(inputPath, img, inputFormat, options.Quality, options, result)
+}
+
+// writeImageQuality is writeImage encoding lossy formats at quality instead of
+// options.Quality, which the output is still tagged and journaled with
+func writeImageQuality(inputPath string, img image.Image, inputFormat ImageFormat, quality int, options CompressionOptions, result *CompressionResult) error {
+	format := ResolveOutputFormat(inputFormat, options)
+	encodeOptions := options
+	encodeOptions.Quality = quality
+
+	var data []byte
+	if format == FormatAuto {
+		selection, err := selectFormat(img, encodeOptions)
+		if err != nil {
+			return err
+		}
+		format = selection.format
+		data = selection.data
+		result.Candidates = selection.candidates
+	} else {
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, img, format, encodeOptions); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", strings.ToUpper(string(format)), err)
+		}
+		data = buf.Bytes()
+	}
+
+	if options.Placeholder {
+		placeholder, err := GeneratePlaceholder(img, options.PlaceholderSize)
+		if err != nil {
+			return fmt.Errorf("failed to generate placeholder: %w", err)
+		}
+		result.Placeholder = placeholder
+	}
+
+	return writeOutput(inputPath, data, format, options, result)
+}
+
+// writeOutput writes already encoded data to the output path generated for
+// format and records the output details in result
+func writeOutput(inputPath string, data []byte, format ImageFormat, options CompressionOptions, result *CompressionResult) error {
+	result.Format = format
+
+	if options.InPlace {
+		return replaceInPlace(inputPath, data, format, options, result)
+	}
+
+	// Generate output path
+	outputPath, err := outputPathForFormat(inputPath, format, options, &encodedOutput{data: data, width: result.Width, height: result.Height})
+	if err != nil {
+		return err
+	}
+	if sameFile(inputPath, outputPath) {
+		return fmt.Errorf("output path %s is the input; use in-place mode to replace it", outputPath)
+	}
+	return writeOutputTo(inputPath, outputPath, data, format, options, result)
+}
+
+// writeOutputTo writes data produced from inputPath to outputPath, applying
+// options.IfExists, backups, attributes, tags and the journal, and records
+// the output details in result
+func writeOutputTo(inputPath, outputPath string, data []byte, format ImageFormat, options CompressionOptions, result *CompressionResult) error {
+	// Ensure output directory exists
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	writePath, err := resolveExisting(inputPath, outputPath, options, result)
+	if err != nil {
+		return err
+	}
+	if writePath == "" {
+		result.OutputPath = outputPath
+		result.OutputSize = result.InputSize
+		result.Skipped = true
+		return nil
+	}
+	outputPath = writePath
+	result.OutputPath = outputPath
+
+	// An existing output is backed up and hashed before it is overwritten
+	action := JournalWrite
+	var inputHash, previousHash string
+	if _, err := os.Stat(outputPath); err == nil {
+		action = JournalOverwrite
+		if backupDir := backupDirOf(options); backupDir != "" {
+			backup, err := backupFile(backupDir, outputPath)
+			if err != nil {
+				return err
+			}
+			result.BackupPath = backup
+		}
+		if options.Journal != nil {
+			if previousHash, err = hashFile(outputPath); err != nil {
+				return err
+			}
+		}
+	}
+	if options.Journal != nil {
+		if inputHash, err = hashFile(inputPath); err != nil {
+			return err
+		}
+	}
+
+	var attrs *fileAttrs
+	if options.PreserveAttributes {
+		if attrs, err = readAttrs(inputPath); err != nil {
+			return err
+		}
+	}
+
+	// The entry goes in first so a write interrupted midway can still be undone
+	if err := options.Journal.record(action, inputPath, outputPath, inputHash, previousHash, data, result.BackupPath, options); err != nil {
+		return err
+	}
+
+	size, err := writeFile(outputPath, data, format, attrs)
+	if err != nil {
+		return err
+	}
+	result.OutputSize = size
+
+	if options.TagOutputs {
+		return tagFile(outputPath, options)
+	}
+	return nil
+}
+
+// writeFile atomically replaces path with data and returns the size written.
+// The data goes to a temporary file in the same directory, which is synced,
+// checked to decode as format (unless format is empty) and renamed into
+// place, so an interrupted or failed write never leaves a partial output.
+// A replaced file keeps its permissions and, where permitted, its owner, and
+// a new one gets 0666 less the umask, as with os.Create. attrs, when not nil, sets the mode and times
+// instead and adds extended attributes.
+func writeFile(path string, data []byte, format ImageFormat, attrs *fileAttrs) (int64, error) {
+	dir := filepath.Dir(path)
+
+	// Create the temporary file next to the output so the rename is atomic
+	tmpFile, err := createTemp(dir, filepath.Base(path))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create output file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			tmpFile.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		return 0, fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync output file: %w", err)
+	}
+	if err := verifyOutput(tmpFile, format); err != nil {
+		return 0, fmt.Errorf("written output does not decode: %w", err)
+	}
+	existing, err := os.Stat(path)
+	if err == nil {
+		chownLike(tmpFile, existing)
+	}
+	mode, keepMode := os.FileMode(0), true
+	if attrs != nil {
+		mode, keepMode = attrs.mode, false
+	} else if existing != nil {
+		mode, keepMode = existing.Mode().Perm(), false
+	}
+	if !keepMode {
+		if err := tmpFile.Chmod(mode); err != nil {
+			return 0, fmt.Errorf("failed to set output file permissions: %w", err)
+		}
+	}
+	if attrs != nil {
+		if err := writeXattrs(tmpFile, attrs.xattrs); err != nil {
+			return 0, fmt.Errorf("failed to set output file extended attributes: %w", err)
+		}
+	}
+	if err := tmpFile.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close output file: %w", err)
+	}
+	if attrs != nil && !attrs.modTime.IsZero() {
+		if err := os.Chtimes(tmpPath, attrs.accessTime, attrs.modTime); err != nil {
+			return 0, fmt.Errorf("failed to set output file times: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("failed to move output file into place: %w", err)
+	}
+	committed = true
+
+	// Persist the rename itself; not every platform can sync a directory
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+
+	return int64(len(data)), nil
+}
+
+// createTemp creates a hidden temporary file for base in dir. Unlike
+// os.CreateTemp, which always uses 0600, the file gets 0666 less the umask.
+func createTemp(dir, base string) (*os.File, error) {
+	for {
+		name := filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, os.ErrExist) {
+			return file, err
+		}
+	}
+}
+
+// rewriteFile replaces the contents of path without replacing the file, so
+// it keeps its hard links, owner and extended attributes. data is checked to
+// decode as format first, but unlike with writeFile an interrupted write
+// leaves the file partly written. attrs, when not nil, sets the mode and
+// times afterwards.
+func rewriteFile(path string, data []byte, format ImageFormat, attrs *fileAttrs) (int64, error) {
+	if err := verifyOutput(bytes.NewReader(data), format); err != nil {
+		return 0, fmt.Errorf("encoded output does not decode: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open output file: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("failed to sync output file: %w", err)
+	}
+	if attrs != nil {
+		if err := file.Chmod(attrs.mode); err != nil {
+			file.Close()
+			return 0, fmt.Errorf("failed to set output file permissions: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close output file: %w", err)
+	}
+	if attrs != nil && !attrs.modTime.IsZero() {
+		if err := os.Chtimes(path, attrs.accessTime, attrs.modTime); err != nil {
+			return 0, fmt.Errorf("failed to set output file times: %w", err)
+		}
+	}
+	return int64(len(data)), nil
+}
+
+// verifyOutput reads a written file back and checks that it decodes
+func verifyOutput(file io.ReadSeeker, format ImageFormat) error {
+	if format == "" {
+		return nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if format == FormatICO {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		return verifyICO(data)
+	}
+
+	if format == FormatSVG {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		_, err = parseSVG(data)
+		return err
+	}
+
+	_, _, err := image.Decode(bufio.NewReader(file))
+	return err
+}
+
+// encodeImage encodes img to w in the given format
+func encodeImage(w io.Writer, img image.Image, format ImageFormat, options CompressionOptions) error {
+	switch format {
+	case FormatJPEG:
+		// Encode with compression options
+		jpegOptions := &jpeg.Options{
+			Quality: options.Quality,
+		}
+		return jpeg.Encode(w, flattenAlpha(img), jpegOptions)
+
+	case FormatPNG:
+		// Create PNG encoder with options
+		encoder := &png.Encoder{
+			CompressionLevel: pngCompressionLevel(options.CompressionLevel),
+		}
+		return encoder.Encode(w, img)
+
+	case FormatTIFF:
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+
+	case FormatBMP:
+		return bmp.Encode(w, img)
+
+	case FormatQOI:
+		return qoi.Encode(w, img)
+
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// pngCompressionLevel maps a compression level (0-9) to a PNG compression level
+func pngCompressionLevel(level int) png.CompressionLevel {
+	switch {
+	case level <= 0:
+		return png.NoCompression
+	case level <= 3:
+		return png.BestSpeed
+	case level <= 6:
+		return png.DefaultCompression
+	default:
+		return png.BestCompression
+	}
+}
+
+// flattenAlpha composites img onto a white background when it has any
+// transparency, since JPEG cannot store an alpha channel
+func flattenAlpha(img image.Image) image.Image {
+	if !hasAlpha(img) {
+		return img
+	}
+	bounds := img.Bounds()
+	background := imaging.New(bounds.Dx(), bounds.Dy(), color.White)
+	return imaging.Overlay(background, img, image.Pt(0, 0), 1.0)
+}
+
+// hasAlpha reports whether any pixel of img is not fully opaque
+func hasAlpha(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
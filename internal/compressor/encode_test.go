@@ -0,0 +1,67 @@
+package compressor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.bin")
+
+	if _, err := writeFile(path, []byte("first"), "", nil); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+
+	// A replaced file keeps its permissions
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	size, err := writeFile(path, []byte("second"), "", nil)
+	if err != nil || size != 6 {
+		t.Fatalf("writeFile = %d, %v", size, err)
+	}
+	assertFile(t, path, "second", 0640)
+
+	// Explicit attributes win
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if _, err := writeFile(path, []byte("third"), "", &fileAttrs{mode: 0600, modTime: modTime}); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	assertFile(t, path, "third", 0600)
+	if info, _ := os.Stat(path); !info.ModTime().Equal(modTime) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), modTime)
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestWriteFileVerifies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.png")
+	if _, err := writeFile(path, []byte("not a png"), FormatPNG, nil); err == nil {
+		t.Fatal("writeFile accepted data that does not decode")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("failed write left %s: %v", path, err)
+	}
+}
+
+func assertFile(t *testing.T, path, content string, mode os.FileMode) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != content {
+		t.Errorf("%s = %q, %v, want %q", path, data, err, content)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != mode {
+		t.Errorf("%s mode = %v, want %v", path, info.Mode().Perm(), mode)
+	}
+}
@@ -0,0 +1,156 @@
+package compressor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutputExists is returned under ExistingFail when the output path is taken
+var ErrOutputExists = errors.New("output file already exists")
+
+// ExistingPolicy decides what happens when an output file already exists
+type ExistingPolicy string
+
+const (
+	ExistingOverwrite ExistingPolicy = ""           // Replace it
+	ExistingSkip      ExistingPolicy = "skip"       // Leave it and skip the input
+	ExistingSkipNewer ExistingPolicy = "skip-newer" // Skip the input when the output is newer than it
+	ExistingRename    ExistingPolicy = "rename"     // Write next to it as name-1.ext, name-2.ext, ...
+	ExistingFail      ExistingPolicy = "fail"       // Fail the input with ErrOutputExists
+)
+
+// ParseExistingPolicy converts a policy name into an ExistingPolicy
+func ParseExistingPolicy(name string) (ExistingPolicy, error) {
+	switch policy := ExistingPolicy(strings.ToLower(name)); policy {
+	case "overwrite":
+		return ExistingOverwrite, nil
+	case ExistingSkip, ExistingSkipNewer, ExistingRename, ExistingFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown existing output policy: %s", name)
+	}
+}
+
+// String returns the policy name
+func (p ExistingPolicy) String() string {
+	if p == ExistingOverwrite {
+		return "overwrite"
+	}
+	return string(p)
+}
+
+// resolveExisting applies options.IfExists to an output path that may already
+// exist. It returns the path to write, or an empty path when the input is to
+// be skipped, and records the applied policy in result.
+func resolveExisting(inputPath, outputPath string, options CompressionOptions, result *CompressionResult) (string, error) {
+	existing, err := os.Stat(outputPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return outputPath, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check output file: %w", err)
+	}
+
+	policy := options.IfExists
+	switch policy {
+	case ExistingSkip:
+		result.Existing = policy.String()
+		result.SkipReason = "output exists"
+		return "", nil
+
+	case ExistingSkipNewer:
+		input, err := os.Stat(inputPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to get input file info: %w", err)
+		}
+		if existing.ModTime().After(input.ModTime()) {
+			result.Existing = policy.String()
+			result.SkipReason = "output is newer than the source"
+			return "", nil
+		}
+		policy = ExistingOverwrite
+
+	case ExistingRename:
+		ext := filepath.Ext(outputPath)
+		base := strings.TrimSuffix(outputPath, ext)
+		for n := 1; ; n++ {
+			candidate := fmt.Sprintf("%s-%d%s", base, n, ext)
+			if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+				outputPath = candidate
+				break
+			}
+		}
+
+	case ExistingFail:
+		result.Existing = policy.String()
+		return "", fmt.Errorf("%w: %s", ErrOutputExists, outputPath)
+	}
+
+	result.Existing = policy.String()
+	return outputPath, nil
+}
+
+// skipExisting applies ExistingSkip and ExistingSkipNewer before an input is
+// read, when its output paths can be predicted and every page has an output
+// the policy leaves alone. Under automatic format selection any of the
+// formats counts. It reports whether result was filled in as skipped;
+// otherwise the policy is applied again once the output is encoded.
+func skipExisting(inputPath string, options CompressionOptions, result *CompressionResult) bool {
+	policy := options.IfExists
+	if options.InPlace || (policy != ExistingSkip && policy != ExistingSkipNewer) {
+		return false
+	}
+	input, err := os.Stat(inputPath)
+	if err != nil {
+		return false
+	}
+	pages, err := predictOutputs(inputPath, options)
+	if err != nil || pages == nil {
+		return false
+	}
+
+	reason := "output exists"
+	if policy == ExistingSkipNewer {
+		reason = "output is newer than the source"
+	}
+
+	var skipped []*CompressionResult
+	for _, candidates := range pages {
+		var page *CompressionResult
+		for _, outputPath := range candidates {
+			existing, err := os.Stat(outputPath)
+			if err != nil || (policy == ExistingSkipNewer && !existing.ModTime().After(input.ModTime())) {
+				continue
+			}
+			page = &CompressionResult{
+				InputPath:  inputPath,
+				OutputPath: outputPath,
+				OutputSize: existing.Size(),
+				Existing:   policy.String(),
+				Success:    true,
+				Skipped:    true,
+				SkipReason: reason,
+			}
+			break
+		}
+		if page == nil {
+			return false
+		}
+		skipped = append(skipped, page)
+	}
+
+	result.OutputPath = skipped[0].OutputPath
+	result.InputSize = input.Size()
+	result.OutputSize = input.Size()
+	result.Existing = policy.String()
+	result.Skipped = true
+	result.SkipReason = reason
+	result.Success = true
+	if len(skipped) > 1 {
+		result.Pages = skipped
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package compressor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveExisting(t *testing.T) {
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		policy    ExistingPolicy
+		exists    bool
+		outputAge time.Time
+		want      string // Path to write relative to the directory, empty to skip
+		wantError error
+	}{
+		{"missing", ExistingFail, false, time.Time{}, "out.png", nil},
+		{"overwrite", ExistingOverwrite, true, time.Time{}, "out.png", nil},
+		{"skip", ExistingSkip, true, time.Time{}, "", nil},
+		{"skip newer output", ExistingSkipNewer, true, newer, "", nil},
+		{"skip older output", ExistingSkipNewer, true, older, "out.png", nil},
+		{"rename", ExistingRename, true, time.Time{}, "out-2.png", nil},
+		{"fail", ExistingFail, true, time.Time{}, "", ErrOutputExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "in.png")
+			output := filepath.Join(dir, "out.png")
+			writeTestFile(t, input, "input")
+			if tt.exists {
+				writeTestFile(t, output, "output")
+				writeTestFile(t, filepath.Join(dir, "out-1.png"), "renamed before")
+				if !tt.outputAge.IsZero() {
+					touch(t, output, tt.outputAge)
+				}
+			}
+
+			options := DefaultOptions()
+			options.IfExists = tt.policy
+			result := &CompressionResult{}
+			got, err := resolveExisting(input, output, options, result)
+			if !errors.Is(err, tt.wantError) {
+				t.Fatalf("resolveExisting() error = %v, want %v", err, tt.wantError)
+			}
+
+			want := ""
+			if tt.want != "" {
+				want = filepath.Join(dir, tt.want)
+			}
+			if got != want {
+				t.Errorf("resolveExisting() = %q, want %q", got, want)
+			}
+			if tt.exists && result.Existing == "" {
+				t.Error("Existing not recorded")
+			}
+		})
+	}
+}
+
+func TestSkipExisting(t *testing.T) {
+	newer := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		input   string
+		outputs []string // Existing outputs
+		options func(options *CompressionOptions)
+		want    bool
+	}{
+		{"no output", "photo.jpg", nil, nil, false},
+		{"output exists", "photo.jpg", []string{"photo_compressed.jpg"}, nil, true},
+		{"overwrite", "photo.jpg", []string{"photo_compressed.jpg"}, func(options *CompressionOptions) {
+			options.IfExists = ExistingOverwrite
+		}, false},
+		{"converted output", "photo.jpg", []string{"photo_compressed.jpg"}, func(options *CompressionOptions) {
+			options.OutputFormat = FormatPNG
+		}, false},
+		{"any automatic format", "scan.bmp", []string{"scan_compressed.jpg"}, nil, true},
+		{"every page", "pages.tif", []string{"pages_compressed_page1.png", "pages_compressed_page2.jpg"}, func(options *CompressionOptions) {
+			options.AllPages = true
+		}, true},
+		{"missing page", "pages.tif", []string{"pages_compressed_page1.png"}, func(options *CompressionOptions) {
+			options.AllPages = true
+		}, false},
+		{"named by content", "photo.jpg", []string{"photo_compressed.jpg"}, func(options *CompressionOptions) {
+			options.OutputTemplate = "{hash:8}.{ext}"
+		}, false},
+		{"older output", "photo.jpg", []string{"photo_compressed.jpg"}, func(options *CompressionOptions) {
+			options.IfExists = ExistingSkipNewer
+		}, false},
+		{"in place", "photo.jpg", []string{"photo_compressed.jpg"}, func(options *CompressionOptions) {
+			options.InPlace = true
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, tt.input)
+			writeTestFile(t, input, string(testTIFFPages(2)))
+			touch(t, input, newer)
+			for _, output := range tt.outputs {
+				writeTestFile(t, filepath.Join(dir, output), "output")
+			}
+
+			options := DefaultOptions()
+			options.IfExists = ExistingSkip
+			if tt.options != nil {
+				tt.options(&options)
+			}
+			result := &CompressionResult{InputPath: input}
+			if got := skipExisting(input, options, result); got != tt.want {
+				t.Fatalf("skipExisting() = %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if !result.Skipped || result.Existing != options.IfExists.String() {
+				t.Errorf("result = %+v, want a skipped result", result)
+			}
+			if want := filepath.Join(dir, tt.outputs[0]); result.OutputPath != want {
+				t.Errorf("OutputPath = %q, want %q", result.OutputPath, want)
+			}
+			if len(tt.outputs) > 1 && len(result.Pages) != len(tt.outputs) {
+				t.Errorf("got %d pages, want %d", len(result.Pages), len(tt.outputs))
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// FormatICO is only valid as an output of favicon generation
+const FormatICO ImageFormat = "ico"
+
+// faviconICOSizes are the entries embedded in favicon.ico
+var faviconICOSizes = []int{16, 32, 48}
+
+// faviconRenditions are the standalone PNG icons of a favicon set
+var faviconRenditions = []struct {
+	Name   string
+	Size   int
+	Opaque bool // iOS renders transparency as black
+}{
+	{"favicon-16x16.png", 16, false},
+	{"favicon-32x32.png", 32, false},
+	{"apple-touch-icon.png", 180, true},
+	{"android-chrome-192x192.png", 192, false},
+	{"android-chrome-512x512.png", 512, false},
+}
+
+// FaviconSet contains the files written for a favicon set
+type FaviconSet struct {
+	SourcePath   string
+	Files        []*CompressionResult // favicon.ico first, then each PNG rendition
+	ManifestPath string
+	HTML         string // <link> tags referencing the generated files
+}
+
+// webManifest is the subset of the web app manifest written for Android icons
+type webManifest struct {
+	Icons []webManifestIcon `json:"icons"`
+}
+
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// GenerateFavicons renders favicon.ico (16, 32 and 48 px), apple-touch and
+// Android icons and a site.webmanifest from one source image into outputDir,
+// which defaults to the directory of the source. Non-square sources are
+// centered on a transparent square. options.IfExists applies to each file,
+// and the manifest and HTML refer to renamed files by their new names.
+func GenerateFavicons(inputPath, outputDir string, options CompressionOptions) (*FaviconSet, error) {
+	if format, err := GetImageFormat(inputPath); err == nil && format == FormatSVG {
+		return nil, fmt.Errorf("rasterizing SVG favicons is not supported")
+	}
+	if err := CheckLimits(inputPath, options.Limits); err != nil {
+		return nil, err
+	}
+
+	src, err := imaging.Open(inputPath, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	src = squareImage(src)
+
+	if outputDir == "" {
+		outputDir = filepath.Dir(inputPath)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	inputInfo, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get input file info: %w", err)
+	}
+
+	// Every file goes through the same existing output handling, backups,
+	// tags and journal as compressed images
+	options.InPlace = false
+	set := &FaviconSet{SourcePath: inputPath}
+	names := make(map[string]string) // Rendition name to the name written
+	record := func(name string, size int, format ImageFormat, data []byte) error {
+		result := &CompressionResult{
+			InputPath: inputPath,
+			InputSize: inputInfo.Size(),
+			Width:     size,
+			Height:    size,
+			Format:    format,
+		}
+		if err := writeOutputTo(inputPath, filepath.Join(outputDir, name), data, format, options, result); err != nil {
+			return err
+		}
+		result.Reduction = CalculateReduction(result.InputSize, result.OutputSize)
+		result.Success = true
+		set.Files = append(set.Files, result)
+		names[name] = filepath.Base(result.OutputPath)
+		return nil
+	}
+
+	// favicon.ico
+	var icoImages []image.Image
+	for _, size := range faviconICOSizes {
+		icoImages = append(icoImages, imaging.Resize(src, size, size, imaging.Lanczos))
+	}
+	var ico bytes.Buffer
+	if err := EncodeICO(&ico, icoImages, options); err != nil {
+		return nil, fmt.Errorf("failed to encode favicon.ico: %w", err)
+	}
+	if err := record("favicon.ico", faviconICOSizes[len(faviconICOSizes)-1], FormatICO, ico.Bytes()); err != nil {
+		return nil, err
+	}
+
+	// PNG renditions
+	png := NewPNGCompressor()
+	for _, rendition := range faviconRenditions {
+		img := image.Image(imaging.Resize(src, rendition.Size, rendition.Size, imaging.Lanczos))
+		if rendition.Opaque {
+			img = flattenAlpha(img)
+		}
+		data, err := png.Encode(img, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", rendition.Name, err)
+		}
+		if err := record(rendition.Name, rendition.Size, FormatPNG, data); err != nil {
+			return nil, err
+		}
+	}
+
+	// Web app manifest for Android
+	manifest := webManifest{}
+	for _, rendition := range faviconRenditions {
+		if strings.HasPrefix(rendition.Name, "android-chrome-") {
+			manifest.Icons = append(manifest.Icons, webManifestIcon{
+				Src:   "/" + names[rendition.Name],
+				Sizes: fmt.Sprintf("%dx%d", rendition.Size, rendition.Size),
+				Type:  "image/png",
+			})
+		}
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifestResult := &CompressionResult{InputPath: inputPath}
+	if err := writeOutputTo(inputPath, filepath.Join(outputDir, "site.webmanifest"), append(manifestData, '\n'), "", options, manifestResult); err != nil {
+		return nil, err
+	}
+	set.ManifestPath = manifestResult.OutputPath
+
+	// The links follow renamed files
+	set.HTML = strings.Join([]string{
+		fmt.Sprintf(`<link rel="icon" href="/%s" sizes="16x16 32x32 48x48">`, names["favicon.ico"]),
+		fmt.Sprintf(`<link rel="icon" type="image/png" sizes="32x32" href="/%s">`, names["favicon-32x32.png"]),
+		fmt.Sprintf(`<link rel="icon" type="image/png" sizes="16x16" href="/%s">`, names["favicon-16x16.png"]),
+		fmt.Sprintf(`<link rel="apple-touch-icon" sizes="180x180" href="/%s">`, names["apple-touch-icon.png"]),
+		fmt.Sprintf(`<link rel="manifest" href="/%s">`, filepath.Base(set.ManifestPath)),
+	}, "\n")
+
+	return set, nil
+}
+
+// squareImage centers img on a transparent square canvas if it is not square
+func squareImage(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == bounds.Dy() {
+		return img
+	}
+	side := bounds.Dx()
+	if bounds.Dy() > side {
+		side = bounds.Dy()
+	}
+	return imaging.PasteCenter(imaging.New(side, side, color.Transparent), img)
+}
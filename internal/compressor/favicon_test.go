@@ -0,0 +1,109 @@
+package compressor
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestSquareImage(t *testing.T) {
+	tests := []struct {
+		name string
+		size image.Point
+		want image.Point
+	}{
+		{"square", image.Pt(10, 10), image.Pt(10, 10)},
+		{"wide", image.Pt(20, 10), image.Pt(20, 20)},
+		{"tall", image.Pt(6, 30), image.Pt(30, 30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := imaging.New(tt.size.X, tt.size.Y, color.NRGBA{255, 0, 0, 255})
+			got := squareImage(src)
+			if got.Bounds().Size() != tt.want {
+				t.Fatalf("squareImage() is %v, want %v", got.Bounds().Size(), tt.want)
+			}
+			center := color.NRGBAModel.Convert(got.At(tt.want.X/2, tt.want.Y/2))
+			if center != (color.NRGBA{255, 0, 0, 255}) {
+				t.Errorf("center = %v, want the source", center)
+			}
+			if tt.size != tt.want {
+				if _, _, _, a := got.At(0, 0).RGBA(); a != 0 {
+					t.Error("padding is not transparent")
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateFavicons(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "logo.png")
+	writeTestPNG(t, input, 64, 40)
+
+	outputDir := filepath.Join(dir, "icons")
+	writeTestFile(t, filepath.Join(outputDir, "favicon.ico"), "existing")
+
+	options := DefaultOptions()
+	options.IfExists = ExistingRename
+	set, err := GenerateFavicons(input, outputDir, options)
+	if err != nil {
+		t.Fatalf("GenerateFavicons() error = %v", err)
+	}
+
+	if len(set.Files) != 1+len(faviconRenditions) {
+		t.Fatalf("wrote %d files, want %d", len(set.Files), 1+len(faviconRenditions))
+	}
+	if got := filepath.Base(set.Files[0].OutputPath); got != "favicon-1.ico" {
+		t.Errorf("favicon.ico written as %s, want favicon-1.ico", got)
+	}
+	if !strings.Contains(set.HTML, `href="/favicon-1.ico"`) {
+		t.Errorf("HTML does not link the renamed icon:\n%s", set.HTML)
+	}
+	for i, rendition := range faviconRenditions {
+		result := set.Files[i+1]
+		width, height, err := ImageDimensions(result.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width != rendition.Size || height != rendition.Size {
+			t.Errorf("%s is %dx%d, want %d", rendition.Name, width, height, rendition.Size)
+		}
+		if rendition.Opaque {
+			img, err := imaging.Open(result.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, _, a := img.At(0, 0).RGBA(); a != 0xffff {
+				t.Errorf("%s has transparent corners", rendition.Name)
+			}
+		}
+	}
+
+	data, err := os.ReadFile(set.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest webManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("manifest does not decode: %v", err)
+	}
+	if len(manifest.Icons) != 2 || manifest.Icons[0].Src != "/android-chrome-192x192.png" || manifest.Icons[1].Sizes != "512x512" {
+		t.Errorf("manifest icons = %+v", manifest.Icons)
+	}
+}
+
+func TestGenerateFaviconsSVG(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "logo.svg")
+	writeTestFile(t, input, `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16"/>`)
+	if _, err := GenerateFavicons(input, "", DefaultOptions()); err == nil {
+		t.Error("GenerateFavicons() accepted an SVG source")
+	}
+}
@@ -0,0 +1,39 @@
+package compressor
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileAttrs are attributes given to a written file instead of the defaults
+type fileAttrs struct {
+	mode       os.FileMode
+	accessTime time.Time // Zero leaves the access time alone
+	modTime    time.Time
+	xattrs     map[string][]byte // User extended attributes, by full name
+}
+
+// attrsOf returns the permissions and modification time of an existing file
+func attrsOf(info os.FileInfo) *fileAttrs {
+	return &fileAttrs{mode: info.Mode().Perm(), modTime: info.ModTime()}
+}
+
+// readAttrs returns every attribute of path that PreserveAttributes copies:
+// permissions, access and modification times and, where the platform and
+// file system support them, user extended attributes other than TagXattr,
+// which only describes the file it is on
+func readAttrs(path string) (*fileAttrs, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	attrs := attrsOf(info)
+	attrs.accessTime = accessTime(info)
+	if attrs.xattrs, err = readXattrs(path); err != nil {
+		return nil, fmt.Errorf("failed to read extended attributes: %w", err)
+	}
+	delete(attrs.xattrs, TagXattr)
+	return attrs, nil
+}
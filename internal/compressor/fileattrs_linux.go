@@ -0,0 +1,124 @@
+//go:build linux
+
+package compressor
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// accessTime returns the last access time recorded for a file
+func accessTime(info os.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+	}
+	return time.Time{}
+}
+
+// linkCount returns the number of hard links to a file
+func linkCount(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink)
+	}
+	return 1
+}
+
+// chownLike gives file the owner and group of info where permitted, falling
+// back to just the group, and leaves them alone otherwise
+func chownLike(file *os.File, info os.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	if file.Chown(int(stat.Uid), int(stat.Gid)) != nil {
+		file.Chown(-1, int(stat.Gid))
+	}
+}
+
+// readXattrs returns the user extended attributes of path, or none when the
+// file system does not support them
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, ignoreUnsupported(err)
+	}
+	list := make([]byte, size)
+	if size, err = unix.Listxattr(path, list); err != nil {
+		return nil, ignoreUnsupported(err)
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range strings.Split(strings.TrimRight(string(list[:size]), "\x00"), "\x00") {
+		if !strings.HasPrefix(name, "user.") {
+			continue
+		}
+		value, err := getXattr(path, name)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[name] = value
+	}
+	return xattrs, nil
+}
+
+// getXattr reads one extended attribute
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size, err = unix.Getxattr(path, name, value); err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
+
+// writeXattrs sets extended attributes on an open file, skipping them where
+// the file system does not support them
+func writeXattrs(file *os.File, xattrs map[string][]byte) error {
+	for name, value := range xattrs {
+		if err := unix.Fsetxattr(int(file.Fd()), name, value, 0); err != nil {
+			return ignoreUnsupported(err)
+		}
+	}
+	return nil
+}
+
+// lookupXattr returns one extended attribute, empty when it is not set
+func lookupXattr(path, name string) (string, error) {
+	value, err := getXattr(path, name)
+	if errors.Is(err, unix.ENODATA) {
+		return "", nil
+	}
+	if err != nil {
+		return "", unsupported(err)
+	}
+	return string(value), nil
+}
+
+// setXattr sets one extended attribute
+func setXattr(path, name string, value []byte) error {
+	return unsupported(unix.Setxattr(path, name, value, 0))
+}
+
+// unsupported reports a file system without extended attributes as
+// errors.ErrUnsupported
+func unsupported(err error) error {
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return errors.ErrUnsupported
+	}
+	return err
+}
+
+func ignoreUnsupported(err error) error {
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return nil
+	}
+	return err
+}
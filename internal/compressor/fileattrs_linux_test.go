@@ -0,0 +1,72 @@
+//go:build linux
+
+package compressor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileUmask(t *testing.T) {
+	for _, umask := range []int{0022, 0077} {
+		path := filepath.Join(t.TempDir(), "out.bin")
+
+		old := syscall.Umask(umask)
+		_, err := writeFile(path, []byte("data"), "", nil)
+		syscall.Umask(old)
+
+		if err != nil {
+			t.Fatalf("writeFile: %v", err)
+		}
+		assertFile(t, path, "data", 0666&^os.FileMode(umask))
+	}
+}
+
+func TestReadAttrsSkipsTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.png")
+	writeTestFile(t, path, "input")
+	if err := setXattr(path, "user.origin", []byte("camera")); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("extended attributes are not supported here")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if err := setXattr(path, TagXattr, []byte("imgshrink/1.0 0000")); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, err := readAttrs(path)
+	if err != nil {
+		t.Fatalf("readAttrs() error = %v", err)
+	}
+	if string(attrs.xattrs["user.origin"]) != "camera" {
+		t.Errorf("user.origin = %q, want camera", attrs.xattrs["user.origin"])
+	}
+	if _, ok := attrs.xattrs[TagXattr]; ok {
+		t.Errorf("readAttrs() kept %s", TagXattr)
+	}
+}
+
+func TestWriteFileKeepsOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	path := filepath.Join(t.TempDir(), "out.bin")
+	writeTestFile(t, path, "previous")
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writeFile(path, []byte("data"), "", nil); err != nil {
+		t.Fatalf("writeFile: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat := info.Sys().(*syscall.Stat_t); stat.Uid != 1234 || stat.Gid != 5678 {
+		t.Errorf("owner = %d:%d, want 1234:5678", stat.Uid, stat.Gid)
+	}
+}
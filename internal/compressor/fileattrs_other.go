@@ -0,0 +1,42 @@
+//go:build !linux
+
+package compressor
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// accessTime is not available portably; the zero time leaves it alone
+func accessTime(info os.FileInfo) time.Time {
+	return time.Time{}
+}
+
+// linkCount is not available portably; every file counts as singly linked
+func linkCount(info os.FileInfo) uint64 {
+	return 1
+}
+
+// chownLike has nothing to do where ownership is not available portably
+func chownLike(file *os.File, info os.FileInfo) {}
+
+// readXattrs finds no extended attributes where they are not supported
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// writeXattrs has nothing to do where extended attributes are not supported
+func writeXattrs(file *os.File, xattrs map[string][]byte) error {
+	return nil
+}
+
+// lookupXattr always reports extended attributes as unsupported
+func lookupXattr(path, name string) (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+// setXattr always reports extended attributes as unsupported
+func setXattr(path, name string, value []byte) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,113 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// EncodeICO writes an ICO file with one PNG-compressed entry per image. Images
+// must be at most 256x256 pixels.
+func EncodeICO(w io.Writer, images []image.Image, options CompressionOptions) error {
+	if len(images) == 0 {
+		return errors.New("ico: no images")
+	}
+
+	entries := make([][]byte, len(images))
+	for i, img := range images {
+		size := img.Bounds().Size()
+		if size.X > 256 || size.Y > 256 {
+			return fmt.Errorf("ico: image %dx%d exceeds 256x256", size.X, size.Y)
+		}
+		data, err := NewPNGCompressor().Encode(img, options)
+		if err != nil {
+			return fmt.Errorf("ico: failed to encode %dx%d entry: %w", size.X, size.Y, err)
+		}
+		entries[i] = data
+	}
+
+	var buf bytes.Buffer
+
+	// ICONDIR
+	binary.Write(&buf, binary.LittleEndian, [3]uint16{0, 1, uint16(len(images))})
+
+	// ICONDIRENTRY per image, data follows the directory
+	offset := 6 + 16*len(images)
+	for i, img := range images {
+		size := img.Bounds().Size()
+		entry := struct {
+			Width, Height, Colors, Reserved uint8
+			Planes, BitCount                uint16
+			Size, Offset                    uint32
+		}{
+			Width:    uint8(size.X % 256), // 0 means 256
+			Height:   uint8(size.Y % 256),
+			Planes:   1,
+			BitCount: 32,
+			Size:     uint32(len(entries[i])),
+			Offset:   uint32(offset),
+		}
+		binary.Write(&buf, binary.LittleEndian, entry)
+		offset += len(entries[i])
+	}
+
+	for _, data := range entries {
+		buf.Write(data)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// verifyICO checks the directory of an ICO file and that its largest entry
+// decodes to the size the directory gives
+func verifyICO(data []byte) error {
+	if len(data) < 6 {
+		return errors.New("ico: file too short")
+	}
+	var dir [3]uint16
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &dir)
+	if dir[0] != 0 || dir[1] != 1 || dir[2] == 0 {
+		return errors.New("ico: invalid directory")
+	}
+	count := int(dir[2])
+	if len(data) < 6+16*count {
+		return errors.New("ico: directory truncated")
+	}
+
+	largest, largestArea := -1, 0
+	for i := 0; i < count; i++ {
+		entry := data[6+16*i:]
+		size := binary.LittleEndian.Uint32(entry[8:])
+		offset := binary.LittleEndian.Uint32(entry[12:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return fmt.Errorf("ico: entry %d runs past the end of the file", i)
+		}
+		if area := icoSide(entry[0]) * icoSide(entry[1]); area > largestArea {
+			largest, largestArea = i, area
+		}
+	}
+
+	entry := data[6+16*largest:]
+	size := binary.LittleEndian.Uint32(entry[8:])
+	offset := binary.LittleEndian.Uint32(entry[12:])
+	img, _, err := image.Decode(bytes.NewReader(data[offset : offset+size]))
+	if err != nil {
+		return fmt.Errorf("ico: entry %d: %w", largest, err)
+	}
+	if want := image.Pt(icoSide(entry[0]), icoSide(entry[1])); img.Bounds().Size() != want {
+		return fmt.Errorf("ico: entry %d decodes to %v, want %v", largest, img.Bounds().Size(), want)
+	}
+	return nil
+}
+
+// icoSide returns the pixels of a directory entry's width or height byte
+func icoSide(b byte) int {
+	if b == 0 {
+		return 256
+	}
+	return int(b)
+}
@@ -0,0 +1,125 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeICO(t *testing.T) {
+	tests := []struct {
+		name      string
+		sizes     []image.Point
+		wantError bool
+	}{
+		{"one entry", []image.Point{{16, 16}}, false},
+		{"several entries", []image.Point{{16, 16}, {32, 32}, {48, 24}}, false},
+		{"largest entry", []image.Point{{256, 256}}, false},
+		{"too large", []image.Point{{16, 16}, {257, 16}}, true},
+		{"no entries", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var images []image.Image
+			for _, size := range tt.sizes {
+				images = append(images, image.NewNRGBA(image.Rectangle{Max: size}))
+			}
+
+			var buf bytes.Buffer
+			err := EncodeICO(&buf, images, DefaultOptions())
+			if (err != nil) != tt.wantError {
+				t.Fatalf("EncodeICO() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+
+			data := buf.Bytes()
+			var dir [3]uint16
+			binary.Read(bytes.NewReader(data), binary.LittleEndian, &dir)
+			if dir != [3]uint16{0, 1, uint16(len(tt.sizes))} {
+				t.Fatalf("ICONDIR = %v", dir)
+			}
+			for i, size := range tt.sizes {
+				entry := data[6+16*i:]
+				width, height := int(entry[0]), int(entry[1])
+				if width == 0 {
+					width = 256
+				}
+				if height == 0 {
+					height = 256
+				}
+				if width != size.X || height != size.Y {
+					t.Errorf("entry %d is %dx%d, want %v", i, width, height, size)
+				}
+
+				length := binary.LittleEndian.Uint32(entry[8:])
+				offset := binary.LittleEndian.Uint32(entry[12:])
+				if int(offset)+int(length) > len(data) {
+					t.Fatalf("entry %d runs past the end of the file", i)
+				}
+				img, err := png.Decode(bytes.NewReader(data[offset : offset+length]))
+				if err != nil {
+					t.Fatalf("entry %d does not decode: %v", i, err)
+				}
+				if img.Bounds().Size() != size {
+					t.Errorf("entry %d decodes to %v, want %v", i, img.Bounds().Size(), size)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyICO(t *testing.T) {
+	var buf bytes.Buffer
+	images := []image.Image{image.NewNRGBA(image.Rect(0, 0, 16, 16)), image.NewNRGBA(image.Rect(0, 0, 32, 32))}
+	if err := EncodeICO(&buf, images, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	largest := 6 + 16 // Directory entry of the 32x32 image
+
+	modified := func(change func(data []byte) []byte) []byte {
+		return change(append([]byte(nil), valid...))
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantError bool
+	}{
+		{"valid", valid, false},
+		{"empty", nil, true},
+		{"not an icon", modified(func(data []byte) []byte { data[2] = 2; return data }), true},
+		{"no entries", modified(func(data []byte) []byte { data[4] = 0; return data }), true},
+		{"truncated directory", valid[:20], true},
+		{"truncated data", valid[:len(valid)-10], true},
+		{"corrupt entry", modified(func(data []byte) []byte {
+			offset := binary.LittleEndian.Uint32(data[largest+12:])
+			copy(data[offset:], "not a png")
+			return data
+		}), true},
+		{"wrong size", modified(func(data []byte) []byte { data[largest] = 48; return data }), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyICO(tt.data); (err != nil) != tt.wantError {
+				t.Errorf("verifyICO() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "favicon.ico")
+	if _, err := writeFile(path, valid[:len(valid)-10], FormatICO, nil); err == nil {
+		t.Error("writeFile() accepted a truncated icon")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("writeFile() left a truncated icon behind")
+	}
+}
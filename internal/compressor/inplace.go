@@ -0,0 +1,110 @@
+package compressor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// replaceInPlace overwrites inputPath with data when data is smaller, keeping
+// the original's permissions, modification time and, where permitted, owner,
+// and with PreserveAttributes also its access time and user xattrs. A file
+// with several hard links is rewritten rather than replaced so every link
+// sees the new contents. The original is copied to the backup directory
+// first when one is configured, or next to the journal of a journaled run,
+// and the replacement is recorded before the file is replaced.
+func replaceInPlace(inputPath string, data []byte, format ImageFormat, options CompressionOptions, result *CompressionResult) error {
+	if inputFormat, err := GetImageFormat(inputPath); err == nil && format != inputFormat {
+		return fmt.Errorf("in-place replacement cannot change the format from %s to %s", inputFormat, format)
+	}
+
+	original, err := os.Stat(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get input file info: %w", err)
+	}
+
+	result.OutputPath = inputPath
+	if int64(len(data)) >= original.Size() {
+		result.OutputSize = original.Size()
+		result.Skipped = true
+		result.SkipReason = "encoded output is not smaller"
+		return nil
+	}
+
+	// The original is about to disappear, record what it was
+	var originalHash string
+	if options.Journal != nil {
+		if originalHash, err = hashFile(inputPath); err != nil {
+			return err
+		}
+	}
+
+	if backupDir := backupDirOf(options); backupDir != "" {
+		backup, err := backupFile(backupDir, inputPath)
+		if err != nil {
+			return err
+		}
+		result.BackupPath = backup
+	}
+
+	attrs := attrsOf(original)
+	if options.PreserveAttributes {
+		if attrs, err = readAttrs(inputPath); err != nil {
+			return err
+		}
+	}
+
+	if err := options.Journal.record(JournalReplace, inputPath, inputPath, originalHash, originalHash, data, result.BackupPath, options); err != nil {
+		return err
+	}
+
+	write := writeFile
+	if linkCount(original) > 1 {
+		write = rewriteFile
+	}
+	size, err := write(inputPath, data, format, attrs)
+	if err != nil {
+		return err
+	}
+	result.OutputSize = size
+
+	if options.TagOutputs {
+		return tagFile(inputPath, options)
+	}
+	return nil
+}
+
+// backupFile copies path to its mirrored location under backupDir, keeping
+// its permissions, times and user xattrs, and returns the copy's path
+func backupFile(backupDir, path string) (string, error) {
+	attrs, err := readAttrs(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s for backup: %w", path, err)
+	}
+
+	backup, err := backupPath(backupDir, path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if _, err := writeFile(backup, data, "", attrs); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return backup, nil
+}
+
+// backupPath mirrors inputPath under backupDir: relative to the working
+// directory when the input lies below it, by its absolute path otherwise
+func backupPath(backupDir, inputPath string) (string, error) {
+	rel, err := relativePath("", inputPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(backupDir, rel), nil
+}
@@ -0,0 +1,66 @@
+package compressor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestReplaceInPlace(t *testing.T) {
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		input     string
+		data      string
+		format    ImageFormat
+		link      bool // Add a second hard link to the input
+		want      string
+		wantSkip  bool
+		wantError bool
+	}{
+		{"smaller", "in.dat", "small", "", false, "small", false, false},
+		{"not smaller", "in.dat", "larger than the original", "", false, "original input", true, false},
+		{"format change", "in.png", "small", FormatJPEG, false, "original input", false, true},
+		{"hard linked", "in.dat", "small", "", true, "small", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			input := filepath.Join(dir, tt.input)
+			writeTestFile(t, input, "original input")
+			if err := os.Chmod(input, 0640); err != nil {
+				t.Fatal(err)
+			}
+			touch(t, input, modTime)
+			link := filepath.Join(dir, "link.dat")
+			if tt.link {
+				if err := os.Link(input, link); err != nil {
+					t.Skipf("hard links are not supported here: %v", err)
+				}
+			}
+
+			options := DefaultOptions()
+			options.BackupDir = filepath.Join(dir, "backup")
+			result := &CompressionResult{}
+			err := replaceInPlace(input, []byte(tt.data), tt.format, options, result)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("replaceInPlace() error = %v, wantError %v", err, tt.wantError)
+			}
+			if result.Skipped != tt.wantSkip {
+				t.Errorf("Skipped = %v, want %v", result.Skipped, tt.wantSkip)
+			}
+			assertFile(t, input, tt.want, 0640)
+			if info, err := os.Stat(input); err == nil && !info.ModTime().Equal(modTime) {
+				t.Errorf("modification time = %v, want %v", info.ModTime(), modTime)
+			}
+			if tt.link && runtime.GOOS == "linux" {
+				assertFile(t, link, tt.want, 0640)
+			}
+		})
+	}
+}
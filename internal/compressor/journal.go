@@ -0,0 +1,249 @@
+package compressor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JournalAction is the kind of change a journal entry records
+type JournalAction string
+
+const (
+	JournalWrite     JournalAction = "write"     // A new output file was created
+	JournalOverwrite JournalAction = "overwrite" // An existing file at the output path was replaced
+	JournalReplace   JournalAction = "replace"   // The input was replaced in place
+)
+
+// JournalEntry records one file written by a compression, with what is needed
+// to undo it
+type JournalEntry struct {
+	Time         time.Time          `json:"time"`
+	Action       JournalAction      `json:"action"`
+	InputPath    string             `json:"inputPath"`
+	OutputPath   string             `json:"outputPath"`
+	InputHash    string             `json:"inputHash"`              // SHA-256 of the input before compression
+	PreviousHash string             `json:"previousHash,omitempty"` // SHA-256 of the file the output replaced
+	OutputHash   string             `json:"outputHash"`             // SHA-256 of the written output
+	BackupPath   string             `json:"backupPath,omitempty"`   // Copy of the replaced file
+	Options      CompressionOptions `json:"options"`
+}
+
+// Journal appends entries as JSON lines. It is safe for concurrent use.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	path string
+}
+
+// OpenJournal opens a journal for appending, creating it if needed
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	return &Journal{file: file, path: path}, nil
+}
+
+// Path returns the location of the journal file
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// BackupDir returns where replaced files are backed up when a journaled run
+// sets no BackupDir of its own: a directory next to the journal, so every
+// entry can be undone
+func (j *Journal) BackupDir() string {
+	return j.path + ".backup"
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Record appends an entry and syncs it to disk
+func (j *Journal) Record(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// record builds and appends an entry; a nil journal records nothing
+func (j *Journal) record(action JournalAction, inputPath, outputPath, inputHash, previousHash string, data []byte, backupPath string, options CompressionOptions) error {
+	if j == nil {
+		return nil
+	}
+	options.Journal = nil
+	sum := sha256.Sum256(data)
+	return j.Record(JournalEntry{
+		Time:         time.Now(),
+		Action:       action,
+		InputPath:    absPath(inputPath),
+		OutputPath:   absPath(outputPath),
+		InputHash:    inputHash,
+		PreviousHash: previousHash,
+		OutputHash:   hex.EncodeToString(sum[:]),
+		BackupPath:   absPath(backupPath),
+		Options:      options,
+	})
+}
+
+// backupDirOf returns the directory replaced files are copied to, or an empty
+// string when they are not backed up
+func backupDirOf(options CompressionOptions) string {
+	if options.BackupDir == "" && options.Journal != nil {
+		return options.Journal.BackupDir()
+	}
+	return options.BackupDir
+}
+
+// absPath makes journal paths independent of the working directory
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// ReadJournal reads every entry of a journal file
+func ReadJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("journal line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return entries, nil
+}
+
+// UndoResult is the outcome of undoing one journal entry
+type UndoResult struct {
+	Entry  JournalEntry
+	Action string // "removed", "restored" or "unchanged"
+	Error  error
+}
+
+// Undo reverts the entries of a journal, newest first: created outputs are
+// removed and replaced files are restored from their backups. Files changed
+// since they were written are left alone and reported as errors.
+func Undo(path string) ([]UndoResult, error) {
+	entries, err := ReadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]UndoResult, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		action, err := undoEntry(entries[i])
+		results = append(results, UndoResult{Entry: entries[i], Action: action, Error: err})
+	}
+	return results, nil
+}
+
+func undoEntry(entry JournalEntry) (string, error) {
+	current, err := hashFile(entry.OutputPath)
+	missing := errors.Is(err, os.ErrNotExist)
+	if err != nil && !missing {
+		return "", err
+	}
+
+	// Already undone
+	if entry.Action == JournalWrite && missing || entry.Action != JournalWrite && current == entry.PreviousHash {
+		return "unchanged", nil
+	}
+	if !missing && current != entry.OutputHash {
+		return "", fmt.Errorf("%s was modified after it was written", entry.OutputPath)
+	}
+
+	if entry.Action == JournalWrite {
+		if err := os.Remove(entry.OutputPath); err != nil {
+			return "", fmt.Errorf("failed to remove output: %w", err)
+		}
+		return "removed", nil
+	}
+
+	if entry.BackupPath == "" {
+		return "", fmt.Errorf("no backup of %s was kept", entry.OutputPath)
+	}
+	backupHash, err := hashFile(entry.BackupPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	if backupHash != entry.PreviousHash {
+		return "", fmt.Errorf("backup %s does not match the replaced file", entry.BackupPath)
+	}
+
+	attrs, err := readAttrs(entry.BackupPath)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(entry.BackupPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	// Restore hard-linked files in place, as replaceInPlace wrote them
+	write := writeFile
+	if info, err := os.Stat(entry.OutputPath); err == nil && linkCount(info) > 1 {
+		write = rewriteFile
+	}
+	if _, err := write(entry.OutputPath, data, "", attrs); err != nil {
+		return "", err
+	}
+	return "restored", nil
+}
+
+// hashFile returns the hex SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,194 @@
+package compressor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        func(t *testing.T, dir string, options CompressionOptions) error
+		wantAction string
+		wantError  bool
+		want       map[string]string // File contents after the undo, empty when removed
+	}{
+		{
+			name: "new output",
+			run: func(t *testing.T, dir string, options CompressionOptions) error {
+				return writeOutputTo(filepath.Join(dir, "in.dat"), filepath.Join(dir, "out.dat"), []byte("out"), "", options, &CompressionResult{})
+			},
+			wantAction: "removed",
+			want:       map[string]string{"out.dat": ""},
+		},
+		{
+			name: "overwritten output",
+			run: func(t *testing.T, dir string, options CompressionOptions) error {
+				writeTestFile(t, filepath.Join(dir, "out.dat"), "previous")
+				return writeOutputTo(filepath.Join(dir, "in.dat"), filepath.Join(dir, "out.dat"), []byte("out"), "", options, &CompressionResult{})
+			},
+			wantAction: "restored",
+			want:       map[string]string{"out.dat": "previous"},
+		},
+		{
+			name: "replaced in place",
+			run: func(t *testing.T, dir string, options CompressionOptions) error {
+				return replaceInPlace(filepath.Join(dir, "in.dat"), []byte("in"), "", options, &CompressionResult{})
+			},
+			wantAction: "restored",
+			want:       map[string]string{"in.dat": "original input"},
+		},
+		{
+			name: "recorded but never written",
+			run: func(t *testing.T, dir string, options CompressionOptions) error {
+				return options.Journal.record(JournalWrite, filepath.Join(dir, "in.dat"), filepath.Join(dir, "out.dat"), "", "", []byte("out"), "", options)
+			},
+			wantAction: "unchanged",
+			want:       map[string]string{"out.dat": ""},
+		},
+		{
+			name: "modified after writing",
+			run: func(t *testing.T, dir string, options CompressionOptions) error {
+				err := writeOutputTo(filepath.Join(dir, "in.dat"), filepath.Join(dir, "out.dat"), []byte("out"), "", options, &CompressionResult{})
+				writeTestFile(t, filepath.Join(dir, "out.dat"), "edited")
+				return err
+			},
+			wantError: true,
+			want:      map[string]string{"out.dat": "edited"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			writeTestFile(t, filepath.Join(dir, "in.dat"), "original input")
+
+			journal, err := OpenJournal(filepath.Join(dir, "run.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := DefaultOptions()
+			options.BackupDir = filepath.Join(dir, "backup")
+			options.Journal = journal
+			if err := tt.run(t, dir, options); err != nil {
+				t.Fatalf("run error = %v", err)
+			}
+			journal.Close()
+
+			results, err := Undo(journal.Path())
+			if err != nil {
+				t.Fatalf("Undo() error = %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("Undo() = %d results, want 1", len(results))
+			}
+			if (results[0].Error != nil) != tt.wantError {
+				t.Fatalf("Undo() error = %v, wantError %v", results[0].Error, tt.wantError)
+			}
+			if results[0].Action != tt.wantAction {
+				t.Errorf("Action = %q, want %q", results[0].Action, tt.wantAction)
+			}
+			for name, want := range tt.want {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if want == "" {
+					if !os.IsNotExist(err) {
+						t.Errorf("%s exists after the undo", name)
+					}
+					continue
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUndoKeepsHardLinks(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("hard-linked files are only rewritten in place on Linux")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	input := filepath.Join(dir, "in.dat")
+	writeTestFile(t, input, "original input")
+	link := filepath.Join(dir, "link.dat")
+	if err := os.Link(input, link); err != nil {
+		t.Skipf("hard links are not supported here: %v", err)
+	}
+
+	journal, err := OpenJournal(filepath.Join(dir, "run.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultOptions()
+	options.Journal = journal
+	if err := replaceInPlace(input, []byte("in"), "", options, &CompressionResult{}); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	results, err := Undo(journal.Path())
+	if err != nil || len(results) != 1 || results[0].Error != nil {
+		t.Fatalf("Undo() = %+v, %v", results, err)
+	}
+	for _, path := range []string{input, link} {
+		if data, _ := os.ReadFile(path); string(data) != "original input" {
+			t.Errorf("%s = %q after the undo, want the original", filepath.Base(path), data)
+		}
+	}
+}
+
+func TestUndoWithoutBackupDir(t *testing.T) {
+	tests := []struct {
+		name string
+		file string // The file replaced
+		run  func(dir string, options CompressionOptions) error
+	}{
+		{"overwritten output", "out.dat", func(dir string, options CompressionOptions) error {
+			return writeOutputTo(filepath.Join(dir, "in.dat"), filepath.Join(dir, "out.dat"), []byte("out"), "", options, &CompressionResult{})
+		}},
+		{"replaced in place", "in.dat", func(dir string, options CompressionOptions) error {
+			return replaceInPlace(filepath.Join(dir, "in.dat"), []byte("in"), "", options, &CompressionResult{})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			writeTestFile(t, filepath.Join(dir, "in.dat"), "original input")
+			writeTestFile(t, filepath.Join(dir, "out.dat"), "previous")
+
+			journal, err := OpenJournal(filepath.Join(dir, "run.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := DefaultOptions()
+			options.Journal = journal
+			if err := tt.run(dir, options); err != nil {
+				t.Fatalf("run error = %v", err)
+			}
+			journal.Close()
+			if _, err := os.Stat(filepath.Join(journal.BackupDir(), tt.file)); err != nil {
+				t.Errorf("no backup next to the journal: %v", err)
+			}
+
+			results, err := Undo(journal.Path())
+			if err != nil {
+				t.Fatalf("Undo() error = %v", err)
+			}
+			if len(results) != 1 || results[0].Error != nil || results[0].Action != "restored" {
+				t.Fatalf("Undo() = %+v, want one restored file", results)
+			}
+			for name, want := range map[string]string{"in.dat": "original input", "out.dat": "previous"} {
+				if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+		})
+	}
+}
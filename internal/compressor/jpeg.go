@@ -1,9 +1,9 @@
 package compressor
 
 import (
+	"bytes"
 	"fmt"
 	"image"
-	"image/jpeg"
 	"os"
 
 	"github.com/disintegration/imaging"
@@ -24,16 +24,44 @@ func (c *JPEGCompressor) Compress(inputPath string, options CompressionOptions)
 		Success:   false,
 	}
 
-	// Get input file info
-	inputInfo, err := os.Stat(inputPath)
+	// Leave inputs whose outputs exist alone before reading them
+	if skipExisting(inputPath, options, result) {
+		return result, nil
+	}
+
+	// Refuse decompression bombs before anything is decoded
+	if err := CheckLimits(inputPath, options.Limits); err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	// Read the file, the quantization tables are needed before decoding
+	data, err := os.ReadFile(inputPath)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to get input file info: %w", err)
+		result.Error = fmt.Errorf("failed to read input file: %w", err)
 		return result, result.Error
 	}
-	result.InputSize = inputInfo.Size()
+	result.InputSize = int64(len(data))
+
+	// Never spend more quality than the source has. The cap applies to this
+	// encode only; tags, the journal and the manifest keep the run's options.
+	quality := options.Quality
+	if options.SourceQuality != SourceQualityIgnore {
+		if source := estimateJPEGQuality(data); source > 0 && source <= options.Quality {
+			resizing := options.ResizePercent > 0 && options.ResizePercent < 100 || options.ResizeWidth > 0 || options.ResizeHeight > 0
+			if options.SourceQuality == SourceQualitySkip && !resizing && ResolveOutputFormat(FormatJPEG, options) == FormatJPEG {
+				result.OutputSize = result.InputSize
+				result.Skipped = true
+				result.SkipReason = fmt.Sprintf("source quality %d is at or below %d", source, options.Quality)
+				result.Success = true
+				return result, nil
+			}
+			quality = source
+		}
+	}
 
-	// Open and decode the image
-	img, err := imaging.Open(inputPath, imaging.AutoOrientation(true))
+	// Decode the image
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
 	if err != nil {
 		result.Error = fmt.Errorf("failed to open image: %w", err)
 		return result, result.Error
@@ -47,43 +75,12 @@ func (c *JPEGCompressor) Compress(inputPath string, options CompressionOptions)
 	result.Width = bounds.Dx()
 	result.Height = bounds.Dy()
 
-	// Generate output path
-	outputPath := GenerateOutputPath(inputPath, options)
-	result.OutputPath = outputPath
-
-	// Ensure output directory exists
-	if options.OutputDir != "" {
-		if err := os.MkdirAll(options.OutputDir, 0755); err != nil {
-			result.Error = fmt.Errorf("failed to create output directory: %w", err)
-			return result, result.Error
-		}
-	}
-
-	// Create output file
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to create output file: %w", err)
-		return result, result.Error
-	}
-	defer outFile.Close()
-
-	// Encode with compression options
-	jpegOptions := &jpeg.Options{
-		Quality: options.Quality,
-	}
-
-	if err := jpeg.Encode(outFile, img, jpegOptions); err != nil {
-		result.Error = fmt.Errorf("failed to encode JPEG: %w", err)
+	// Encode and write the output
+	if err := writeImageQuality(inputPath, img, FormatJPEG, quality, options, result); err != nil {
+		result.Error = err
 		return result, result.Error
 	}
 
-	// Get output file size
-	outInfo, err := os.Stat(outputPath)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to get output file info: %w", err)
-		return result, result.Error
-	}
-	result.OutputSize = outInfo.Size()
 	result.Reduction = CalculateReduction(result.InputSize, result.OutputSize)
 	result.Success = true
 
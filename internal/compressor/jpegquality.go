@@ -0,0 +1,158 @@
+package compressor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// SourceQualityPolicy decides what happens to JPEG sources that were saved at
+// or below the requested quality
+type SourceQualityPolicy string
+
+const (
+	SourceQualityIgnore SourceQualityPolicy = ""     // Always encode at Quality
+	SourceQualityCap    SourceQualityPolicy = "cap"  // Encode at the lower of Quality and the source quality
+	SourceQualitySkip   SourceQualityPolicy = "skip" // Leave such sources alone; cap when they must be re-encoded anyway
+)
+
+// ParseSourceQuality converts a policy name (ignore, cap or skip) to a
+// SourceQualityPolicy
+func ParseSourceQuality(name string) (SourceQualityPolicy, error) {
+	switch policy := SourceQualityPolicy(strings.ToLower(name)); policy {
+	case "ignore":
+		return SourceQualityIgnore, nil
+	case SourceQualityIgnore, SourceQualityCap, SourceQualitySkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown source quality policy: %s", name)
+	}
+}
+
+// jpegZigzag maps DQT (zig-zag) order to natural row-major order
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegStandardTables are the luminance and chrominance tables from Annex K of
+// the JPEG standard, in natural order, which libjpeg and Go scale by quality
+var jpegStandardTables = [2][64]int{
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// readJPEGQuantTables returns the quantization tables defined in the DQT
+// segments before the first scan, indexed by table id, in zig-zag order
+func readJPEGQuantTables(data []byte) map[int][64]int {
+	tables := make(map[int][64]int)
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD8 {
+			i += 2
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+
+		if marker == 0xDB {
+			// One segment may hold several tables
+			segment := data[i+4 : i+2+length]
+			for len(segment) > 0 {
+				precision, id := int(segment[0]>>4), int(segment[0]&0x0F)
+				size := 64 * (precision + 1)
+				if len(segment) < 1+size {
+					break
+				}
+				var table [64]int
+				for k := range table {
+					if precision == 0 {
+						table[k] = int(segment[1+k])
+					} else {
+						table[k] = int(binary.BigEndian.Uint16(segment[1+2*k:]))
+					}
+				}
+				tables[id] = table
+				segment = segment[1+size:]
+			}
+		}
+
+		i += 2 + length
+	}
+
+	return tables
+}
+
+// estimateJPEGQuality returns the libjpeg quality (1-100) whose scaled standard
+// tables are closest to the file's quantization tables, or 0 when the file has
+// none. Encoders with custom tables get the nearest equivalent.
+func estimateJPEGQuality(data []byte) int {
+	tables := readJPEGQuantTables(data)
+	if _, ok := tables[0]; !ok {
+		return 0
+	}
+
+	best, bestError := 0, -1
+	for quality := 1; quality <= 100; quality++ {
+		scale := 200 - 2*quality
+		if quality < 50 {
+			scale = 5000 / quality
+		}
+
+		errorSum := 0
+		for id, standard := range jpegStandardTables {
+			table, ok := tables[id]
+			if !ok {
+				continue
+			}
+			for k, value := range table {
+				expected := min(max((standard[jpegZigzag[k]]*scale+50)/100, 1), 255)
+				diff := value - expected
+				if diff < 0 {
+					diff = -diff
+				}
+				errorSum += diff
+			}
+		}
+
+		if bestError < 0 || errorSum < bestError {
+			best, bestError = quality, errorSum
+		}
+	}
+
+	return best
+}
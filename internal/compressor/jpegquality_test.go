@@ -0,0 +1,55 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"strconv"
+	"testing"
+)
+
+func TestEstimateJPEGQuality(t *testing.T) {
+	for _, quality := range []int{5, 10, 30, 50, 51, 75, 85, 95, 100} {
+		t.Run(strconv.Itoa(quality), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), &jpeg.Options{Quality: quality}); err != nil {
+				t.Fatal(err)
+			}
+			if got := estimateJPEGQuality(buf.Bytes()); got != quality {
+				t.Errorf("estimateJPEGQuality() = %d, want %d", got, quality)
+			}
+		})
+	}
+
+	for _, data := range [][]byte{nil, []byte("\xFF\xD8\xFF\xD9"), []byte("not a jpeg")} {
+		if got := estimateJPEGQuality(data); got != 0 {
+			t.Errorf("estimateJPEGQuality(%q) = %d, want 0", data, got)
+		}
+	}
+}
+
+func TestParseSourceQuality(t *testing.T) {
+	tests := []struct {
+		name      string
+		want      SourceQualityPolicy
+		wantError bool
+	}{
+		{"", SourceQualityIgnore, false},
+		{"ignore", SourceQualityIgnore, false},
+		{"cap", SourceQualityCap, false},
+		{"Skip", SourceQualitySkip, false},
+		{"lower", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSourceQuality(tt.name)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseSourceQuality() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSourceQuality() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
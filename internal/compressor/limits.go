@@ -0,0 +1,136 @@
+package compressor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+)
+
+// ErrLimitExceeded is matched by every LimitError
+var ErrLimitExceeded = errors.New("resource limit exceeded")
+
+// Limits bounds what a single input may claim before it is fully decoded.
+// Zero disables a limit.
+type Limits struct {
+	MaxPixels    int64 // Width x height of any page or frame
+	MaxDimension int   // Longest side in pixels
+	MaxFileSize  int64 // Input size in bytes
+	MaxFrames    int   // Pages of a TIFF or frames of an animated PNG
+}
+
+// DefaultLimits returns limits that admit any realistic photo or scan
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPixels:    256 * 1024 * 1024, // 1 GiB decoded as 8-bit RGBA
+		MaxDimension: 65535,
+		MaxFileSize:  1 << 30,
+		MaxFrames:    1000,
+	}
+}
+
+// LimitError reports an input that exceeds one of the configured limits
+type LimitError struct {
+	Path  string
+	Limit string // "pixels", "dimension", "file size" or "frames"
+	Value int64
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	message := fmt.Sprintf("%s: %s %d exceeds the limit of %d", ErrLimitExceeded, e.Limit, e.Value, e.Max)
+	if e.Path == "" {
+		return message
+	}
+	return e.Path + ": " + message
+}
+
+// Unwrap lets errors.Is match ErrLimitExceeded
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// CheckLimits verifies an input against limits using only its size, header
+// and frame table, so oversized images are refused before they are decoded.
+// The file is read in place: headers, TIFF directories and APNG frame
+// controls, whose dimensions are checked like the image's.
+func CheckLimits(path string, limits Limits) error {
+	// Vector images have no pixel dimensions to bound
+	if format, err := GetImageFormat(path); err == nil && format == FormatSVG {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to get input file info: %w", err)
+		}
+		return limits.checkFileSize(path, stat.Size())
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get input file info: %w", err)
+	}
+	if err := limits.checkFileSize(path, stat.Size()); err != nil {
+		return err
+	}
+
+	config, format, err := image.DecodeConfig(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("failed to decode image config: %w", err)
+	}
+	if err := limits.checkDimensions(path, config.Width, config.Height); err != nil {
+		return err
+	}
+
+	frames := 1
+	switch format {
+	case "tiff":
+		if offsets, err := tiffPageOffsets(file, stat.Size()); err == nil {
+			frames = len(offsets)
+		}
+	case "png":
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read input file: %w", err)
+		}
+		declared, sizes, err := scanAPNGFrames(file)
+		if err != nil {
+			return fmt.Errorf("failed to read animation frames: %w", err)
+		}
+		for _, size := range sizes {
+			if err := limits.checkDimensions(path, size.X, size.Y); err != nil {
+				return err
+			}
+		}
+		frames = max(1, declared, len(sizes))
+	}
+	if limits.MaxFrames > 0 && frames > limits.MaxFrames {
+		return &LimitError{Path: path, Limit: "frames", Value: int64(frames), Max: int64(limits.MaxFrames)}
+	}
+
+	return nil
+}
+
+// checkFileSize verifies the size of an input in bytes
+func (l Limits) checkFileSize(path string, size int64) error {
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return &LimitError{Path: path, Limit: "file size", Value: size, Max: l.MaxFileSize}
+	}
+	return nil
+}
+
+// checkDimensions verifies the size of one page or frame
+func (l Limits) checkDimensions(path string, width, height int) error {
+	if l.MaxDimension > 0 && max(width, height) > l.MaxDimension {
+		return &LimitError{Path: path, Limit: "dimension", Value: int64(max(width, height)), Max: int64(l.MaxDimension)}
+	}
+	if pixels := int64(width) * int64(height); l.MaxPixels > 0 && pixels > l.MaxPixels {
+		return &LimitError{Path: path, Limit: "pixels", Value: pixels, Max: l.MaxPixels}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+func TestCheckLimits(t *testing.T) {
+	// An animated PNG whose second frame is far larger than its 4x4 canvas
+	oversizedFrame := testAPNG(t, nil, nil)
+	oversizedFrame[5].Data = testFcTL(1, 5000, 5000)
+
+	tests := []struct {
+		name      string
+		file      string
+		data      func(t *testing.T) []byte
+		limits    Limits
+		wantLimit string // Empty when the input passes
+	}{
+		{"within limits", "a.png", pngData(64, 32), DefaultLimits(), ""},
+		{"no limits", "a.png", pngData(64, 32), Limits{}, ""},
+		{"pixels", "a.png", pngData(64, 32), Limits{MaxPixels: 2000}, "pixels"},
+		{"dimension", "a.png", pngData(64, 32), Limits{MaxDimension: 50}, "dimension"},
+		{"file size", "a.png", pngData(64, 32), Limits{MaxFileSize: 10}, "file size"},
+		{"animation frames", "anim.png", apngData(testAPNG(t, nil, nil)), Limits{MaxFrames: 1}, "frames"},
+		{"animation within limits", "anim.png", apngData(testAPNG(t, nil, nil)), Limits{MaxFrames: 2, MaxDimension: 4}, ""},
+		{"frame dimension", "anim.png", apngData(oversizedFrame), Limits{MaxDimension: 1000}, "dimension"},
+		{"frame pixels", "anim.png", apngData(oversizedFrame), Limits{MaxPixels: 1000000}, "pixels"},
+		{"tiff pages", "scan.tif", tiffData(3), Limits{MaxFrames: 2}, "frames"},
+		{"tiff pages within limits", "scan.tif", tiffData(3), Limits{MaxFrames: 3}, ""},
+		{"svg file size", "logo.svg", svgData, Limits{MaxFileSize: 10}, "file size"},
+		{"svg", "logo.svg", svgData, Limits{MaxFileSize: 1000, MaxPixels: 1}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, tt.data(t), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := CheckLimits(path, tt.limits)
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Errorf("CheckLimits() error = %v", err)
+				}
+				return
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("CheckLimits() error = %v, want a *LimitError", err)
+			}
+			if limitErr.Limit != tt.wantLimit {
+				t.Errorf("Limit = %q, want %q", limitErr.Limit, tt.wantLimit)
+			}
+			if !strings.HasPrefix(err.Error(), path+": ") {
+				t.Errorf("error %q does not name %s", err, path)
+			}
+		})
+	}
+}
+
+func TestGetImageInfoLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.png")
+	writeTestPNG(t, path, 64, 32)
+
+	tests := []struct {
+		name      string
+		options   InfoOptions
+		wantError bool
+	}{
+		{"no limits", InfoOptions{}, false},
+		{"within the file size", InfoOptions{Limits: DefaultLimits()}, false},
+		{"over the file size", InfoOptions{Limits: Limits{MaxFileSize: 10}}, true},
+		{"over the pixels", InfoOptions{CheckAlpha: true, Limits: Limits{MaxPixels: 10}}, false}, // Only not decoded
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := GetImageInfoWithOptions(path, tt.options)
+			if tt.wantError {
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("GetImageInfoWithOptions() = %v, %v, want a limit error", info, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetImageInfoWithOptions() error = %v", err)
+			}
+			if info.Width != 64 || info.Height != 32 {
+				t.Errorf("info is %dx%d, want 64x32", info.Width, info.Height)
+			}
+		})
+	}
+}
+
+func TestScanAPNGFrames(t *testing.T) {
+	static := []pngChunk{
+		{"IHDR", testIHDR(4, 4, false)},
+		{"IDAT", testDeflate(t, testScanlines(4, 4, 0))},
+		{"IEND", nil},
+	}
+	truncated := encodeTestPNG(testAPNG(t, nil, nil))
+	truncated = truncated[:bytes.LastIndex(truncated, []byte("fcTL"))+10]
+	short := testAPNG(t, nil, nil)
+	short[2].Data = short[2].Data[:8]
+
+	tests := []struct {
+		name         string
+		data         []byte
+		wantDeclared int
+		wantSizes    int
+		wantError    bool
+	}{
+		{"static", encodeTestPNG(static), 0, 0, false},
+		{"animated", encodeTestPNG(testAPNG(t, nil, nil)), 2, 2, false},
+		{"truncated", truncated, 2, 1, false},
+		{"short frame control", encodeTestPNG(short), 0, 0, true},
+		{"not a png", []byte("GIF89a"), 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.png")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			declared, sizes, err := scanAPNGFrames(file)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("scanAPNGFrames() error = %v, wantError %v", err, tt.wantError)
+			}
+			if declared != tt.wantDeclared || len(sizes) != tt.wantSizes {
+				t.Errorf("scanAPNGFrames() = %d, %v, want %d declared and %d sizes", declared, sizes, tt.wantDeclared, tt.wantSizes)
+			}
+		})
+	}
+}
+
+// pngData returns a generator of a blank PNG of the given size
+func pngData(width, height int) func(t *testing.T) []byte {
+	return func(t *testing.T) []byte {
+		path := filepath.Join(t.TempDir(), "blank.png")
+		writeTestPNG(t, path, width, height)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+}
+
+// apngData returns a generator of an encoded PNG stream
+func apngData(chunks []pngChunk) func(t *testing.T) []byte {
+	return func(*testing.T) []byte {
+		return encodeTestPNG(chunks)
+	}
+}
+
+// tiffData returns a generator of a TIFF with pages identical 4x4 pages
+func tiffData(pages int) func(t *testing.T) []byte {
+	return func(t *testing.T) []byte {
+		return testTIFF(t, pages)
+	}
+}
+
+// testTIFF encodes a 4x4 grayscale TIFF and chains copies of its image
+// directory, all pointing at the same strip, into the given number of pages
+func testTIFF(t *testing.T, pages int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	order := binary.ByteOrder(binary.LittleEndian)
+	if string(data[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+	ifd := order.Uint32(data[4:])
+	entries := data[ifd : ifd+2+12*uint32(order.Uint16(data[ifd:]))]
+
+	last := ifd
+	for page := 1; page < pages; page++ {
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+		next := uint32(len(data))
+		order.PutUint32(data[last+uint32(len(entries)):], next)
+		data = append(data, entries...)
+		data = append(data, 0, 0, 0, 0)
+		last = next
+	}
+	return data
+}
+
+func svgData(*testing.T) []byte {
+	return []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="100000" height="100000"/>`)
+}
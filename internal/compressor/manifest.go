@@ -0,0 +1,238 @@
+package compressor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestName is the file a manifest is kept in, inside the output directory
+const ManifestName = ".imgshrink-manifest.json"
+
+// manifestVersion changes when entries written by older versions must be redone
+const manifestVersion = 2
+
+// manifestSaveInterval is how often Record writes the manifest during a run,
+// so an interrupted run keeps most of what it finished
+const manifestSaveInterval = 5 * time.Second
+
+// ManifestEntry records the source its outputs were produced from
+type ManifestEntry struct {
+	Size        int64            `json:"size"`
+	ModTime     time.Time        `json:"modTime"`
+	Hash        string           `json:"hash"`    // SHA-256 of the source
+	Options     string           `json:"options"` // OptionsFingerprint of the run
+	Outputs     []ManifestOutput `json:"outputs"` // One per page of split multi-page inputs
+	Placeholder *Placeholder     `json:"placeholder,omitempty"`
+	CompletedAt time.Time        `json:"completedAt"`
+}
+
+// ManifestOutput is a file written for a manifest entry
+type ManifestOutput struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash"` // SHA-256 of the output
+}
+
+// Manifest maps source paths to their outputs so later runs can skip inputs
+// that have not changed. It is safe for concurrent use.
+type Manifest struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]ManifestEntry // By absolute source path
+	dirty   bool
+	saved   time.Time
+}
+
+type manifestFile struct {
+	Version int                      `json:"version"`
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+// OpenManifest loads the manifest of an output directory, or starts an empty
+// one when there is none yet
+func OpenManifest(outputDir string) (*Manifest, error) {
+	m := &Manifest{
+		path:    filepath.Join(outputDir, ManifestName),
+		entries: make(map[string]ManifestEntry),
+		saved:   time.Now(),
+	}
+
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var file manifestFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", m.path, err)
+	}
+	if file.Version == manifestVersion && file.Entries != nil {
+		m.entries = file.Entries
+	}
+	return m, nil
+}
+
+// Path returns the location of the manifest file
+func (m *Manifest) Path() string {
+	return m.path
+}
+
+// Outputs returns the absolute path of every recorded output
+func (m *Manifest) Outputs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	outputs := make([]string, 0, len(m.entries))
+	for _, entry := range m.entries {
+		for _, output := range entry.Outputs {
+			outputs = append(outputs, output.Path)
+		}
+	}
+	return outputs
+}
+
+// Unchanged reports whether inputPath was already compressed with the same
+// options and neither it nor any of its outputs has changed since. Files
+// whose size and modification time match are trusted without hashing.
+func (m *Manifest) Unchanged(inputPath string, options CompressionOptions) (ManifestEntry, bool) {
+	m.mu.Lock()
+	entry, ok := m.entries[absPath(inputPath)]
+	m.mu.Unlock()
+	if !ok || len(entry.Outputs) == 0 || entry.Options != OptionsFingerprint(options) {
+		return entry, false
+	}
+
+	for _, output := range entry.Outputs {
+		if !unchangedFile(output.Path, output.Size, output.ModTime, output.Hash) {
+			return entry, false
+		}
+	}
+	return entry, unchangedFile(inputPath, entry.Size, entry.ModTime, entry.Hash)
+}
+
+// unchangedFile reports whether a file still has the given size and content,
+// hashing it only when it was touched since
+func unchangedFile(path string, size int64, modTime time.Time, hash string) bool {
+	stat, err := os.Stat(path)
+	if err != nil || stat.Size() != size {
+		return false
+	}
+	if stat.ModTime().Equal(modTime) {
+		return true
+	}
+	current, err := hashFile(path)
+	return err == nil && current == hash
+}
+
+// Record stores the outputs a successful result wrote for inputPath, every
+// page of a split multi-page input included. The manifest is saved when the
+// last save is a while ago.
+func (m *Manifest) Record(inputPath string, result *CompressionResult, options CompressionOptions) error {
+	stat, err := os.Stat(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get input file info: %w", err)
+	}
+	hash, err := hashFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	paths := []string{result.OutputPath}
+	if len(result.Pages) > 0 {
+		paths = paths[:0]
+		for _, page := range result.Pages {
+			paths = append(paths, page.OutputPath)
+		}
+	}
+	entry := ManifestEntry{
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		Hash:        hash,
+		Options:     OptionsFingerprint(options),
+		Placeholder: result.Placeholder,
+		CompletedAt: time.Now(),
+	}
+	for _, path := range paths {
+		outputStat, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to get output file info: %w", err)
+		}
+		outputHash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		entry.Outputs = append(entry.Outputs, ManifestOutput{
+			Path:    absPath(path),
+			Size:    outputStat.Size(),
+			ModTime: outputStat.ModTime(),
+			Hash:    outputHash,
+		})
+	}
+
+	m.mu.Lock()
+	m.entries[absPath(inputPath)] = entry
+	m.dirty = true
+	due := time.Since(m.saved) >= manifestSaveInterval
+	m.mu.Unlock()
+
+	if due {
+		return m.Save()
+	}
+	return nil
+}
+
+// Save writes the manifest atomically when it has changed
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(manifestFile{Version: manifestVersion, Entries: m.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if _, err := writeFile(m.path, append(data, '\n'), "", nil); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	m.dirty = false
+	m.saved = time.Now()
+	return nil
+}
+
+// OptionsFingerprint hashes the options that affect what is written or
+// reported, placeholders included, so a manifest entry is redone when any of
+// them changes. Scheduling, limits, journaling and the handling of existing
+// outputs are left out.
+func OptionsFingerprint(options CompressionOptions) string {
+	options.InPlace = false
+	options.BackupDir = ""
+	options.Journal = nil
+	options.Manifest = nil
+	options.Tags = nil
+	options.Force = false
+	options.IfExists = ExistingOverwrite
+	options.Limits = Limits{}
+	options.Workers = 0
+	options.MemoryBudget = 0
+	options.LargestFirst = false
+
+	data, _ := json.Marshal(options)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
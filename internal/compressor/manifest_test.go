@@ -0,0 +1,166 @@
+package compressor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestManifestUnchanged(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		pages  int
+		change func(t *testing.T, input string, outputs []string, options *CompressionOptions)
+		want   bool
+	}{
+		{"unchanged", 1, nil, true},
+		{"source touched", 1, func(t *testing.T, input string, _ []string, _ *CompressionOptions) {
+			touch(t, input, later)
+		}, true},
+		{"source modified", 1, func(t *testing.T, input string, _ []string, _ *CompressionOptions) {
+			writeTestFile(t, input, "SOURCE")
+		}, false},
+		{"output touched", 1, func(t *testing.T, _ string, outputs []string, _ *CompressionOptions) {
+			touch(t, outputs[0], later)
+		}, true},
+		{"output modified", 1, func(t *testing.T, _ string, outputs []string, _ *CompressionOptions) {
+			writeTestFile(t, outputs[0], "OUTPUT-1")
+			touch(t, outputs[0], later)
+		}, false},
+		{"output removed", 1, func(t *testing.T, _ string, outputs []string, _ *CompressionOptions) {
+			os.Remove(outputs[0])
+		}, false},
+		{"later page removed", 3, func(t *testing.T, _ string, outputs []string, _ *CompressionOptions) {
+			os.Remove(outputs[2])
+		}, false},
+		{"quality changed", 1, func(_ *testing.T, _ string, _ []string, options *CompressionOptions) {
+			options.Quality = 70
+		}, false},
+		{"placeholder enabled", 1, func(_ *testing.T, _ string, _ []string, options *CompressionOptions) {
+			options.Placeholder = true
+		}, false},
+		{"workers changed", 1, func(_ *testing.T, _ string, _ []string, options *CompressionOptions) {
+			options.Workers = 16
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "photo.tif")
+			writeTestFile(t, input, "source")
+
+			result := &CompressionResult{InputPath: input, Success: true}
+			var outputs []string
+			for i := 1; i <= tt.pages; i++ {
+				output := filepath.Join(dir, "out", "photo_"+strconv.Itoa(i)+".jpg")
+				writeTestFile(t, output, "output-"+strconv.Itoa(i))
+				outputs = append(outputs, output)
+				if tt.pages > 1 {
+					result.Pages = append(result.Pages, &CompressionResult{OutputPath: output})
+				}
+			}
+			result.OutputPath = outputs[0]
+
+			options := DefaultOptions()
+			manifest, err := OpenManifest(filepath.Join(dir, "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := manifest.Record(input, result, options); err != nil {
+				t.Fatalf("Record() error = %v", err)
+			}
+			if got := len(manifest.Outputs()); got != tt.pages {
+				t.Errorf("Outputs() has %d paths, want %d", got, tt.pages)
+			}
+
+			if tt.change != nil {
+				tt.change(t, input, outputs, &options)
+			}
+			if _, got := manifest.Unchanged(input, options); got != tt.want {
+				t.Errorf("Unchanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestSave(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.jpg")
+	output := filepath.Join(dir, "out", "photo.jpg")
+	writeTestFile(t, input, "source")
+	writeTestFile(t, output, "output")
+
+	options := DefaultOptions()
+	options.Placeholder = true
+	placeholder := &Placeholder{BlurHash: "LEHV6nWB2yk8", DominantColor: "#7f7f7f"}
+
+	manifest, err := OpenManifest(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &CompressionResult{OutputPath: output, Placeholder: placeholder, Success: true}
+	if err := manifest.Record(input, result, options); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reopened, err := OpenManifest(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := reopened.Unchanged(input, options)
+	if !ok {
+		t.Fatal("Unchanged() = false after reopening")
+	}
+	if entry.Placeholder == nil || *entry.Placeholder != *placeholder {
+		t.Errorf("Placeholder = %+v, want %+v", entry.Placeholder, placeholder)
+	}
+}
+
+func TestManifestSavesDuringRun(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.jpg")
+	output := filepath.Join(dir, "out", "photo.jpg")
+	writeTestFile(t, input, "source")
+	writeTestFile(t, output, "output")
+
+	manifest, err := OpenManifest(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.saved = time.Now().Add(-manifestSaveInterval)
+
+	result := &CompressionResult{OutputPath: output, Success: true}
+	if err := manifest.Record(input, result, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(manifest.Path()); err != nil {
+		t.Errorf("manifest not saved by Record: %v", err)
+	}
+}
+
+// writeTestFile writes content to path, creating its directory
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// touch sets the modification time of path
+func touch(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
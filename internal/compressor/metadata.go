@@ -0,0 +1,517 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxICCProfileSize bounds the embedded color profiles that are inflated to
+// read their description; real profiles stay well below it
+const maxICCProfileSize = 4 << 20
+
+// EXIFInfo holds the EXIF fields worth showing at a glance
+type EXIFInfo struct {
+	Make        string `json:"make,omitempty"`
+	Model       string `json:"model,omitempty"`
+	DateTime    string `json:"dateTime,omitempty"`    // DateTimeOriginal, falling back to DateTime
+	Orientation int    `json:"orientation,omitempty"` // 1-8, 0 when absent
+	HasGPS      bool   `json:"hasGPS"`
+}
+
+// Camera returns the make and model, without the make repeated in the model
+func (e *EXIFInfo) Camera() string {
+	if strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(e.Make)) {
+		return e.Model
+	}
+	return strings.TrimSpace(e.Make + " " + e.Model)
+}
+
+// inspectImage fills the format-specific details of info from the file data
+func inspectImage(data []byte, info *ImageInfo) {
+	switch info.Format {
+	case FormatJPEG:
+		inspectJPEG(data, info)
+	case FormatPNG:
+		inspectPNG(data, info)
+	case FormatTIFF:
+		inspectTIFF(data, info)
+	case FormatBMP:
+		inspectBMP(data, info)
+	case FormatQOI:
+		inspectQOI(data, info)
+	}
+}
+
+// inspectJPEG walks the JPEG marker segments up to the first scan
+func inspectJPEG(data []byte, info *ImageInfo) {
+	var icc []byte
+	var components [][3]byte // id, horizontal and vertical sampling factors
+	adobeTransform := -1
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill byte
+			i++
+			continue
+		}
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD8 {
+			// Markers without a length
+			i += 2
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+
+		switch {
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			// Start of frame; C2, C6, CA and CE are progressive
+			info.Progressive = marker&0x03 == 0x02
+			if len(segment) < 6 {
+				break
+			}
+			info.BitDepth = int(segment[0])
+			count := int(segment[5])
+			for c := 0; c < count && 6+3*c+3 <= len(segment); c++ {
+				sampling := segment[6+3*c+1]
+				components = append(components, [3]byte{segment[6+3*c], sampling >> 4, sampling & 0x0F})
+			}
+		case marker == 0xE0 && bytes.HasPrefix(segment, []byte("JFIF\x00")) && len(segment) >= 12:
+			setDensity(info, segment[7], float64(binary.BigEndian.Uint16(segment[8:])), float64(binary.BigEndian.Uint16(segment[10:])))
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			parseEXIF(segment[6:], info)
+		case marker == 0xE2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")) && len(segment) > 14:
+			// Profiles larger than a segment are split into numbered chunks
+			icc = append(icc, segment[14:]...)
+		case marker == 0xEE && bytes.HasPrefix(segment, []byte("Adobe")) && len(segment) >= 12:
+			adobeTransform = int(segment[11])
+		}
+
+		i += 2 + length
+	}
+
+	switch len(components) {
+	case 1:
+		info.ColorMode = "Gray"
+	case 3:
+		info.ColorMode = "YCbCr"
+		if adobeTransform == 0 || components[0][0] == 'R' && components[1][0] == 'G' && components[2][0] == 'B' {
+			info.ColorMode = "RGB"
+		}
+		info.ChromaSubsampling = chromaSubsampling(components)
+	case 4:
+		info.ColorMode = "CMYK"
+		if adobeTransform == 2 {
+			info.ColorMode = "YCCK"
+		}
+	}
+
+	if len(icc) > 0 {
+		info.ICCProfile = iccDescription(icc)
+	}
+
+	info.Quality = estimateJPEGQuality(data)
+}
+
+// chromaSubsampling names the J:a:b ratio of a three-component JPEG frame
+func chromaSubsampling(components [][3]byte) string {
+	luma, chroma := components[0], components[1]
+	if chroma[1] == 0 || chroma[2] == 0 {
+		return ""
+	}
+	h, v := luma[1]/chroma[1], luma[2]/chroma[2]
+	switch {
+	case h == 1 && v == 1:
+		return "4:4:4"
+	case h == 2 && v == 1:
+		return "4:2:2"
+	case h == 2 && v == 2:
+		return "4:2:0"
+	case h == 1 && v == 2:
+		return "4:4:0"
+	case h == 4 && v == 1:
+		return "4:1:1"
+	default:
+		return fmt.Sprintf("%dx%d", h, v)
+	}
+}
+
+// inspectPNG reads IHDR and the ancillary chunks
+func inspectPNG(data []byte, info *ImageInfo) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return
+	}
+
+	for _, chunk := range chunks {
+		info.Chunks = append(info.Chunks, chunk.Type)
+
+		switch chunk.Type {
+		case "IHDR":
+			if len(chunk.Data) < 13 {
+				break
+			}
+			info.BitDepth = int(chunk.Data[8])
+			switch chunk.Data[9] {
+			case 0:
+				info.ColorMode = "Gray"
+			case 2:
+				info.ColorMode = "RGB"
+			case 3:
+				info.ColorMode = "Indexed"
+			case 4:
+				info.ColorMode = "GrayA"
+				info.HasAlpha = true
+			case 6:
+				info.ColorMode = "RGBA"
+				info.HasAlpha = true
+			}
+			info.Progressive = chunk.Data[12] == 1
+		case "tRNS":
+			info.HasAlpha = true
+		case "pHYs":
+			if len(chunk.Data) >= 9 && chunk.Data[8] == 1 {
+				// Pixels per meter
+				info.DPIX = float64(binary.BigEndian.Uint32(chunk.Data)) * 0.0254
+				info.DPIY = float64(binary.BigEndian.Uint32(chunk.Data[4:])) * 0.0254
+			}
+		case "iCCP":
+			name, compressed, ok := bytes.Cut(chunk.Data, []byte{0})
+			if !ok || len(compressed) < 1 {
+				break
+			}
+			info.ICCProfile = string(name)
+			if profile, err := inflateLimited(compressed[1:], maxICCProfileSize); err == nil {
+				if desc := iccDescription(profile); desc != "" {
+					info.ICCProfile = desc
+				}
+			}
+		case "sRGB":
+			if info.ICCProfile == "" {
+				info.ICCProfile = "sRGB"
+			}
+		case "eXIf":
+			parseEXIF(chunk.Data, info)
+		}
+	}
+}
+
+// inspectTIFF reads the tags of the first image directory
+func inspectTIFF(data []byte, info *ImageInfo) {
+	r, offset, ok := newTIFFReader(data)
+	if !ok {
+		return
+	}
+	ifd := r.ifd(offset)
+
+	bits, _ := ifd.uint(r, 0x0102)
+	samples, ok := ifd.uint(r, 0x0115)
+	if !ok {
+		samples = 1
+	}
+	info.BitDepth = int(bits)
+	if info.BitDepth == 0 {
+		info.BitDepth = 1
+	}
+	if extra, ok := ifd.uint(r, 0x0152); ok && (extra == 1 || extra == 2) {
+		info.HasAlpha = true
+	}
+
+	photometric, _ := ifd.uint(r, 0x0106)
+	switch photometric {
+	case 0, 1:
+		info.ColorMode = "Gray"
+		if info.HasAlpha {
+			info.ColorMode = "GrayA"
+		}
+	case 2:
+		info.ColorMode = "RGB"
+		if info.HasAlpha {
+			info.ColorMode = "RGBA"
+		}
+	case 3:
+		info.ColorMode = "Indexed"
+	case 5:
+		info.ColorMode = "CMYK"
+	case 6:
+		info.ColorMode = "YCbCr"
+	default:
+		info.ColorMode = fmt.Sprintf("%d samples", samples)
+	}
+
+	if profile, ok := ifd[0x8773]; ok {
+		info.ICCProfile = iccDescription(r.value(profile))
+	}
+
+	exifFromIFD(r, ifd, info)
+}
+
+// inspectBMP reads the bitmap info header
+func inspectBMP(data []byte, info *ImageInfo) {
+	if len(data) < 46 {
+		return
+	}
+	bpp := int(binary.LittleEndian.Uint16(data[28:]))
+	switch {
+	case bpp <= 8:
+		info.ColorMode = "Indexed"
+		info.BitDepth = bpp
+	case bpp == 32:
+		info.ColorMode = "RGBA"
+		info.BitDepth = 8
+		info.HasAlpha = true
+	default:
+		info.ColorMode = "RGB"
+		info.BitDepth = 8
+		if bpp == 16 {
+			info.BitDepth = 5
+		}
+	}
+
+	// Pixels per meter
+	x := int32(binary.LittleEndian.Uint32(data[38:]))
+	y := int32(binary.LittleEndian.Uint32(data[42:]))
+	if x > 0 && y > 0 {
+		info.DPIX = float64(x) * 0.0254
+		info.DPIY = float64(y) * 0.0254
+	}
+}
+
+// inspectQOI reads the QOI header
+func inspectQOI(data []byte, info *ImageInfo) {
+	if len(data) < 14 {
+		return
+	}
+	info.BitDepth = 8
+	info.ColorMode = "RGB"
+	if data[12] == 4 {
+		info.ColorMode = "RGBA"
+		info.HasAlpha = true
+	}
+}
+
+// setDensity records a JFIF-style density, units 1 = per inch, 2 = per cm
+func setDensity(info *ImageInfo, units byte, x, y float64) {
+	switch units {
+	case 1:
+		info.DPIX, info.DPIY = x, y
+	case 2:
+		info.DPIX, info.DPIY = x*2.54, y*2.54
+	}
+}
+
+// parseEXIF reads the EXIF highlights from a TIFF-structured EXIF block
+func parseEXIF(data []byte, info *ImageInfo) {
+	r, offset, ok := newTIFFReader(data)
+	if !ok {
+		return
+	}
+	exifFromIFD(r, r.ifd(offset), info)
+}
+
+// exifFromIFD reads EXIF highlights and resolution from an IFD0
+func exifFromIFD(r *tiffReader, ifd tiffIFD, info *ImageInfo) {
+	exif := &EXIFInfo{
+		Make:     ifd.ascii(r, 0x010F),
+		Model:    ifd.ascii(r, 0x0110),
+		DateTime: ifd.ascii(r, 0x0132),
+	}
+	if orientation, ok := ifd.uint(r, 0x0112); ok {
+		exif.Orientation = int(orientation)
+	}
+	if offset, ok := ifd.uint(r, 0x8769); ok {
+		if original := r.ifd(offset).ascii(r, 0x9003); original != "" {
+			exif.DateTime = original
+		}
+	}
+	if offset, ok := ifd.uint(r, 0x8825); ok && len(r.ifd(offset)) > 0 {
+		exif.HasGPS = true
+	}
+
+	if *exif != (EXIFInfo{}) {
+		info.EXIF = exif
+	}
+
+	// Resolution, unless the container already declared one
+	if info.DPIX == 0 {
+		x, y := ifd.rational(r, 0x011A), ifd.rational(r, 0x011B)
+		unit, ok := ifd.uint(r, 0x0128)
+		if !ok {
+			unit = 2
+		}
+		setDensity(info, byte(unit-1), x, y)
+	}
+}
+
+// tiffReader reads tags from TIFF-structured data such as TIFF files and
+// EXIF blocks
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// tiffEntry is one IFD entry; the value is inline when it fits in four bytes
+type tiffEntry struct {
+	typ    uint16
+	count  uint32
+	offset int // Position of the value in data
+}
+
+type tiffIFD map[uint16]tiffEntry
+
+// tiffTypeSizes maps TIFF field types to their size in bytes
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+func newTIFFReader(data []byte) (*tiffReader, uint32, bool) {
+	if len(data) < 8 {
+		return nil, 0, false
+	}
+	r := &tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if r.order.Uint16(data[2:]) != 42 {
+		return nil, 0, false
+	}
+	return r, r.order.Uint32(data[4:]), true
+}
+
+// ifd reads the directory at offset, returning an empty one when out of range
+func (r *tiffReader) ifd(offset uint32) tiffIFD {
+	ifd := make(tiffIFD)
+	if int64(offset)+2 > int64(len(r.data)) {
+		return ifd
+	}
+	count := int(r.order.Uint16(r.data[offset:]))
+	for i := 0; i < count; i++ {
+		pos := int(offset) + 2 + 12*i
+		if pos+12 > len(r.data) {
+			break
+		}
+		entry := tiffEntry{
+			typ:    r.order.Uint16(r.data[pos+2:]),
+			count:  r.order.Uint32(r.data[pos+4:]),
+			offset: pos + 8,
+		}
+		if int64(tiffTypeSizes[entry.typ])*int64(entry.count) > 4 {
+			entry.offset = int(r.order.Uint32(r.data[pos+8:]))
+		}
+		ifd[r.order.Uint16(r.data[pos:])] = entry
+	}
+	return ifd
+}
+
+// value returns the raw bytes of an entry, nil when out of range
+func (r *tiffReader) value(entry tiffEntry) []byte {
+	size := int64(tiffTypeSizes[entry.typ]) * int64(entry.count)
+	if entry.offset < 0 || int64(entry.offset)+size > int64(len(r.data)) {
+		return nil
+	}
+	return r.data[entry.offset : int64(entry.offset)+size]
+}
+
+// uint returns the first value of a SHORT or LONG entry
+func (ifd tiffIFD) uint(r *tiffReader, tag uint16) (uint32, bool) {
+	entry, ok := ifd[tag]
+	if !ok || entry.count == 0 {
+		return 0, false
+	}
+	value := r.value(entry)
+	switch {
+	case entry.typ == 3 && len(value) >= 2:
+		return uint32(r.order.Uint16(value)), true
+	case entry.typ == 4 && len(value) >= 4:
+		return r.order.Uint32(value), true
+	}
+	return 0, false
+}
+
+// ascii returns an ASCII entry without its trailing NUL and padding
+func (ifd tiffIFD) ascii(r *tiffReader, tag uint16) string {
+	entry, ok := ifd[tag]
+	if !ok || entry.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(r.value(entry)), "\x00"))
+}
+
+// rational returns the first value of a RATIONAL entry
+func (ifd tiffIFD) rational(r *tiffReader, tag uint16) float64 {
+	entry, ok := ifd[tag]
+	if !ok || entry.typ != 5 {
+		return 0
+	}
+	value := r.value(entry)
+	if len(value) < 8 {
+		return 0
+	}
+	denominator := r.order.Uint32(value[4:])
+	if denominator == 0 {
+		return 0
+	}
+	return float64(r.order.Uint32(value)) / float64(denominator)
+}
+
+// iccDescription returns the profile description tag of an ICC profile
+func iccDescription(profile []byte) string {
+	if len(profile) < 132 {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count && 132+12*(i+1) <= len(profile); i++ {
+		entry := profile[132+12*i:]
+		if string(entry[:4]) != "desc" {
+			continue
+		}
+		offset := int64(binary.BigEndian.Uint32(entry[4:]))
+		size := int64(binary.BigEndian.Uint32(entry[8:]))
+		if size < 12 || offset+size > int64(len(profile)) {
+			return ""
+		}
+		tag := profile[offset : offset+size]
+
+		switch string(tag[:4]) {
+		case "desc":
+			// ICC v2 textDescriptionType
+			n := int64(binary.BigEndian.Uint32(tag[8:]))
+			if 12+n <= int64(len(tag)) {
+				return strings.TrimRight(string(tag[12:12+n]), "\x00")
+			}
+		case "mluc":
+			// ICC v4 multiLocalizedUnicodeType, first record
+			if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:]) == 0 {
+				return ""
+			}
+			n := int64(binary.BigEndian.Uint32(tag[20:]))
+			start := int64(binary.BigEndian.Uint32(tag[24:]))
+			if start+n > int64(len(tag)) {
+				return ""
+			}
+			units := make([]uint16, n/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(tag[start+int64(2*j):])
+			}
+			return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetImageInfo(t *testing.T) {
+	// RGBA images whose alpha is 0xFF or 0 everywhere
+	rgba := func(value byte) []byte {
+		return encodeTestPNG([]pngChunk{
+			{"IHDR", testIHDR(8, 8, false)},
+			{"IDAT", testDeflate(t, testScanlines(8, 8, value))},
+			{"IEND", nil},
+		})
+	}
+	opaque, transparent := rgba(0xFF), rgba(0)
+	var gray bytes.Buffer
+	if err := png.Encode(&gray, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		options     InfoOptions
+		wantMode    string
+		wantAlpha   bool
+		wantChecked bool
+		wantUsed    bool
+	}{
+		{"headers only", transparent, InfoOptions{}, "RGBA", true, false, false},
+		{"transparent", transparent, InfoOptions{CheckAlpha: true}, "RGBA", true, true, true},
+		{"opaque", opaque, InfoOptions{CheckAlpha: true}, "RGBA", true, true, false},
+		{"beyond limits", transparent, InfoOptions{CheckAlpha: true, Limits: Limits{MaxPixels: 10}}, "RGBA", true, false, false},
+		{"no alpha channel", gray.Bytes(), InfoOptions{CheckAlpha: true}, "Gray", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.png")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := GetImageInfoWithOptions(path, tt.options)
+			if err != nil {
+				t.Fatalf("GetImageInfoWithOptions() error = %v", err)
+			}
+			if info.Width != 8 || info.Height != 8 || info.Format != FormatPNG || info.Frames != 1 {
+				t.Errorf("info = %+v, want an 8x8 PNG", info)
+			}
+			if info.ColorMode != tt.wantMode || info.HasAlpha != tt.wantAlpha {
+				t.Errorf("ColorMode, HasAlpha = %q, %v, want %q, %v", info.ColorMode, info.HasAlpha, tt.wantMode, tt.wantAlpha)
+			}
+			if info.AlphaChecked != tt.wantChecked || info.AlphaUsed != tt.wantUsed {
+				t.Errorf("AlphaChecked, AlphaUsed = %v, %v, want %v, %v", info.AlphaChecked, info.AlphaUsed, tt.wantChecked, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestInspectJPEG(t *testing.T) {
+	img := image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &ImageInfo{Format: FormatJPEG}
+	inspectImage(buf.Bytes(), info)
+	if info.ColorMode != "YCbCr" || info.ChromaSubsampling != "4:2:0" {
+		t.Errorf("ColorMode, ChromaSubsampling = %q, %q, want YCbCr, 4:2:0", info.ColorMode, info.ChromaSubsampling)
+	}
+	if info.Quality != 80 {
+		t.Errorf("Quality = %d, want 80", info.Quality)
+	}
+}
+
+func TestInspectPNGChunks(t *testing.T) {
+	phys := []byte{0, 0, 0x0B, 0x13, 0, 0, 0x0B, 0x13, 1} // 2835 px/m, about 72 DPI
+	data := encodeTestPNG([]pngChunk{
+		{"IHDR", testIHDR(1, 1, true)},
+		{"pHYs", phys},
+		{"sRGB", []byte{0}},
+		{"IDAT", testDeflate(t, testScanlines(1, 1, 0))},
+		{"IEND", nil},
+	})
+
+	info := &ImageInfo{}
+	inspectPNG(data, info)
+	if want := []string{"IHDR", "pHYs", "sRGB", "IDAT", "IEND"}; len(info.Chunks) != len(want) {
+		t.Errorf("Chunks = %v, want %v", info.Chunks, want)
+	}
+	if !info.Progressive || info.BitDepth != 8 || info.ColorMode != "RGBA" {
+		t.Errorf("info = %+v, want interlaced 8-bit RGBA", info)
+	}
+	if info.DPIX < 71.9 || info.DPIX > 72.1 || info.ICCProfile != "sRGB" {
+		t.Errorf("DPIX, ICCProfile = %v, %q, want 72, sRGB", info.DPIX, info.ICCProfile)
+	}
+}
+
+func TestInspectPNGICCBomb(t *testing.T) {
+	iccp := append([]byte("bomb\x00\x00"), testDeflate(t, make([]byte, maxICCProfileSize+1))...)
+	data := encodeTestPNG([]pngChunk{
+		{"IHDR", testIHDR(1, 1, false)},
+		{"iCCP", iccp},
+		{"IDAT", testDeflate(t, testScanlines(1, 1, 0))},
+		{"IEND", nil},
+	})
+
+	info := &ImageInfo{}
+	inspectPNG(data, info)
+	if info.ICCProfile != "bomb" {
+		t.Errorf("ICCProfile = %q, want the profile name", info.ICCProfile)
+	}
+}
+
+func TestChromaSubsampling(t *testing.T) {
+	tests := []struct {
+		luma [3]byte
+		want string
+	}{
+		{[3]byte{1, 1, 1}, "4:4:4"},
+		{[3]byte{1, 2, 1}, "4:2:2"},
+		{[3]byte{1, 2, 2}, "4:2:0"},
+		{[3]byte{1, 1, 2}, "4:4:0"},
+		{[3]byte{1, 4, 1}, "4:1:1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			chroma := [3]byte{2, 1, 1}
+			if got := chromaSubsampling([][3]byte{tt.luma, chroma, chroma}); got != tt.want {
+				t.Errorf("chromaSubsampling() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
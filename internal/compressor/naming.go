@@ -0,0 +1,425 @@
+package compressor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateFields are the placeholders an output template may use
+var templateFields = map[string]bool{
+	"dir":    true, // Directory of the input
+	"name":   true, // Input file name without extension
+	"ext":    true, // Output extension without the dot
+	"fmt":    true, // Output format
+	"suffix": true, // OutputSuffix
+	"w":      true, // Output width in pixels
+	"h":      true, // Output height in pixels
+	"q":      true, // JPEG quality, or PNG compression level
+	"hash":   true, // SHA-256 of the output; {hash:N} keeps N hex digits
+	"date":   true, // EXIF capture date, or modification date, as YYYY-MM-DD
+	"rel":    true, // Input directory relative to SourceRoot
+}
+
+// templatePart is a literal or a placeholder of a parsed template
+type templatePart struct {
+	literal string
+	field   string
+	length  int // Digits kept of {hash:N}, 0 means all
+}
+
+// ValidateTemplate checks an output template for unknown placeholders and
+// malformed braces, so a bad template fails before any file is processed
+func ValidateTemplate(template string) error {
+	_, err := parseTemplate(template)
+	return err
+}
+
+func parseTemplate(template string) ([]templatePart, error) {
+	var parts []templatePart
+	var named bool
+
+	for rest := template; rest != ""; {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			parts = append(parts, templatePart{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("invalid output template %q: unmatched }", template)
+		}
+		if open > 0 {
+			parts = append(parts, templatePart{literal: rest[:open]})
+		}
+
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end < 0 || rest[open+1+end] != '}' {
+			return nil, fmt.Errorf("invalid output template %q: unclosed {", template)
+		}
+		field, arg, hasArg := strings.Cut(rest[open+1:open+1+end], ":")
+		if !templateFields[field] {
+			return nil, fmt.Errorf("invalid output template %q: unknown placeholder {%s}", template, field)
+		}
+
+		part := templatePart{field: field}
+		if hasArg {
+			if field != "hash" {
+				return nil, fmt.Errorf("invalid output template %q: {%s} takes no argument", template, field)
+			}
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > 2*sha256.Size {
+				return nil, fmt.Errorf("invalid output template %q: hash length must be 1-%d", template, 2*sha256.Size)
+			}
+			part.length = n
+		}
+		if field == "name" || field == "hash" {
+			named = true
+		}
+		parts = append(parts, part)
+		rest = rest[open+1+end+1:]
+	}
+
+	if !named {
+		return nil, fmt.Errorf("invalid output template %q: needs {name} or {hash} to tell outputs apart", template)
+	}
+	return parts, nil
+}
+
+// encodedOutput describes the data about to be written for an input
+type encodedOutput struct {
+	data          []byte
+	width, height int
+}
+
+// expandTemplate renders the output path for inputPath. Without an encoded
+// output, the input's dimensions and content stand in for {w}, {h} and {hash}.
+func expandTemplate(inputPath string, format ImageFormat, options CompressionOptions, output *encodedOutput) (string, error) {
+	parts, err := parseTemplate(options.OutputTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, part := range parts {
+		if part.field == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		value, err := templateValue(part, inputPath, format, options, output)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+	}
+
+	path := filepath.Clean(b.String())
+	if options.OutputDir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(options.OutputDir, path)
+	}
+	return path, nil
+}
+
+func templateValue(part templatePart, inputPath string, format ImageFormat, options CompressionOptions, output *encodedOutput) (string, error) {
+	ext := filepath.Ext(inputPath)
+
+	switch part.field {
+	case "dir":
+		return filepath.Dir(inputPath), nil
+
+	case "name":
+		return strings.TrimSuffix(filepath.Base(inputPath), ext), nil
+
+	case "ext":
+		return strings.TrimPrefix(outputExtension(inputPath, format), "."), nil
+
+	case "fmt":
+		if format == "" || format == FormatAuto {
+			inputFormat, err := GetImageFormat(inputPath)
+			if err != nil {
+				return "", err
+			}
+			return string(inputFormat), nil
+		}
+		return string(format), nil
+
+	case "suffix":
+		return options.OutputSuffix, nil
+
+	case "w", "h":
+		width, height, err := templateDimensions(inputPath, output)
+		if err != nil {
+			return "", err
+		}
+		if part.field == "w" {
+			return strconv.Itoa(width), nil
+		}
+		return strconv.Itoa(height), nil
+
+	case "q":
+		if format == FormatPNG {
+			return strconv.Itoa(options.CompressionLevel), nil
+		}
+		return strconv.Itoa(options.Quality), nil
+
+	case "hash":
+		data := []byte(nil)
+		if output != nil {
+			data = output.data
+		} else {
+			var err error
+			if data, err = os.ReadFile(inputPath); err != nil {
+				return "", fmt.Errorf("failed to read input file: %w", err)
+			}
+		}
+		sum := sha256.Sum256(data)
+		digest := hex.EncodeToString(sum[:])
+		if part.length > 0 {
+			digest = digest[:part.length]
+		}
+		return digest, nil
+
+	case "date":
+		return captureDate(inputPath)
+
+	case "rel":
+		rel, err := relativePath(options.SourceRoot, inputPath)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Dir(rel), nil
+	}
+
+	return "", fmt.Errorf("unknown placeholder {%s}", part.field)
+}
+
+// templateDimensions returns the output size, or the input's before encoding
+func templateDimensions(inputPath string, output *encodedOutput) (int, int, error) {
+	if output != nil {
+		return output.width, output.height, nil
+	}
+	return ImageDimensions(inputPath)
+}
+
+// captureDate returns the EXIF capture date of an image, falling back to its
+// modification date
+func captureDate(inputPath string) (string, error) {
+	if info, err := GetImageInfo(inputPath); err == nil && info.EXIF != nil {
+		if date, err := time.Parse("2006:01:02 15:04:05", info.EXIF.DateTime); err == nil {
+			return date.Format("2006-01-02"), nil
+		}
+	}
+
+	stat, err := os.Stat(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get input file info: %w", err)
+	}
+	return stat.ModTime().Format("2006-01-02"), nil
+}
+
+// relativePath returns path relative to root (the working directory when
+// empty) when it lies below root, and its absolute path without the leading
+// separator otherwise
+func relativePath(root, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve input path: %w", err)
+	}
+
+	if root == "" {
+		root, _ = os.Getwd()
+	}
+	if root != "" {
+		if absRoot, err := filepath.Abs(root); err == nil {
+			if rel, err := filepath.Rel(absRoot, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return rel, nil
+			}
+		}
+	}
+
+	rel := strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	return strings.TrimLeft(rel, string(filepath.Separator)), nil
+}
+
+// pageTemplate numbers the pages of a multi-page input in a template that
+// does not already carry OutputSuffix, before the extension of its file name
+func pageTemplate(template string, page int) string {
+	if strings.Contains(template, "{suffix}") {
+		return template
+	}
+	suffix := fmt.Sprintf("_page%d", page)
+	base := strings.LastIndexAny(template, `/\`) + 1
+	if dot := strings.LastIndex(template[base:], "."); dot > 0 {
+		return template[:base+dot] + suffix + template[base+dot:]
+	}
+	return template + suffix
+}
+
+// sameFile reports whether two paths name the same existing file
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// OutputCollision is an output path that several inputs would write
+type OutputCollision struct {
+	OutputPath string
+	Inputs     []string
+}
+
+// CollisionError reports inputs whose outputs would overwrite each other
+type CollisionError struct {
+	Collisions []OutputCollision
+}
+
+func (e *CollisionError) Error() string {
+	first := e.Collisions[0]
+	msg := fmt.Sprintf("%s would be written by %s", first.OutputPath, strings.Join(first.Inputs, ", "))
+	if len(e.Collisions) > 1 {
+		msg += fmt.Sprintf(" (and %d more output collisions)", len(e.Collisions)-1)
+	}
+	return msg
+}
+
+// FindCollisions predicts the output paths of every input and returns the
+// paths claimed by more than one, in input order. Under automatic format
+// selection an input claims the path of every format it may be written in,
+// and a split multi-page input the path of every page. Outputs named by
+// dimensions are predicted from the input; inputs whose outputs are named by
+// content ({hash}, or {w} and {h} when resizing) cannot be predicted and are
+// left out.
+func FindCollisions(inputPaths []string, options CompressionOptions) ([]OutputCollision, error) {
+	if options.InPlace {
+		return nil, nil
+	}
+
+	var order []string
+	claims := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, inputPath := range inputPaths {
+		// The same file listed twice is not a collision
+		abs := absPath(inputPath)
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+
+		if _, err := GetImageFormat(inputPath); err != nil {
+			continue
+		}
+		keys, err := PredictOutputPaths(inputPath, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			if _, ok := claims[key]; !ok {
+				order = append(order, key)
+			}
+			claims[key] = append(claims[key], inputPath)
+		}
+	}
+
+	var collisions []OutputCollision
+	for _, key := range order {
+		if len(claims[key]) > 1 {
+			collisions = append(collisions, OutputCollision{OutputPath: key, Inputs: claims[key]})
+		}
+	}
+	return collisions, nil
+}
+
+// autoFormats are the formats automatic format selection may write
+var autoFormats = []ImageFormat{FormatPNG, FormatJPEG}
+
+// PredictOutputPaths returns the absolute paths the outputs of inputPath may
+// be written to, under the same assumptions as FindCollisions: one per format
+// automatic selection may pick and per page of a split multi-page input. It
+// returns nil when the paths depend on the encoded output.
+func PredictOutputPaths(inputPath string, options CompressionOptions) ([]string, error) {
+	pages, err := predictOutputs(inputPath, options)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, candidates := range pages {
+		paths = append(paths, candidates...)
+	}
+	return paths, nil
+}
+
+// predictOutputs returns the absolute output paths of inputPath by page, and
+// for each page one path per format it may be written in. It returns nil when
+// the paths depend on the encoded output.
+func predictOutputs(inputPath string, options CompressionOptions) ([][]string, error) {
+	inputFormat, err := GetImageFormat(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if outputDependentTemplate(options) {
+		return nil, nil
+	}
+
+	// SVG is never rasterized, automatic selection keeps it
+	formats := []ImageFormat{ResolveOutputFormat(inputFormat, options)}
+	if formats[0] == FormatAuto && inputFormat != FormatSVG {
+		formats = autoFormats
+	}
+
+	pages := []CompressionOptions{options}
+	if inputFormat == FormatTIFF && options.AllPages {
+		count, err := tiffPageCount(inputPath)
+		if err != nil {
+			return nil, err
+		}
+		if count > 1 {
+			pages = pages[:0]
+			for page := 1; page <= count; page++ {
+				pages = append(pages, optionsForPage(options, page))
+			}
+		}
+	}
+
+	outputs := make([][]string, len(pages))
+	for i, pageOptions := range pages {
+		for _, format := range formats {
+			outputPath, err := outputPathForFormat(inputPath, format, pageOptions, nil)
+			if err != nil {
+				return nil, err
+			}
+			outputs[i] = append(outputs[i], absPath(outputPath))
+		}
+	}
+	return outputs, nil
+}
+
+// outputDependentTemplate reports whether the output template names outputs
+// by what is encoded, which is only known after compressing: {hash} always,
+// {w} and {h} when the image is resized
+func outputDependentTemplate(options CompressionOptions) bool {
+	if options.OutputTemplate == "" || options.InPlace {
+		return false
+	}
+	parts, err := parseTemplate(options.OutputTemplate)
+	if err != nil {
+		return false
+	}
+	resized := options.ResizePercent > 0 || options.ResizeWidth > 0 || options.ResizeHeight > 0
+	for _, part := range parts {
+		if part.field == "hash" || (resized && (part.field == "w" || part.field == "h")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package compressor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		template  string
+		wantError bool
+	}{
+		{"{name}{suffix}.{ext}", false},
+		{"{dir}/{name}.{w}x{h}.{ext}", false},
+		{"dist/{hash:8}.{ext}", false},
+		{"{rel}/{date}/{name}_q{q}.{fmt}", false},
+		{"{name}.{unknown}", true},
+		{"{name.{ext}", true},
+		{"{name}}.{ext}", true},
+		{"{w}x{h}.png", true},
+		{"{hash:0}.png", true},
+		{"{hash:65}.png", true},
+		{"{name:3}.png", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if err := ValidateTemplate(tt.template); (err != nil) != tt.wantError {
+				t.Errorf("ValidateTemplate() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "src", "photo.png")
+	writeTestPNG(t, input, 40, 30)
+
+	data := []byte("encoded")
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	output := &encodedOutput{data: data, width: 20, height: 15}
+
+	tests := []struct {
+		name     string
+		template string
+		format   ImageFormat
+		output   *encodedOutput
+		want     string
+	}{
+		{"name and extension", "{name}{suffix}.{ext}", FormatPNG, nil, "photo_compressed.png"},
+		{"converted", "{name}.{ext}", FormatJPEG, nil, "photo.jpg"},
+		{"format", "{name}.{fmt}", FormatAuto, nil, "photo.png"},
+		{"input dimensions", "{name}.{w}x{h}.{ext}", FormatPNG, nil, "photo.40x30.png"},
+		{"output dimensions", "{name}.{w}x{h}.{ext}", FormatPNG, output, "photo.20x15.png"},
+		{"output hash", "{hash:8}.{ext}", FormatPNG, output, digest[:8] + ".png"},
+		{"quality", "{name}_q{q}.{ext}", FormatJPEG, nil, "photo_q85.jpg"},
+		{"level", "{name}_l{q}.{ext}", FormatPNG, nil, "photo_l6.png"},
+		{"relative directory", "{rel}/{name}.{ext}", FormatPNG, nil, filepath.Join("src", "photo.png")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.OutputTemplate = tt.template
+			options.OutputDir = filepath.Join(dir, "out")
+			options.SourceRoot = dir
+
+			got, err := expandTemplate(input, tt.format, options, tt.output)
+			if err != nil {
+				t.Fatalf("expandTemplate() error = %v", err)
+			}
+			if want := filepath.Join(dir, "out", tt.want); got != want {
+				t.Errorf("expandTemplate() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPageTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{name}.{ext}", "{name}_page2.{ext}"},
+		{"{name}{suffix}.{ext}", "{name}{suffix}.{ext}"},
+		{"v1.0/{name}", "v1.0/{name}_page2"},
+		{"out/{name}.{w}x{h}.{ext}", "out/{name}.{w}x{h}_page2.{ext}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			if got := pageTemplate(tt.template, 2); got != tt.want {
+				t.Errorf("pageTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCollisions(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []string
+		options func(options *CompressionOptions)
+		want    map[string][]string // Output name to the inputs claiming it
+	}{
+		{
+			name:   "distinct names",
+			inputs: []string{"a.jpg", "b.jpg", "c.png"},
+		},
+		{
+			name:   "same file twice",
+			inputs: []string{"a.jpg", "a.jpg"},
+		},
+		{
+			name:   "converted to the same extension",
+			inputs: []string{"photo.png", "photo.jpg"},
+			options: func(options *CompressionOptions) {
+				options.OutputFormat = FormatJPEG
+			},
+			want: map[string][]string{"photo_compressed.jpg": {"photo.png", "photo.jpg"}},
+		},
+		{
+			name:   "automatic format",
+			inputs: []string{"photo.bmp", "photo.jpg"},
+			want:   map[string][]string{"photo_compressed.jpg": {"photo.bmp", "photo.jpg"}},
+		},
+		{
+			name:   "two automatic inputs",
+			inputs: []string{"scan.bmp", "scan.tif"},
+			want: map[string][]string{
+				"scan_compressed.png": {"scan.bmp", "scan.tif"},
+				"scan_compressed.jpg": {"scan.bmp", "scan.tif"},
+			},
+		},
+		{
+			name:   "pages",
+			inputs: []string{"pages.tif", "pages_page2.png"},
+			options: func(options *CompressionOptions) {
+				options.AllPages = true
+				options.OutputSuffix = ""
+				options.OutputDir = "out"
+			},
+			want: map[string][]string{filepath.Join("out", "pages_page2.png"): {"pages.tif", "pages_page2.png"}},
+		},
+		{
+			name:   "pages not split",
+			inputs: []string{"pages.tif", "pages_page2.png"},
+			options: func(options *CompressionOptions) {
+				options.OutputSuffix = ""
+				options.OutputDir = "out"
+			},
+		},
+		{
+			name:   "content hash",
+			inputs: []string{"a.png", "b.png"},
+			options: func(options *CompressionOptions) {
+				options.OutputTemplate = "{hash:8}.{ext}"
+			},
+		},
+		{
+			name:   "template without name",
+			inputs: []string{filepath.Join("x", "a.png"), filepath.Join("y", "a.png")},
+			options: func(options *CompressionOptions) {
+				options.OutputTemplate = "out/{name}.{ext}"
+			},
+			want: map[string][]string{filepath.Join("out", "a.png"): {filepath.Join("x", "a.png"), filepath.Join("y", "a.png")}},
+		},
+		{
+			name:   "in place",
+			inputs: []string{"photo.png", "photo.jpg"},
+			options: func(options *CompressionOptions) {
+				options.InPlace = true
+				options.OutputFormat = FormatJPEG
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+			for _, input := range tt.inputs {
+				writeTestFile(t, input, "")
+			}
+			writeTestFile(t, "pages.tif", string(testTIFFPages(3)))
+
+			options := DefaultOptions()
+			if tt.options != nil {
+				tt.options(&options)
+			}
+			collisions, err := FindCollisions(tt.inputs, options)
+			if err != nil {
+				t.Fatalf("FindCollisions() error = %v", err)
+			}
+
+			got := make(map[string][]string)
+			for _, c := range collisions {
+				rel, err := filepath.Rel(dir, c.OutputPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[rel] = c.Inputs
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("FindCollisions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictOutputPaths(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "scan.tif")
+	writeTestFile(t, input, string(testTIFFPages(2)))
+
+	options := DefaultOptions()
+	options.AllPages = true
+	got, err := PredictOutputPaths(input, options)
+	if err != nil {
+		t.Fatalf("PredictOutputPaths() error = %v", err)
+	}
+	var want []string
+	for _, name := range []string{"scan_compressed_page1.png", "scan_compressed_page1.jpg", "scan_compressed_page2.png", "scan_compressed_page2.jpg"} {
+		want = append(want, filepath.Join(dir, name))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PredictOutputPaths() = %v, want %v", got, want)
+	}
+}
+
+// testTIFFPages returns a little-endian TIFF header chaining pages empty
+// image directories, enough to count pages
+func testTIFFPages(pages int) []byte {
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	for i := 0; i < pages; i++ {
+		next := uint32(len(data) + 6)
+		if i == pages-1 {
+			next = 0
+		}
+		data = append(data, 0, 0, byte(next), byte(next>>8), byte(next>>16), byte(next>>24))
+	}
+	return data
+}
+
+// writeTestPNG writes a blank PNG of the given size
+func writeTestPNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+}
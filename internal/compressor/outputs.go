@@ -0,0 +1,190 @@
+package compressor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// OutputFilter recognizes files imgshrink writes with a set of options, so a
+// directory scan does not take earlier outputs for new inputs
+type OutputFilter struct {
+	suffix   string
+	template *regexp.Regexp
+	dirs     []string        // Absolute output and backup directories
+	outputs  map[string]bool // Absolute outputs recorded in the manifest
+	tag      string          // ProcessedTag of the options, empty when tags are not checked
+	tags     *TagCache
+}
+
+var (
+	// renameCounter matches the counter ExistingRename appends to outputs
+	renameCounter = regexp.MustCompile(`-[1-9]\d*$`)
+	// pageCounter matches the page number of split TIFF outputs
+	pageCounter = regexp.MustCompile(`_page\d+$`)
+)
+
+// NewOutputFilter builds a filter for the outputs options would produce:
+// names carrying OutputSuffix or matching OutputTemplate, the contents of
+// OutputDir and the backup directory, and the outputs listed in the manifest (the one in
+// options, or else the one kept in OutputDir). With TagOutputs and without
+// Force, files tagged by a run with the same options are processed already.
+func NewOutputFilter(options CompressionOptions) *OutputFilter {
+	f := &OutputFilter{outputs: make(map[string]bool)}
+
+	if options.TagOutputs && !options.Force {
+		f.tag = ProcessedTag(options)
+		f.tags = options.Tags
+		if f.tags == nil {
+			f.tags = NewTagCache()
+		}
+	}
+
+	if options.OutputTemplate == "" {
+		f.suffix = options.OutputSuffix
+	} else if parts, err := parseTemplate(options.OutputTemplate); err == nil && distinctive(parts) {
+		f.template = templatePattern(parts, options.OutputSuffix)
+	}
+
+	for _, dir := range []string{options.OutputDir, backupDirOf(options)} {
+		if dir != "" {
+			f.dirs = append(f.dirs, absPath(dir))
+		}
+	}
+
+	manifest := options.Manifest
+	if manifest == nil && options.OutputDir != "" {
+		manifest, _ = OpenManifest(options.OutputDir)
+	}
+	if manifest != nil {
+		for _, output := range manifest.Outputs() {
+			f.outputs[output] = true
+		}
+	}
+
+	return f
+}
+
+// SkipDir reports whether a directory below the scan root holds outputs or
+// backups. The root itself is always scanned.
+func (f *OutputFilter) SkipDir(path, root string) bool {
+	abs := absPath(path)
+	if abs == absPath(root) {
+		return false
+	}
+	for _, dir := range f.dirs {
+		if abs == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOutput reports whether a file looks like an output
+func (f *OutputFilter) IsOutput(path string) bool {
+	abs := absPath(path)
+	if f.outputs[abs] {
+		return true
+	}
+
+	// Page and rename counters may precede the extension. A rename counter
+	// only counts next to the output it was renamed away from, so inputs
+	// like photo_compressed-2024.jpg are not mistaken for outputs.
+	ext := filepath.Ext(abs)
+	stem := strings.TrimSuffix(filepath.Base(abs), ext)
+	stems := []string{stem}
+	if loc := renameCounter.FindStringIndex(stem); loc != nil {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(abs), stem[:loc[0]]+ext)); err == nil {
+			stem = stem[:loc[0]]
+			stems = append(stems, stem)
+		}
+	}
+	if unpaged := pageCounter.ReplaceAllString(stem, ""); unpaged != stem {
+		stems = append(stems, unpaged)
+	}
+
+	for _, stem := range stems {
+		if f.template != nil {
+			if f.template.MatchString(filepath.ToSlash(filepath.Join(filepath.Dir(abs), stem+ext))) {
+				return true
+			}
+		} else if f.suffix != "" && strings.HasSuffix(stem, f.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsProcessed reports whether a file is tagged as written with the filter's
+// options. Reading a sidecar tag hashes the file, so check this last.
+func (f *OutputFilter) IsProcessed(path string) bool {
+	if f.tag == "" {
+		return false
+	}
+	tag, err := f.tags.ReadTag(path)
+	return err == nil && tag == f.tag
+}
+
+// distinctive reports whether the file names a template produces differ from
+// their inputs' names, i.e. they hold more than {name} and {ext}
+func distinctive(parts []templatePart) bool {
+	// Only the file name counts, not the directories
+	start := 0
+	for i, part := range parts {
+		if part.field == "" && strings.ContainsAny(part.literal, `/\`) {
+			start = i
+		}
+	}
+
+	for i, part := range parts[start:] {
+		switch {
+		case part.field == "name" || part.field == "ext":
+		case part.field != "":
+			return true
+		default:
+			literal := part.literal
+			if i == 0 {
+				literal = literal[strings.LastIndexAny(literal, `/\`)+1:]
+			}
+			if literal != "" && literal != "." {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// templatePattern matches the trailing part of a slash-separated path that a
+// template can expand to
+func templatePattern(parts []templatePart, suffix string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString(`(^|/)`)
+	for _, part := range parts {
+		switch part.field {
+		case "":
+			b.WriteString(regexp.QuoteMeta(filepath.ToSlash(part.literal)))
+		case "dir", "rel":
+			b.WriteString(`.*`)
+		case "name":
+			b.WriteString(`[^/]+`)
+		case "ext", "fmt":
+			b.WriteString(`[^/.]+`)
+		case "suffix":
+			b.WriteString(regexp.QuoteMeta(suffix))
+		case "w", "h", "q":
+			b.WriteString(`\d+`)
+		case "hash":
+			length := part.length
+			if length == 0 {
+				length = 64
+			}
+			fmt.Fprintf(&b, `[0-9a-f]{%d}`, length)
+		case "date":
+			b.WriteString(`\d{4}-\d{2}-\d{2}`)
+		}
+	}
+	b.WriteString(`$`)
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,45 @@
+package compressor
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputFilterIsOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		existing []string // Other files in the directory
+		template string
+		want     bool
+	}{
+		{"input", "photo.jpg", nil, "", false},
+		{"output", "photo_compressed.jpg", nil, "", true},
+		{"page", "scan_compressed_page2.png", nil, "", true},
+		{"renamed output", "photo_compressed-2.jpg", []string{"photo_compressed.jpg"}, "", true},
+		{"renamed page", "scan_compressed_page2-1.png", []string{"scan_compressed_page2.png"}, "", true},
+		{"year after the suffix", "x_compressed-2024.jpg", nil, "", false},
+		{"counter without an output", "photo_compressed-2.jpg", []string{"photo.jpg"}, "", false},
+		{"counter with another extension", "photo_compressed-1.png", []string{"photo_compressed.jpg"}, "", false},
+		{"zero padded counter", "photo_compressed-01.jpg", []string{"photo_compressed.jpg"}, "", false},
+		{"template", "photo.min.jpg", nil, "{name}.min.{ext}", true},
+		{"renamed template output", "photo.min-1.jpg", []string{"photo.min.jpg"}, "{name}.min.{ext}", true},
+		{"template input", "photo.jpg", nil, "{name}.min.{ext}", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range append(tt.existing, tt.file) {
+				writeTestFile(t, filepath.Join(dir, name), "")
+			}
+
+			options := DefaultOptions()
+			options.OutputTemplate = tt.template
+			filter := NewOutputFilter(options)
+			if got := filter.IsOutput(filepath.Join(dir, tt.file)); got != tt.want {
+				t.Errorf("IsOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
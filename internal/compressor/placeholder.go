@@ -0,0 +1,208 @@
+package compressor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Placeholder holds low-quality image placeholder (LQIP) data for an image
+type Placeholder struct {
+	BlurHash      string `json:"blurhash"`
+	DominantColor string `json:"dominantColor"` // "#rrggbb"
+	DataURI       string `json:"dataUri"`       // Tiny base64-encoded preview
+	Width         int    `json:"width"`         // Size of the preview
+	Height        int    `json:"height"`
+}
+
+const (
+	blurHashComponentsX = 4
+	blurHashComponentsY = 3
+	blurHashAlphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+)
+
+// GeneratePlaceholder computes a BlurHash, the dominant color and a tiny
+// data-URI preview whose longest side is at most size pixels
+func GeneratePlaceholder(img image.Image, size int) (*Placeholder, error) {
+	if size <= 0 {
+		size = DefaultOptions().PlaceholderSize
+	}
+
+	// Work on small copies, placeholders carry no fine detail
+	sample := imaging.Fit(img, 64, 64, imaging.Box)
+
+	preview := imaging.Fit(img, size, size, imaging.Lanczos)
+	dataURI, err := previewDataURI(preview)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Placeholder{
+		BlurHash:      blurHash(imaging.Fit(sample, 32, 32, imaging.Box), blurHashComponentsX, blurHashComponentsY),
+		DominantColor: dominantColor(sample),
+		DataURI:       dataURI,
+		Width:         preview.Bounds().Dx(),
+		Height:        preview.Bounds().Dy(),
+	}, nil
+}
+
+// previewDataURI encodes a preview as PNG, or as JPEG when that is smaller and
+// the preview is opaque
+func previewDataURI(preview *image.NRGBA) (string, error) {
+	options := DefaultOptions()
+	options.CompressionLevel = 9
+	options.Quality = 70
+
+	data, err := encodeBytes(preview, FormatPNG, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode preview: %w", err)
+	}
+	mime := "image/png"
+
+	if !hasAlpha(preview) {
+		if jpegData, err := encodeBytes(preview, FormatJPEG, options); err == nil && len(jpegData) < len(data) {
+			data, mime = jpegData, "image/jpeg"
+		}
+	}
+
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// dominantColor returns the average color of the most populated color bucket,
+// ignoring mostly transparent pixels
+func dominantColor(img *image.NRGBA) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		r, g, b, a := img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]
+		if a < 128 {
+			continue
+		}
+		key := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+		bk := buckets[key]
+		if bk == nil {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.count++
+		bk.r += int(r)
+		bk.g += int(g)
+		bk.b += int(b)
+		if best == nil || bk.count > best.count {
+			best = bk
+		}
+	}
+
+	if best == nil {
+		return "#000000"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+// blurHash encodes img with the BlurHash algorithm (https://blurha.sh)
+func blurHash(img *image.NRGBA, componentsX, componentsY int) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// Transparent pixels blend toward white like most page backgrounds
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := img.NRGBAAt(x, y)
+			alpha := float64(c.A) / 255
+			blend := func(v uint8) float64 {
+				return srgbToLinear(uint8(math.Round(float64(v)*alpha + 255*(1-alpha))))
+			}
+			linear[y*width+x] = [3]float64{blend(c.R), blend(c.G), blend(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var f [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					p := linear[y*width+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((componentsX-1)+(componentsY-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+
+	return hash.String()
+}
+
+func encode83(value, length int) string {
+	out := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		out[i-1] = blurHashAlphabet[digit]
+	}
+	return string(out)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,77 @@
+package compressor
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestGeneratePlaceholder(t *testing.T) {
+	tests := []struct {
+		name         string
+		img          image.Image
+		size         int
+		wantDC       string // Average color digits of the BlurHash, empty skips the check
+		wantColor    string
+		wantMIME     string
+		wantW, wantH int
+	}{
+		{"white", imaging.New(40, 30, color.White), 16, "TSUA", "#ffffff", "", 16, 12},
+		{"black", imaging.New(40, 30, color.Black), 16, "0000", "#000000", "", 16, 12},
+		{"transparent blends to white", imaging.New(40, 30, color.Transparent), 16, "TSUA", "#000000", "image/png", 16, 12},
+		{"dominant color", imaging.New(30, 60, color.NRGBA{10, 200, 30, 255}), 8, "", "#0ac81e", "", 4, 8},
+		{"default size", imaging.New(100, 50, color.White), 0, "", "#ffffff", "", DefaultOptions().PlaceholderSize, DefaultOptions().PlaceholderSize / 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placeholder, err := GeneratePlaceholder(tt.img, tt.size)
+			if err != nil {
+				t.Fatalf("GeneratePlaceholder() error = %v", err)
+			}
+			// 4x3 components: size flag, maximum, average color and 11 pairs
+			hash := placeholder.BlurHash
+			if len(hash) != 28 || hash[0] != 'L' {
+				t.Fatalf("BlurHash = %q, want 28 characters starting with L", hash)
+			}
+			if tt.wantDC != "" && hash[2:6] != tt.wantDC {
+				t.Errorf("BlurHash = %q, want average color %q", hash, tt.wantDC)
+			}
+			if placeholder.DominantColor != tt.wantColor {
+				t.Errorf("DominantColor = %q, want %q", placeholder.DominantColor, tt.wantColor)
+			}
+			if !strings.HasPrefix(placeholder.DataURI, "data:image/") || !strings.Contains(placeholder.DataURI, ";base64,") {
+				t.Errorf("DataURI = %q", placeholder.DataURI)
+			}
+			if tt.wantMIME != "" && !strings.HasPrefix(placeholder.DataURI, "data:"+tt.wantMIME+";") {
+				t.Errorf("DataURI = %q, want %s", placeholder.DataURI, tt.wantMIME)
+			}
+			if placeholder.Width != tt.wantW || placeholder.Height != tt.wantH {
+				t.Errorf("preview is %dx%d, want %dx%d", placeholder.Width, placeholder.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestEncode83(t *testing.T) {
+	tests := []struct {
+		value  int
+		length int
+		want   string
+	}{
+		{0, 1, "0"},
+		{82, 1, "~"},
+		{83, 2, "10"},
+		{21, 1, "L"},
+		{3429, 2, "fQ"},
+	}
+
+	for _, tt := range tests {
+		if got := encode83(tt.value, tt.length); got != tt.want {
+			t.Errorf("encode83(%d, %d) = %q, want %q", tt.value, tt.length, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package compressor
 
 import (
+	"bytes"
 	"fmt"
-	"image/png"
+	"image"
+	"math"
 	"os"
 
 	"github.com/disintegration/imaging"
@@ -23,6 +25,17 @@ func (c *PNGCompressor) Compress(inputPath string, options CompressionOptions) (
 		Success:   false,
 	}
 
+	// Leave inputs whose outputs exist alone before reading them
+	if skipExisting(inputPath, options, result) {
+		return result, nil
+	}
+
+	// Refuse decompression bombs before anything is decoded
+	if err := CheckLimits(inputPath, options.Limits); err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
 	// Get input file info
 	inputInfo, err := os.Stat(inputPath)
 	if err != nil {
@@ -31,8 +44,20 @@ func (c *PNGCompressor) Compress(inputPath string, options CompressionOptions) (
 	}
 	result.InputSize = inputInfo.Size()
 
-	// Open and decode the image
-	img, err := imaging.Open(inputPath, imaging.AutoOrientation(true))
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read input file: %w", err)
+		return result, result.Error
+	}
+
+	// Animated PNGs are recompressed frame by frame, decoding would keep only
+	// the default image
+	if chunks, err := readPNGChunks(data); err == nil && apngFrameCount(chunks) > 0 {
+		return c.compressAnimated(inputPath, chunks, options, result)
+	}
+
+	// Decode the image
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
 	if err != nil {
 		result.Error = fmt.Errorf("failed to open image: %w", err)
 		return result, result.Error
@@ -46,56 +71,69 @@ func (c *PNGCompressor) Compress(inputPath string, options CompressionOptions) (
 	result.Width = bounds.Dx()
 	result.Height = bounds.Dy()
 
-	// Generate output path
-	outputPath := GenerateOutputPath(inputPath, options)
-	result.OutputPath = outputPath
-
-	// Ensure output directory exists
-	if options.OutputDir != "" {
-		if err := os.MkdirAll(options.OutputDir, 0755); err != nil {
-			result.Error = fmt.Errorf("failed to create output directory: %w", err)
-			return result, result.Error
-		}
+	// Encode and write the output
+	if err := writeImage(inputPath, img, FormatPNG, options, result); err != nil {
+		result.Error = err
+		return result, result.Error
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to create output file: %w", err)
+	result.Reduction = CalculateReduction(result.InputSize, result.OutputSize)
+	result.Success = true
+
+	return result, nil
+}
+
+// Encode encodes an already decoded image with the same PNG settings Compress
+// uses, for operations that build images in memory
+func (c *PNGCompressor) Encode(img image.Image, options CompressionOptions) ([]byte, error) {
+	return encodeBytes(img, FormatPNG, options)
+}
+
+// compressAnimated recompresses an animated PNG, refusing any option that
+// would drop the animation
+func (c *PNGCompressor) compressAnimated(inputPath string, chunks []pngChunk, options CompressionOptions, result *CompressionResult) (*CompressionResult, error) {
+	format := ResolveOutputFormat(FormatPNG, options)
+	if format != FormatPNG && format != FormatAuto {
+		result.Error = fmt.Errorf("%w: cannot convert to %s", ErrAnimatedPNG, format)
 		return result, result.Error
 	}
-	defer outFile.Close()
-
-	// Map compression level (0-9) to PNG compression level
-	var compressionLevel png.CompressionLevel
-	switch {
-	case options.CompressionLevel <= 0:
-		compressionLevel = png.NoCompression
-	case options.CompressionLevel <= 3:
-		compressionLevel = png.BestSpeed
-	case options.CompressionLevel <= 6:
-		compressionLevel = png.DefaultCompression
-	default:
-		compressionLevel = png.BestCompression
+	if options.ResizePercent > 0 && options.ResizePercent < 100 || options.ResizeWidth > 0 || options.ResizeHeight > 0 {
+		result.Error = fmt.Errorf("%w: resizing is not supported", ErrAnimatedPNG)
+		return result, result.Error
 	}
 
-	// Create PNG encoder with options
-	encoder := &png.Encoder{
-		CompressionLevel: compressionLevel,
-	}
+	result.Width, result.Height = pngDimensions(chunks)
 
-	if err := encoder.Encode(outFile, img); err != nil {
+	data, err := recompressAPNG(chunks, options)
+	if err != nil {
 		result.Error = fmt.Errorf("failed to encode PNG: %w", err)
 		return result, result.Error
 	}
 
-	// Get output file size
-	outInfo, err := os.Stat(outputPath)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to get output file info: %w", err)
+	// Placeholders show the default image, which is what browsers paint first
+	if options.Placeholder {
+		img, err := imaging.Decode(bytes.NewReader(data))
+		if err == nil {
+			result.Placeholder, err = GeneratePlaceholder(img, options.PlaceholderSize)
+		}
+		if err != nil {
+			result.Error = fmt.Errorf("failed to generate placeholder: %w", err)
+			return result, result.Error
+		}
+	}
+
+	if err := writeOutput(inputPath, data, FormatPNG, options, result); err != nil {
+		result.Error = err
 		return result, result.Error
 	}
-	result.OutputSize = outInfo.Size()
+
+	if format == FormatAuto {
+		result.Candidates = []FormatCandidate{
+			{Format: FormatPNG, Variant: "animated", Size: result.OutputSize, PSNR: math.Inf(1), Eligible: true, Selected: true},
+			{Format: FormatJPEG, Variant: "lossy", Reason: "image is animated"},
+		}
+	}
+
 	result.Reduction = CalculateReduction(result.InputSize, result.OutputSize)
 	result.Success = true
 
@@ -0,0 +1,93 @@
+package compressor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+// QOICompressor handles QOI (Quite OK Image) images
+type QOICompressor struct{}
+
+// NewQOICompressor creates a new QOI compressor
+func NewQOICompressor() *QOICompressor {
+	return &QOICompressor{}
+}
+
+// Compress compresses a QOI image with the given options
+func (c *QOICompressor) Compress(inputPath string, options CompressionOptions) (*CompressionResult, error) {
+	result := &CompressionResult{
+		InputPath: inputPath,
+		Success:   false,
+	}
+
+	// Leave inputs whose outputs exist alone before reading them
+	if skipExisting(inputPath, options, result) {
+		return result, nil
+	}
+
+	// Refuse decompression bombs before anything is decoded
+	if err := CheckLimits(inputPath, options.Limits); err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	// Get input file info
+	inputInfo, err := os.Stat(inputPath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to get input file info: %w", err)
+		return result, result.Error
+	}
+	result.InputSize = inputInfo.Size()
+
+	// Open and decode the image
+	img, err := imaging.Open(inputPath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to open image: %w", err)
+		return result, result.Error
+	}
+
+	// Apply resize if specified
+	img = applyResize(img, options)
+
+	// Get dimensions
+	bounds := img.Bounds()
+	result.Width = bounds.Dx()
+	result.Height = bounds.Dy()
+
+	// Encode and write the output
+	if err := writeImage(inputPath, img, FormatQOI, options, result); err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	result.Reduction = CalculateReduction(result.InputSize, result.OutputSize)
+	result.Success = true
+
+	return result, nil
+}
+
+// GetInfo returns information about a QOI image
+func (c *QOICompressor) GetInfo(inputPath string) (*ImageInfo, error) {
+	return GetImageInfo(inputPath)
+}
+
+// EstimateSize estimates the compressed size based on options
+func (c *QOICompressor) EstimateSize(inputPath string, options CompressionOptions) (int64, error) {
+	info, err := GetImageInfo(inputPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Re-encoding QOI is deterministic, only resizing changes its size
+	if ResolveOutputFormat(FormatQOI, options) == FormatQOI {
+		resizeFactor := 1.0
+		if options.ResizePercent > 0 && options.ResizePercent < 100 {
+			resizeFactor = (options.ResizePercent / 100.0) * (options.ResizePercent / 100.0)
+		}
+		return int64(float64(info.Size) * resizeFactor), nil
+	}
+
+	return estimateConvertedSize(info, options), nil
+}
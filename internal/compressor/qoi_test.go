@@ -0,0 +1,82 @@
+package compressor
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/virakt/imgshrink/internal/qoi"
+)
+
+func TestQOICompressorCompress(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{uint8(x * 12), uint8(y * 25), 90, uint8(255 - x)})
+		}
+	}
+
+	tests := []struct {
+		name     string
+		options  func(options *CompressionOptions)
+		output   string
+		wantSize image.Point
+		lossless bool
+	}{
+		{"same format", nil, "photo_compressed.qoi", image.Pt(20, 10), true},
+		{"to png", func(options *CompressionOptions) { options.OutputFormat = FormatPNG }, "photo_compressed.png", image.Pt(20, 10), true},
+		{"resized", func(options *CompressionOptions) { options.ResizePercent = 50 }, "photo_compressed.qoi", image.Pt(10, 5), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "photo.qoi")
+			file, err := os.Create(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := qoi.Encode(file, src); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			options := DefaultOptions()
+			if tt.options != nil {
+				tt.options(&options)
+			}
+			result, err := NewQOICompressor().Compress(input, options)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if want := filepath.Join(dir, tt.output); result.OutputPath != want {
+				t.Errorf("OutputPath = %q, want %q", result.OutputPath, want)
+			}
+
+			output, err := os.Open(result.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer output.Close()
+			img, _, err := image.Decode(output)
+			if err != nil {
+				t.Fatalf("output does not decode: %v", err)
+			}
+			if size := img.Bounds().Size(); size != tt.wantSize {
+				t.Fatalf("output is %v, want %v", size, tt.wantSize)
+			}
+			if !tt.lossless {
+				return
+			}
+			for y := 0; y < 10; y++ {
+				for x := 0; x < 20; x++ {
+					if got, want := color.NRGBAModel.Convert(img.At(x, y)), src.At(x, y); got != want {
+						t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength is how much of a file SniffFormat reads; SVG files may open
+// with a long XML prologue before the <svg> element
+const sniffLength = 4096
+
+// SniffFormat detects the image format from the file signature, whatever the
+// file is named
+func SniffFormat(path string) (ImageFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	format := sniff(header[:n])
+	if format == "" {
+		return "", errors.New("unrecognized file signature")
+	}
+	return format, nil
+}
+
+// sniff returns the format a file header belongs to, or "" when it matches
+// no supported signature
+func sniff(header []byte) ImageFormat {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte(pngSignature)):
+		return FormatPNG
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		if cameraRaw(header) {
+			return ""
+		}
+		return FormatTIFF
+	case bytes.HasPrefix(header, []byte("qoif")):
+		return FormatQOI
+	case len(header) >= 18 && bytes.HasPrefix(header, []byte("BM")):
+		// Two letters are a weak signature, so require the header size
+		// field of one of the known BMP versions
+		switch binary.LittleEndian.Uint32(header[14:]) {
+		case 12, 40, 52, 56, 64, 108, 124:
+			return FormatBMP
+		}
+	}
+
+	if svgRoot(header) {
+		return FormatSVG
+	}
+	return ""
+}
+
+// cameraRaw reports whether a TIFF header belongs to a camera raw file built
+// on TIFF: Canon CR2 by its signature, DNG by the DNGVersion tag in its first
+// directory
+func cameraRaw(header []byte) bool {
+	if len(header) >= 10 && string(header[8:10]) == "CR" {
+		return true
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+	if len(header) < 8 {
+		return false
+	}
+	ifd := int(order.Uint32(header[4:]))
+	if ifd < 8 || ifd+2 > len(header) {
+		return false
+	}
+	entries := int(order.Uint16(header[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+2 > len(header) {
+			break
+		}
+		if order.Uint16(header[entry:]) == 0xC612 {
+			return true
+		}
+	}
+	return false
+}
+
+// svgRoot reports whether a text header opens an SVG document: an optional
+// BOM, then XML declaration, processing instructions, comments and doctype,
+// then an <svg> root element. HTML and XML files that only embed SVG do not
+// count.
+func svgRoot(header []byte) bool {
+	text := bytes.TrimPrefix(header, []byte("\xEF\xBB\xBF"))
+	for {
+		text = bytes.TrimLeft(text, " \t\r\n")
+		var end int
+		switch {
+		case bytes.HasPrefix(text, []byte("<?")):
+			end = skipPast(text, "?>")
+		case bytes.HasPrefix(text, []byte("<!--")):
+			end = skipPast(text, "-->")
+		case bytes.HasPrefix(text, []byte("<!DOCTYPE")):
+			// The internal subset may hold '>' inside its brackets
+			end = -1
+			depth := 0
+			for i, c := range text {
+				if c == '[' {
+					depth++
+				} else if c == ']' {
+					depth--
+				} else if c == '>' && depth <= 0 {
+					end = i + 1
+					break
+				}
+			}
+		default:
+			if !bytes.HasPrefix(text, []byte("<svg")) || len(text) < 5 {
+				return false
+			}
+			switch text[4] {
+			case ' ', '\t', '\r', '\n', '>', '/':
+				return true
+			}
+			return false
+		}
+		if end < 0 {
+			return false
+		}
+		text = text[end:]
+	}
+}
+
+// skipPast returns the index just after the first marker in text, or -1
+func skipPast(text []byte, marker string) int {
+	i := bytes.Index(text, []byte(marker))
+	if i < 0 {
+		return -1
+	}
+	return i + len(marker)
+}
+
+// Misnamed is an image whose extension does not match its contents
+type Misnamed struct {
+	Path      string      `json:"path"`
+	Format    ImageFormat `json:"format"`          // From the file signature
+	Named     ImageFormat `json:"named,omitempty"` // From the extension, empty when there is none
+	Suggested string      `json:"suggested"`       // Path with the extension of Format
+}
+
+// CheckExtension sniffs an image and returns how it is misnamed, or nil when
+// its extension matches its contents. Only image extensions and missing
+// extensions are checked: a .html file embedding SVG or a TIFF-based camera
+// raw file is never misnamed. Files without an extension that are not images
+// of a supported format return an error.
+func CheckExtension(path string) (*Misnamed, error) {
+	named, err := GetImageFormat(path)
+	if err != nil && filepath.Ext(path) != "" {
+		return nil, nil
+	}
+	format, sniffErr := SniffFormat(path)
+	if sniffErr != nil {
+		return nil, sniffErr
+	}
+	if err == nil && named == format {
+		return nil, nil
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return &Misnamed{
+		Path:      path,
+		Format:    format,
+		Named:     named,
+		Suggested: base + format.Extension(),
+	}, nil
+}
+
+// CanFixExtension reports why FixExtension would fail, without renaming
+func CanFixExtension(m Misnamed) error {
+	if _, err := os.Lstat(m.Path); err != nil {
+		return fmt.Errorf("failed to get file info: %w", err)
+	}
+	if _, err := os.Lstat(m.Suggested); err == nil {
+		return fmt.Errorf("%s already exists", m.Suggested)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check %s: %w", m.Suggested, err)
+	}
+	return nil
+}
+
+// FixExtension renames a misnamed image to its suggested path. An existing
+// file at that path is never replaced.
+func FixExtension(m Misnamed) error {
+	if err := CanFixExtension(m); err != nil {
+		return err
+	}
+	if err := os.Rename(m.Path, m.Suggested); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", m.Path, err)
+	}
+	return nil
+}
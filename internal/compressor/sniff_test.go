@@ -0,0 +1,136 @@
+package compressor
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testDNGHeader returns a little-endian TIFF header whose first directory
+// holds a DNGVersion tag
+func testDNGHeader() []byte {
+	header := []byte("II*\x00\x08\x00\x00\x00")
+	header = binary.LittleEndian.AppendUint16(header, 1)
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry, 0xC612)
+	return append(header, entry...)
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   ImageFormat
+	}{
+		{"jpeg", "\xFF\xD8\xFF\xE0\x00\x10JFIF", FormatJPEG},
+		{"png", pngSignature + "\x00\x00\x00\x0DIHDR", FormatPNG},
+		{"tiff little endian", "II*\x00\x08\x00\x00\x00\x00\x00", FormatTIFF},
+		{"tiff big endian", "MM\x00*\x00\x00\x00\x08\x00\x00", FormatTIFF},
+		{"canon cr2", "II*\x00\x10\x00\x00\x00CR\x02\x00", ""},
+		{"dng", string(testDNGHeader()), ""},
+		{"qoi", "qoif\x00\x00\x00\x01\x00\x00\x00\x01\x04\x00", FormatQOI},
+		{"bmp", "BM" + string(make([]byte, 12)) + "\x28\x00\x00\x00", FormatBMP},
+		{"bm text", "BM is not a bitmap header", ""},
+		{"svg", `<svg xmlns="http://www.w3.org/2000/svg"/>`, FormatSVG},
+		{"svg with prolog", "\xEF\xBB\xBF<?xml version=\"1.0\"?>\n<!-- Generator -->\n" +
+			"<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" [\n<!ENTITY ns \"a>b\">\n]>\n<svg>", FormatSVG},
+		{"html embedding svg", "<!DOCTYPE html>\n<html><body><svg width=\"1\"></svg></body></html>", ""},
+		{"xml embedding svg", "<?xml version=\"1.0\"?><doc><svg/></doc>", ""},
+		{"svg prefix element", "<svgfoo/>", ""},
+		{"unterminated comment", "<!-- <svg>", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniff([]byte(tt.header)); got != tt.want {
+				t.Errorf("sniff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExtension(t *testing.T) {
+	jpeg := "\xFF\xD8\xFF\xE0\x00\x10JFIF"
+	svg := `<svg xmlns="http://www.w3.org/2000/svg"/>`
+	html := "<html><body><svg/></body></html>"
+
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		want      *Misnamed // Path and Suggested relative to the directory
+		wantError bool
+	}{
+		{"matching", "photo.jpg", jpeg, nil, false},
+		{"jpeg named png", "photo.png", jpeg, &Misnamed{Path: "photo.png", Format: FormatJPEG, Named: FormatPNG, Suggested: "photo.jpg"}, false},
+		{"no extension", "scan0001", jpeg, &Misnamed{Path: "scan0001", Format: FormatJPEG, Suggested: "scan0001.jpg"}, false},
+		{"svg without extension", "logo", svg, &Misnamed{Path: "logo", Format: FormatSVG, Suggested: "logo.svg"}, false},
+		{"html embedding svg", "index.html", html, nil, false},
+		{"other extension", "notes.dat", svg, nil, false},
+		{"camera raw", "IMG_0001.CR2", "II*\x00\x10\x00\x00\x00CR\x02\x00", nil, false},
+		{"unknown without extension", "README", "plain text", nil, true},
+		{"unknown with image extension", "broken.png", "plain text", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := CheckExtension(path)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("CheckExtension() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("CheckExtension() = %+v, want nil", got)
+				}
+				return
+			}
+			want := *tt.want
+			want.Path = filepath.Join(dir, want.Path)
+			want.Suggested = filepath.Join(dir, want.Suggested)
+			if got == nil || *got != want {
+				t.Errorf("CheckExtension() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFixExtension(t *testing.T) {
+	dir := t.TempDir()
+	m := Misnamed{
+		Path:      filepath.Join(dir, "a.png"),
+		Format:    FormatJPEG,
+		Named:     FormatPNG,
+		Suggested: filepath.Join(dir, "a.jpg"),
+	}
+	if err := os.WriteFile(m.Path, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(m.Suggested, []byte("taken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := FixExtension(m); err == nil {
+		t.Fatal("FixExtension() replaced an existing file")
+	}
+	if data, _ := os.ReadFile(m.Suggested); string(data) != "taken" {
+		t.Errorf("existing file changed to %q", data)
+	}
+
+	if err := os.Remove(m.Suggested); err != nil {
+		t.Fatal(err)
+	}
+	if err := FixExtension(m); err != nil {
+		t.Fatalf("FixExtension() error = %v", err)
+	}
+	if data, _ := os.ReadFile(m.Suggested); string(data) != "jpeg" {
+		t.Errorf("renamed file holds %q", data)
+	}
+}
@@ -0,0 +1,142 @@
+package compressor
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SVGCompressor minifies SVG vector images
+type SVGCompressor struct{}
+
+// NewSVGCompressor creates a new SVG compressor
+func NewSVGCompressor() *SVGCompressor {
+	return &SVGCompressor{}
+}
+
+// Compress minifies an SVG image with the given options. Vector images are
+// never resized or rasterized.
+func (c *SVGCompressor) Compress(inputPath string, options CompressionOptions) (*CompressionResult, error) {
+	result := &CompressionResult{
+		InputPath: inputPath,
+		Success:   false,
+	}
+
+	// Leave inputs whose outputs exist alone before reading them
+	if skipExisting(inputPath, options, result) {
+		return result, nil
+	}
+
+	// Refuse decompression bombs before anything is decoded
+	if err := CheckLimits(inputPath, options.Limits); err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	format := ResolveOutputFormat(FormatSVG, options)
+	if format != FormatSVG && format != FormatAuto {
+		result.Error = fmt.Errorf("converting SVG to %s is not supported", format)
+		return result, result.Error
+	}
+
+	// Read the document
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read input file: %w", err)
+		return result, result.Error
+	}
+	result.InputSize = int64(len(data))
+
+	result.Width, result.Height = svgDimensions(data)
+
+	minified, err := minifySVG(data, options.SVGPrecision)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to minify SVG: %w", err)
+		return result, result.Error
+	}
+
+	if err := writeOutput(inputPath, minified, FormatSVG, options, result); err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	result.Reduction = CalculateReduction(result.InputSize, result.OutputSize)
+	result.Success = true
+
+	return result, nil
+}
+
+// GetInfo returns information about an SVG image
+func (c *SVGCompressor) GetInfo(inputPath string) (*ImageInfo, error) {
+	return GetImageInfo(inputPath)
+}
+
+// EstimateSize estimates the minified size; editor output typically shrinks
+// by a third or more
+func (c *SVGCompressor) EstimateSize(inputPath string, options CompressionOptions) (int64, error) {
+	info, err := GetImageInfo(inputPath)
+	if err != nil {
+		return 0, err
+	}
+	return int64(float64(info.Size) * 0.6), nil
+}
+
+// getSVGInfo returns information about an SVG file, which image.DecodeConfig
+// cannot read
+func getSVGInfo(path string) (*ImageInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	root, err := parseSVG(data)
+	if err != nil || root.name.Local != "svg" {
+		return nil, fmt.Errorf("failed to decode image config: not an SVG document")
+	}
+
+	width, height := svgDimensions(data)
+	return &ImageInfo{
+		Path:      path,
+		Format:    FormatSVG,
+		Width:     width,
+		Height:    height,
+		Size:      int64(len(data)),
+		ColorMode: "vector",
+		Frames:    1,
+	}, nil
+}
+
+// svgDimensions returns the intrinsic size of an SVG document from its width
+// and height attributes, falling back to the viewBox
+func svgDimensions(data []byte) (int, int) {
+	root, err := parseSVG(data)
+	if err != nil {
+		return 0, 0
+	}
+
+	parse := func(value string) float64 {
+		value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0
+		}
+		return v
+	}
+
+	width, _ := root.attr("width")
+	height, _ := root.attr("height")
+	w, h := parse(width), parse(height)
+
+	if w == 0 || h == 0 {
+		if viewBox, ok := root.attr("viewBox"); ok {
+			fields := strings.FieldsFunc(viewBox, func(r rune) bool { return r == ' ' || r == ',' })
+			if len(fields) == 4 {
+				w, h = parse(fields[2]), parse(fields[3])
+			}
+		}
+	}
+
+	return int(math.Round(w)), int(math.Round(h))
+}
@@ -0,0 +1,616 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// editorNamespaces lists namespaces written by drawing tools that carry no
+// rendering information
+var editorNamespaces = map[string]bool{
+	"http://www.inkscape.org/namespaces/inkscape":            true,
+	"http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd":     true,
+	"http://www.bohemiancoding.com/sketch/ns":                true,
+	"http://ns.adobe.com/AdobeIllustrator/10.0/":             true,
+	"http://ns.adobe.com/AdobeSVGViewerExtensions/3.0/":      true,
+	"http://ns.adobe.com/Extensibility/1.0/":                 true,
+	"http://ns.adobe.com/Flows/1.0/":                         true,
+	"http://ns.adobe.com/Graphs/1.0/":                        true,
+	"http://ns.adobe.com/ImageReplacement/1.0/":              true,
+	"http://ns.adobe.com/SaveForWeb/1.0/":                    true,
+	"http://ns.adobe.com/Variables/1.0/":                     true,
+	"http://ns.adobe.com/xap/1.0/":                           true,
+	"http://purl.org/dc/elements/1.1/":                       true,
+	"http://creativecommons.org/ns#":                         true,
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#":            true,
+	"http://www.serif.com/":                                  true,
+	"http://www.figma.com/figma/ns":                          true,
+	"http://www.corel.com/coreldraw/odg":                     true,
+	"http://schemas.microsoft.com/visio/2003/SVGExtensions/": true,
+}
+
+// svgNumericAttrs lists attributes whose numbers are rounded to the configured precision
+var svgNumericAttrs = map[string]bool{
+	"x": true, "y": true, "x1": true, "y1": true, "x2": true, "y2": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true, "fx": true, "fy": true,
+	"dx": true, "dy": true, "width": true, "height": true,
+	"stroke-width": true, "stroke-dasharray": true, "stroke-dashoffset": true,
+	"opacity": true, "fill-opacity": true, "stroke-opacity": true,
+	"stop-opacity": true, "offset": true, "font-size": true,
+	"points": true, "viewBox": true,
+}
+
+// svgTransformAttrs lists attributes whose numbers are kept as written, since
+// rounding a small scale factor can turn it into 0
+var svgTransformAttrs = map[string]bool{
+	"transform": true, "gradientTransform": true, "patternTransform": true,
+}
+
+// svgMergeableAttrs lists group attributes that can move onto a single child
+// without changing rendering
+var svgMergeableAttrs = map[string]bool{
+	"fill": true, "fill-opacity": true, "fill-rule": true,
+	"stroke": true, "stroke-width": true, "stroke-opacity": true,
+	"stroke-linecap": true, "stroke-linejoin": true, "stroke-miterlimit": true,
+	"stroke-dasharray": true, "stroke-dashoffset": true,
+	"opacity": true, "transform": true, "clip-path": true, "mask": true, "filter": true,
+	"color": true, "visibility": true, "display": true,
+	"font-family": true, "font-size": true, "font-weight": true, "font-style": true,
+}
+
+var svgNumberPattern = regexp.MustCompile(`[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// svgNode is an element or text node of a parsed SVG document
+type svgNode struct {
+	name     xml.Name // Space holds the raw prefix
+	attrs    []xml.Attr
+	children []*svgNode
+	text     string
+	isText   bool
+}
+
+func (n *svgNode) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// minifySVG minifies an SVG document, keeping its rendering unchanged
+func minifySVG(data []byte, precision int) ([]byte, error) {
+	root, err := parseSVG(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.name.Local != "svg" {
+		return nil, errors.New("svg: root element is not <svg>")
+	}
+
+	editorPrefixes := make(map[string]bool)
+	collectEditorPrefixes(root, editorPrefixes)
+
+	cleanSVGNode(root, editorPrefixes, precision, false, false)
+	mergeSVGGroups(root)
+
+	var buf bytes.Buffer
+	writeSVGNode(&buf, root)
+	return buf.Bytes(), nil
+}
+
+// svgEntityPattern matches the general entity declarations of an internal
+// DTD subset, as Illustrator writes them
+var svgEntityPattern = regexp.MustCompile(`<!ENTITY\s+([^\s%]\S*)\s+(?:"([^"]*)"|'([^']*)')\s*>`)
+
+// parseSVG builds a node tree, dropping comments, processing instructions and
+// the doctype along the way. Entities the doctype declares are expanded, so
+// nothing refers to the dropped declarations; undeclared entities are errors.
+func parseSVG(data []byte) (*svgNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Entity = make(map[string]string)
+
+	var root *svgNode
+	var stack []*svgNode
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("svg: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &svgNode{name: t.Name, attrs: append([]xml.Attr(nil), t.Attr...)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1].name != t.Name {
+				return nil, errors.New("svg: unbalanced end element")
+			}
+			stack = stack[:len(stack)-1]
+
+		case xml.Directive:
+			if err := declareSVGEntities(decoder.Entity, t); err != nil {
+				return nil, err
+			}
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, &svgNode{isText: true, text: string(t)})
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("svg: no root element")
+	}
+	if len(stack) > 0 {
+		return nil, errors.New("svg: unclosed element")
+	}
+	return root, nil
+}
+
+// declareSVGEntities adds the entities a doctype declares. Entities whose
+// values hold markup or references would need reparsing and are refused.
+func declareSVGEntities(entities map[string]string, directive xml.Directive) error {
+	if !bytes.HasPrefix(directive, []byte("DOCTYPE")) {
+		return nil
+	}
+	for _, m := range svgEntityPattern.FindAllSubmatch(directive, -1) {
+		name, value := string(m[1]), string(m[2])+string(m[3])
+		if strings.ContainsAny(value, "<&") {
+			return fmt.Errorf("svg: entity %s contains markup", name)
+		}
+		entities[name] = value
+	}
+	return nil
+}
+
+// collectEditorPrefixes finds the prefixes bound to editor namespaces
+func collectEditorPrefixes(node *svgNode, prefixes map[string]bool) {
+	for _, a := range node.attrs {
+		if a.Name.Space == "xmlns" && editorNamespaces[a.Value] {
+			prefixes[a.Name.Local] = true
+		}
+	}
+	for _, child := range node.children {
+		if !child.isText {
+			collectEditorPrefixes(child, prefixes)
+		}
+	}
+}
+
+// cleanSVGNode removes editor metadata, collapses whitespace and shortens
+// numbers in node and its descendants. Everything below a <text> element is
+// text content, including links and spans.
+func cleanSVGNode(node *svgNode, editorPrefixes map[string]bool, precision int, preserveSpace, inText bool) {
+	// Attributes
+	attrs := node.attrs[:0]
+	for _, a := range node.attrs {
+		switch {
+		case a.Name.Space == "xmlns" && editorPrefixes[a.Name.Local]:
+			continue
+		case editorPrefixes[a.Name.Space]:
+			continue
+		case a.Name.Space == "xml" && a.Name.Local == "space":
+			preserveSpace = a.Value == "preserve"
+		case a.Name.Space == "" && a.Name.Local == "d":
+			a.Value = minifyPathData(a.Value, precision)
+		case a.Name.Space == "" && svgNumericAttrs[a.Name.Local]:
+			a.Value = roundSVGNumbers(strings.Join(strings.Fields(a.Value), " "), precision)
+		case a.Name.Space == "" && svgTransformAttrs[a.Name.Local]:
+			a.Value = strings.Join(strings.Fields(a.Value), " ")
+		}
+		attrs = append(attrs, a)
+	}
+	node.attrs = attrs
+
+	inText = inText || node.name.Local == "text" || node.name.Local == "tspan" || node.name.Local == "textPath"
+	keepRaw := preserveSpace || node.name.Local == "script"
+
+	// Children
+	children := node.children[:0]
+	for _, child := range node.children {
+		if child.isText {
+			switch {
+			case keepRaw:
+			case node.name.Local == "style":
+				child.text = strings.Join(strings.Fields(child.text), " ")
+			case inText:
+				child.text = collapseSpaces(child.text)
+			default:
+				child.text = strings.TrimSpace(child.text)
+			}
+			if child.text == "" {
+				continue
+			}
+			children = append(children, child)
+			continue
+		}
+
+		if editorPrefixes[child.name.Space] || (child.name.Space == "" && child.name.Local == "metadata") {
+			continue
+		}
+
+		cleanSVGNode(child, editorPrefixes, precision, preserveSpace, inText)
+
+		// Drop empty containers that nothing can reference. A <switch> may
+		// render an empty one instead of a later sibling.
+		if (child.name.Local == "g" || child.name.Local == "defs") && len(child.children) == 0 && node.name.Local != "switch" {
+			if _, hasID := child.attr("id"); !hasID {
+				continue
+			}
+		}
+		children = append(children, child)
+	}
+	node.children = children
+}
+
+// mergeSVGGroups unwraps groups without attributes and folds the attributes of
+// single-child groups into the child where that cannot change rendering. The
+// children of a <switch> are left as they are, since it renders the first of
+// them whose conditions hold.
+func mergeSVGGroups(node *svgNode) {
+	var children []*svgNode
+	for _, child := range node.children {
+		if child.isText {
+			children = append(children, child)
+			continue
+		}
+		mergeSVGGroups(child)
+
+		if child.name.Space != "" || child.name.Local != "g" || node.name.Local == "switch" {
+			children = append(children, child)
+			continue
+		}
+
+		if len(child.attrs) == 0 {
+			children = append(children, child.children...)
+			continue
+		}
+
+		if len(child.children) == 1 && !child.children[0].isText && canMergeSVGGroup(child, child.children[0]) {
+			inner := child.children[0]
+			var attrs []xml.Attr
+			for _, a := range child.attrs {
+				if a.Name.Local == "transform" {
+					if t, ok := inner.attr("transform"); ok {
+						a.Value = a.Value + " " + t
+					}
+				}
+				attrs = append(attrs, a)
+			}
+			for _, a := range inner.attrs {
+				if a.Name.Space == "" && a.Name.Local == "transform" {
+					if _, ok := child.attr("transform"); ok {
+						continue
+					}
+				}
+				attrs = append(attrs, a)
+			}
+			inner.attrs = attrs
+			children = append(children, inner)
+			continue
+		}
+
+		children = append(children, child)
+	}
+	node.children = children
+}
+
+func canMergeSVGGroup(group, child *svgNode) bool {
+	_, childTransform := child.attr("transform")
+	for _, a := range group.attrs {
+		if a.Name.Space != "" || !svgMergeableAttrs[a.Name.Local] {
+			return false
+		}
+		// Clipping, masking and filters are resolved in the group's
+		// coordinate system, before the child's own transform
+		if childTransform && (a.Name.Local == "clip-path" || a.Name.Local == "mask" || a.Name.Local == "filter") {
+			return false
+		}
+		if _, ok := child.attr(a.Name.Local); ok && a.Name.Local != "transform" {
+			return false
+		}
+	}
+	// Style and class rules could override attributes moved onto the child
+	if _, ok := child.attr("style"); ok {
+		return false
+	}
+	if _, ok := child.attr("class"); ok {
+		return false
+	}
+	return true
+}
+
+func collapseSpaces(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// writeSVGNode serializes node without any indentation
+func writeSVGNode(buf *bytes.Buffer, node *svgNode) {
+	if node.isText {
+		escapeSVG(buf, node.text, false)
+		return
+	}
+
+	buf.WriteByte('<')
+	writeSVGName(buf, node.name)
+	for _, a := range node.attrs {
+		buf.WriteByte(' ')
+		writeSVGName(buf, a.Name)
+		buf.WriteString(`="`)
+		escapeSVG(buf, a.Value, true)
+		buf.WriteByte('"')
+	}
+
+	if len(node.children) == 0 {
+		buf.WriteString("/>")
+		return
+	}
+	buf.WriteByte('>')
+	for _, child := range node.children {
+		writeSVGNode(buf, child)
+	}
+	buf.WriteString("</")
+	writeSVGName(buf, node.name)
+	buf.WriteByte('>')
+}
+
+// escapeSVG escapes the characters XML requires, leaving line breaks in text
+// content readable
+func escapeSVG(buf *bytes.Buffer, s string, attr bool) {
+	for _, r := range s {
+		switch {
+		case r == '&':
+			buf.WriteString("&amp;")
+		case r == '<':
+			buf.WriteString("&lt;")
+		case r == '>' && !attr:
+			buf.WriteString("&gt;")
+		case r == '"' && attr:
+			buf.WriteString("&quot;")
+		case r == '\n' && attr:
+			buf.WriteString("&#xA;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+func writeSVGName(buf *bytes.Buffer, name xml.Name) {
+	if name.Space != "" {
+		buf.WriteString(name.Space)
+		buf.WriteByte(':')
+	}
+	buf.WriteString(name.Local)
+}
+
+// formatSVGNumber formats v with at most precision decimals and no redundant
+// characters, e.g. 0.500 becomes .5
+func formatSVGNumber(v float64, precision int) string {
+	s := strconv.FormatFloat(v, 'f', precision, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	switch {
+	case s == "-0":
+		return "0"
+	case strings.HasPrefix(s, "0."):
+		return s[1:]
+	case strings.HasPrefix(s, "-0."):
+		return "-" + s[2:]
+	}
+	return s
+}
+
+// roundSVGNumbers rounds every number in an attribute value, keeping units
+// and separators
+func roundSVGNumbers(value string, precision int) string {
+	return svgNumberPattern.ReplaceAllStringFunc(value, func(number string) string {
+		v, err := strconv.ParseFloat(number, 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return number
+		}
+		return formatSVGNumber(v, precision)
+	})
+}
+
+// svgPathArity is the number of arguments each path command takes
+var svgPathArity = map[byte]int{
+	'M': 2, 'L': 2, 'H': 1, 'V': 1, 'C': 6, 'S': 4, 'Q': 4, 'T': 2, 'A': 7, 'Z': 0,
+}
+
+// minifyPathData rewrites path data with rounded numbers, minimal separators
+// and implicit repeated commands. Unparseable data is returned unchanged.
+func minifyPathData(d string, precision int) string {
+	type segment struct {
+		command byte
+		values  []float64
+	}
+
+	var segments []segment
+	pos := 0
+	skip := func() {
+		for pos < len(d) && (d[pos] == ' ' || d[pos] == ',' || d[pos] == '\t' || d[pos] == '\n' || d[pos] == '\r') {
+			pos++
+		}
+	}
+
+	var command byte
+	for {
+		skip()
+		if pos >= len(d) {
+			break
+		}
+
+		c := d[pos]
+		if arity, ok := svgPathArity[c&^0x20]; ok {
+			command = c
+			pos++
+			if arity == 0 {
+				segments = append(segments, segment{command: command})
+				continue
+			}
+		} else if command == 0 {
+			return d
+		}
+
+		upper := command &^ 0x20
+		arity := svgPathArity[upper]
+		if arity == 0 {
+			return d
+		}
+
+		values := make([]float64, arity)
+		for i := 0; i < arity; i++ {
+			skip()
+			if pos >= len(d) {
+				return d
+			}
+			// Arc flags are single digits and may be written without separators
+			if upper == 'A' && (i == 3 || i == 4) {
+				if d[pos] != '0' && d[pos] != '1' {
+					return d
+				}
+				values[i] = float64(d[pos] - '0')
+				pos++
+				continue
+			}
+			match := svgNumberPattern.FindStringIndex(d[pos:])
+			if match == nil || match[0] != 0 {
+				return d
+			}
+			v, err := strconv.ParseFloat(d[pos:pos+match[1]], 64)
+			if err != nil {
+				return d
+			}
+			values[i] = v
+			pos += match[1]
+		}
+		segments = append(segments, segment{command: command, values: values})
+
+		// Extra coordinate pairs after a moveto are implicit linetos
+		if command == 'M' {
+			command = 'L'
+		} else if command == 'm' {
+			command = 'l'
+		}
+	}
+
+	// Relative coordinates are rounded against the rounded point they start
+	// from rather than on their own, so rounding errors do not add up along
+	// the path and every point stays within the precision of its position
+	round := func(v float64) (string, float64) {
+		s := formatSVGNumber(v, precision)
+		r, _ := strconv.ParseFloat(s, 64)
+		return s, r
+	}
+	var current, currentRounded, start, startRounded [2]float64
+
+	var b strings.Builder
+	var previous byte
+	var last string
+	for _, seg := range segments {
+		upper := seg.command &^ 0x20
+		relative := seg.command != upper
+		if upper == 'Z' {
+			current, currentRounded = start, startRounded
+		}
+
+		end, endRounded := current, currentRounded
+		args := make([]string, len(seg.values))
+		for i, v := range seg.values {
+			axis := svgPathAxis(upper, i)
+			endpoint := axis >= 0 && i >= len(seg.values)-2
+			var exact, rounded float64
+			switch {
+			case upper == 'A' && (i == 3 || i == 4):
+				args[i] = strconv.Itoa(int(v))
+				continue
+			case axis < 0:
+				args[i], _ = round(v)
+				continue
+			case relative:
+				exact = current[axis] + v
+				var delta float64
+				args[i], delta = round(exact - currentRounded[axis])
+				rounded = currentRounded[axis] + delta
+			default:
+				exact = v
+				args[i], rounded = round(v)
+			}
+			if endpoint {
+				end[axis], endRounded[axis] = exact, rounded
+			}
+		}
+		current, currentRounded = end, endRounded
+		if upper == 'M' {
+			start, startRounded = current, currentRounded
+		}
+
+		if seg.command != previous || seg.command == 'M' || seg.command == 'm' {
+			b.WriteByte(seg.command)
+			last = ""
+		}
+		for _, arg := range args {
+			if last != "" && !strings.HasPrefix(arg, "-") &&
+				!(strings.HasPrefix(arg, ".") && strings.ContainsAny(last, ".eE")) {
+				b.WriteByte(' ')
+			}
+			b.WriteString(arg)
+			last = arg
+		}
+		previous = seg.command
+	}
+	return b.String()
+}
+
+// svgPathAxis returns whether argument i of a path command is an x (0) or y
+// (1) coordinate, or -1 for radii, angles and flags
+func svgPathAxis(command byte, i int) int {
+	switch command {
+	case 'H':
+		return 0
+	case 'V':
+		return 1
+	case 'A':
+		if i < 5 {
+			return -1
+		}
+		return i - 5
+	}
+	return i % 2
+}
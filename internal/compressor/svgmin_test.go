@@ -0,0 +1,125 @@
+package compressor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinifySVG(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string // Substrings of the output
+		wantNot []string
+	}{
+		{
+			name:    "strips comments and editor metadata",
+			input:   `<?xml version="1.0"?><!-- made by hand --><svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" inkscape:version="1.0"><metadata>x</metadata><rect width="1" height="1"/></svg>`,
+			want:    []string{`<rect width="1" height="1"/>`},
+			wantNot: []string{"inkscape", "metadata", "<!--", "<?xml"},
+		},
+		{
+			name: "expands internal entities",
+			input: `<?xml version="1.0"?>
+<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd" [
+	<!ENTITY ns_svg "http://www.w3.org/2000/svg">
+	<!ENTITY st0 'fill:#FF0000;'>
+]>
+<svg xmlns="&ns_svg;"><rect style="&st0;"/></svg>`,
+			want:    []string{`xmlns="http://www.w3.org/2000/svg"`, `style="fill:#FF0000;"`},
+			wantNot: []string{"&amp;", "DOCTYPE"},
+		},
+		{
+			name:  "keeps spaces around links in text",
+			input: `<svg xmlns="http://www.w3.org/2000/svg"><text>Go <a href="#x"> here </a> now</text></svg>`,
+			want:  []string{`<text>Go <a href="#x"> here </a> now</text>`},
+		},
+		{
+			name:  "trims whitespace between elements",
+			input: "<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <g id=\"a\">\n    <circle r=\"1.50000\"/>\n  </g>\n</svg>",
+			want:  []string{`<g id="a"><circle r="1.5"/></g>`},
+		},
+		{
+			name:  "keeps transforms as written",
+			input: `<svg xmlns="http://www.w3.org/2000/svg"><g transform="matrix(0.0004 0 0 0.0004  10.12345 0)"><rect width="1.00001"/><rect/></g></svg>`,
+			want:  []string{`transform="matrix(0.0004 0 0 0.0004 10.12345 0)"`, `width="1"`},
+		},
+		{
+			name:  "leaves switch children alone",
+			input: `<svg xmlns="http://www.w3.org/2000/svg"><switch><g systemLanguage="fr"/><g><rect requiredExtensions="x"/></g><g fill="red"><rect/></g></switch><g><circle/></g></svg>`,
+			want:  []string{`<switch><g systemLanguage="fr"/><g><rect requiredExtensions="x"/></g><g fill="red"><rect/></g></switch><circle/>`},
+		},
+		{
+			name:  "escapes text",
+			input: `<svg xmlns="http://www.w3.org/2000/svg"><text>a &lt; b &amp; c</text></svg>`,
+			want:  []string{`<text>a &lt; b &amp; c</text>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := minifySVG([]byte(tt.input), 3)
+			if err != nil {
+				t.Fatalf("minifySVG: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("output %s does not contain %s", out, want)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(string(out), unwanted) {
+					t.Errorf("output %s contains %s", out, unwanted)
+				}
+			}
+			// The output must parse again
+			if _, err := parseSVG(out); err != nil {
+				t.Errorf("output does not parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestMinifySVGRefuses(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"not svg", `<html><body/></html>`},
+		{"undeclared entity", `<svg xmlns="http://www.w3.org/2000/svg"><text>&nbsp;</text></svg>`},
+		{"entity with markup", `<!DOCTYPE svg [<!ENTITY r "<rect/>">]><svg xmlns="http://www.w3.org/2000/svg">&r;</svg>`},
+		{"unbalanced", `<svg xmlns="http://www.w3.org/2000/svg"><g></svg>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out, err := minifySVG([]byte(tt.input), 3); err == nil {
+				t.Errorf("minifySVG = %s, want an error", out)
+			}
+		})
+	}
+}
+
+func TestMinifyPathData(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"M 10.000 20.000 L 30.5 40.25", "M10 20L30.5 40.25"},
+		{"M0,0 L1,1 L2,2", "M0 0L1 1 2 2"},
+		{"m 0.5 -0.5 z", "m.5-.5z"},
+		{"M1.23456 2", "M1.235 2"},
+		{"not a path", "not a path"},
+		// Relative coordinates carry their rounding error forward
+		{strings.Repeat("l.0004 0", 10), "l0 0 .001 0 0 0 .001 0 0 0 0 0 .001 0 0 0 .001 0 0 0"},
+		{"M10.0004 0h.0004h.0004z m.0004 .0004", "M10 0h.001 0zm.001 0"},
+		{"M0 0c.0004 0 .0004 0 .0004 0s.0004 0 .0004 0", "M0 0c0 0 0 0 0 0s.001 0 .001 0"},
+		{"M0 0a5.00049 5 30.0004 1 0 .0004 .0004l.0004 0", "M0 0a5 5 30 1 0 0 0l.001 0"},
+	}
+
+	for _, tt := range tests {
+		if got := minifyPathData(tt.input, 3); got != tt.want {
+			t.Errorf("minifyPathData(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
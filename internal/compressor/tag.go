@@ -0,0 +1,167 @@
+package compressor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TagXattr is the extended attribute processed files are tagged with
+const TagXattr = "user.imgshrink"
+
+// TagSidecarName is the per-directory file holding tags where extended
+// attributes are not supported
+const TagSidecarName = ".imgshrink-tags.json"
+
+// sidecarTag is a tag kept in a sidecar, valid while the file keeps its hash
+type sidecarTag struct {
+	Tag  string `json:"tag"`
+	Hash string `json:"hash"`
+}
+
+// sidecarMu serializes updates of sidecar files by concurrent workers
+var sidecarMu sync.Mutex
+
+// TagCache holds the sidecar tags of each directory read during a batch, so
+// every sidecar is read once. It is safe for concurrent use; a nil cache
+// reads the sidecar on every lookup.
+type TagCache struct {
+	mu   sync.Mutex
+	dirs map[string]map[string]sidecarTag
+}
+
+// NewTagCache creates an empty tag cache
+func NewTagCache() *TagCache {
+	return &TagCache{dirs: make(map[string]map[string]sidecarTag)}
+}
+
+// ProcessedTag returns the tag imgshrink leaves on files written with options
+func ProcessedTag(options CompressionOptions) string {
+	return fmt.Sprintf("imgshrink/%s %s", Version, OptionsFingerprint(options))
+}
+
+// ReadTag returns the tag imgshrink left on a processed file, or an empty
+// string when the file has none
+func ReadTag(path string) (string, error) {
+	return (*TagCache)(nil).ReadTag(path)
+}
+
+// ReadTag is like the package-level ReadTag, reading each directory's
+// sidecar only once
+func (c *TagCache) ReadTag(path string) (string, error) {
+	tag, err := lookupXattr(path, TagXattr)
+	if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return "", fmt.Errorf("failed to read tag: %w", err)
+	}
+	if tag != "" {
+		return tag, nil
+	}
+
+	entry, ok, err := c.lookup(path)
+	if err != nil || !ok {
+		return "", err
+	}
+
+	// A file rewritten by another tool is no longer the one that was tagged
+	if hash, err := hashFile(path); err != nil || hash != entry.Hash {
+		return "", nil
+	}
+	return entry.Tag, nil
+}
+
+// lookup returns the sidecar entry of path
+func (c *TagCache) lookup(path string) (sidecarTag, bool, error) {
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	if c == nil {
+		sidecarMu.Lock()
+		tags, err := readSidecar(dir)
+		sidecarMu.Unlock()
+		entry, ok := tags[name]
+		return entry, ok, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tags, ok := c.dirs[dir]
+	if !ok {
+		var err error
+		if tags, err = readSidecar(dir); err != nil {
+			return sidecarTag{}, false, err
+		}
+		c.dirs[dir] = tags
+	}
+	entry, ok := tags[name]
+	return entry, ok, nil
+}
+
+// update records a tag written to a sidecar in directories already cached
+func (c *TagCache) update(path string, entry sidecarTag) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tags, ok := c.dirs[filepath.Dir(path)]; ok {
+		tags[filepath.Base(path)] = entry
+	}
+}
+
+// tagFile marks path as written by this version with these options, in its
+// TagXattr or, where that is unsupported, its directory's sidecar
+func tagFile(path string, options CompressionOptions) error {
+	tag := ProcessedTag(options)
+
+	err := setXattr(path, TagXattr, []byte(tag))
+	if !errors.Is(err, errors.ErrUnsupported) {
+		if err != nil {
+			return fmt.Errorf("failed to tag %s: %w", path, err)
+		}
+		return nil
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+
+	sidecarMu.Lock()
+	defer sidecarMu.Unlock()
+
+	dir := filepath.Dir(path)
+	tags, err := readSidecar(dir)
+	if err != nil {
+		return err
+	}
+	entry := sidecarTag{Tag: tag, Hash: hash}
+	tags[filepath.Base(path)] = entry
+
+	data, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tags: %w", err)
+	}
+	if _, err := writeFile(filepath.Join(dir, TagSidecarName), append(data, '\n'), "", nil); err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	options.Tags.update(path, entry)
+	return nil
+}
+
+// readSidecar loads the sidecar tags of a directory
+func readSidecar(dir string) (map[string]sidecarTag, error) {
+	tags := make(map[string]sidecarTag)
+
+	data, err := os.ReadFile(filepath.Join(dir, TagSidecarName))
+	if errors.Is(err, os.ErrNotExist) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(dir, TagSidecarName), err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,116 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTagCache(t *testing.T) {
+	tag := ProcessedTag(DefaultOptions())
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, path string) // Applied after the sidecar is cached
+		cache  bool
+		want   string
+	}{
+		{"tagged", nil, false, tag},
+		{"tagged and cached", nil, true, tag},
+		{"rewritten by another tool", func(t *testing.T, path string) {
+			writeTestFile(t, path, "rewritten")
+		}, true, ""},
+		{"sidecar removed after caching", func(t *testing.T, path string) {
+			if err := os.Remove(filepath.Join(filepath.Dir(path), TagSidecarName)); err != nil {
+				t.Fatal(err)
+			}
+		}, true, tag},
+		{"sidecar removed without a cache", func(t *testing.T, path string) {
+			if err := os.Remove(filepath.Join(filepath.Dir(path), TagSidecarName)); err != nil {
+				t.Fatal(err)
+			}
+		}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "photo.jpg")
+			writeTestFile(t, path, "compressed")
+			hash, err := hashFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(map[string]sidecarTag{"photo.jpg": {Tag: tag, Hash: hash}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, filepath.Join(dir, TagSidecarName), string(data))
+
+			var cache *TagCache
+			if tt.cache {
+				cache = NewTagCache()
+				if _, err := cache.ReadTag(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.change != nil {
+				tt.change(t, path)
+			}
+
+			got, err := cache.ReadTag(path)
+			if err != nil {
+				t.Fatalf("ReadTag() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ReadTag() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessedTag(t *testing.T) {
+	options := DefaultOptions()
+	changed := options
+	changed.Quality = 60
+	rerun := options
+	rerun.InPlace = true
+	rerun.Tags = NewTagCache()
+
+	if ProcessedTag(options) == ProcessedTag(changed) {
+		t.Error("ProcessedTag() ignores the quality")
+	}
+	if ProcessedTag(options) != ProcessedTag(rerun) {
+		t.Error("ProcessedTag() depends on in-place replacement or the tag cache")
+	}
+}
+
+func TestJPEGSourceQualityTag(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.jpg")
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16)), &jpeg.Options{Quality: 50}); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, input, buf.String())
+
+	// The encode is capped at the source's quality, the tag keeps the run's
+	options := DefaultOptions()
+	options.SourceQuality = SourceQualityCap
+	options.TagOutputs = true
+	result, err := NewJPEGCompressor().Compress(input, options)
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	tag, err := ReadTag(result.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ProcessedTag(options); tag != want {
+		t.Errorf("tag = %q, want %q", tag, want)
+	}
+}
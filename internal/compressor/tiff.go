@@ -0,0 +1,268 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/image/tiff"
+)
+
+// TIFFCompressor handles TIFF images, including multi-page scans
+type TIFFCompressor struct{}
+
+// NewTIFFCompressor creates a new TIFF compressor
+func NewTIFFCompressor() *TIFFCompressor {
+	return &TIFFCompressor{}
+}
+
+// Compress converts a TIFF image with the given options. Only the first page
+// is written unless options.AllPages is set, in which case every page becomes
+// a separate output with a "_pageN" suffix.
+func (c *TIFFCompressor) Compress(inputPath string, options CompressionOptions) (*CompressionResult, error) {
+	result := &CompressionResult{
+		InputPath: inputPath,
+		Success:   false,
+	}
+
+	// Leave inputs whose outputs exist alone before reading them
+	if skipExisting(inputPath, options, result) {
+		return result, nil
+	}
+
+	// Refuse decompression bombs before anything is decoded
+	if err := CheckLimits(inputPath, options.Limits); err != nil {
+		result.Error = err
+		return result, result.Error
+	}
+
+	// Read the whole file, pages are addressed by offset
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to read input file: %w", err)
+		return result, result.Error
+	}
+	result.InputSize = int64(len(data))
+
+	offsets, err := tiffPageOffsets(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		result.Error = fmt.Errorf("failed to open image: %w", err)
+		return result, result.Error
+	}
+	// Replacing a multi-page file with any one page of it would lose the rest
+	if options.InPlace && len(offsets) > 1 {
+		result.Error = fmt.Errorf("replacing a %d page TIFF in place is not supported", len(offsets))
+		return result, result.Error
+	}
+	if !options.AllPages || len(offsets) == 1 {
+		offsets = offsets[:1]
+	}
+
+	skippedAll := true
+	var skipReason string
+	for i, offset := range offsets {
+		pageResult := &CompressionResult{InputPath: inputPath}
+
+		page := tiffPage(data, offset)
+		if i > 0 {
+			// The first page was checked by CheckLimits
+			config, err := tiff.DecodeConfig(bytes.NewReader(page))
+			if err != nil {
+				result.Error = fmt.Errorf("failed to open page %d: %w", i+1, err)
+				return result, result.Error
+			}
+			if err := options.Limits.checkDimensions(inputPath, config.Width, config.Height); err != nil {
+				result.Error = err
+				return result, result.Error
+			}
+		}
+
+		img, err := tiff.Decode(bytes.NewReader(page))
+		if err != nil {
+			result.Error = fmt.Errorf("failed to open page %d: %w", i+1, err)
+			return result, result.Error
+		}
+
+		// Apply resize if specified
+		img = applyResize(img, options)
+
+		// Get dimensions
+		bounds := img.Bounds()
+		pageResult.Width = bounds.Dx()
+		pageResult.Height = bounds.Dy()
+
+		pageOptions := options
+		if len(offsets) > 1 {
+			pageOptions = optionsForPage(options, i+1)
+		}
+
+		// Encode and write the output
+		if err := writeImage(inputPath, img, FormatTIFF, pageOptions, pageResult); err != nil {
+			result.Error = err
+			return result, result.Error
+		}
+		pageResult.Success = true
+
+		if i == 0 {
+			result.OutputPath = pageResult.OutputPath
+			result.Width = pageResult.Width
+			result.Height = pageResult.Height
+			result.Format = pageResult.Format
+			result.Candidates = pageResult.Candidates
+			result.Placeholder = pageResult.Placeholder
+			result.BackupPath = pageResult.BackupPath
+		}
+		if len(offsets) > 1 {
+			result.Pages = append(result.Pages, pageResult)
+		}
+		if result.Existing == "" {
+			result.Existing = pageResult.Existing
+		}
+
+		if !pageResult.Skipped {
+			result.OutputSize += pageResult.OutputSize
+			skippedAll = false
+		} else if stat, err := os.Stat(pageResult.OutputPath); err == nil {
+			// The existing output stands in for the page
+			pageResult.OutputSize = stat.Size()
+			result.OutputSize += stat.Size()
+		}
+		if pageResult.Skipped && pageResult.SkipReason != "" {
+			skipReason = pageResult.SkipReason
+		}
+	}
+
+	// The input counts as skipped only when no page was written
+	if skippedAll {
+		result.Skipped = true
+		result.SkipReason = skipReason
+		result.OutputSize = result.InputSize
+	}
+
+	result.Reduction = CalculateReduction(result.InputSize, result.OutputSize)
+	result.Success = true
+
+	return result, nil
+}
+
+// GetInfo returns information about a TIFF image
+func (c *TIFFCompressor) GetInfo(inputPath string) (*ImageInfo, error) {
+	return GetImageInfo(inputPath)
+}
+
+// EstimateSize estimates the compressed size based on options
+func (c *TIFFCompressor) EstimateSize(inputPath string, options CompressionOptions) (int64, error) {
+	info, err := GetImageInfo(inputPath)
+	if err != nil {
+		return 0, err
+	}
+
+	estimatedSize := estimateConvertedSize(info, options)
+	if options.AllPages && info.Frames > 1 {
+		estimatedSize *= int64(info.Frames)
+	}
+	return estimatedSize, nil
+}
+
+// optionsForPage returns the options a page (from 1) of a split multi-page
+// input is written with
+func optionsForPage(options CompressionOptions, page int) CompressionOptions {
+	options.OutputSuffix += fmt.Sprintf("_page%d", page)
+	if options.OutputTemplate != "" {
+		options.OutputTemplate = pageTemplate(options.OutputTemplate, page)
+	}
+	return options
+}
+
+// tiffPageCount returns the number of pages of a TIFF file, reading only its
+// image directories
+func tiffPageCount(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get input file info: %w", err)
+	}
+	offsets, err := tiffPageOffsets(file, stat.Size())
+	if err != nil {
+		return 0, err
+	}
+	return len(offsets), nil
+}
+
+// tiffPageOffsets walks the IFD chain of a TIFF file of the given size and
+// returns the offset of every page's IFD
+func tiffPageOffsets(r io.ReaderAt, size int64) ([]uint32, error) {
+	data := make([]byte, 8)
+	if size < 8 {
+		return nil, errors.New("tiff: file too short")
+	}
+	if _, err := r.ReadAt(data, 0); err != nil {
+		return nil, fmt.Errorf("tiff: failed to read header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: invalid byte order marker")
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, errors.New("tiff: unsupported version (BigTIFF is not supported)")
+	}
+
+	var offsets []uint32
+	seen := make(map[uint32]bool)
+	offset := order.Uint32(data[4:8])
+	for offset != 0 {
+		if seen[offset] {
+			return nil, errors.New("tiff: IFD chain loops")
+		}
+		if int64(offset)+2 > size {
+			return nil, errors.New("tiff: IFD offset out of range")
+		}
+		seen[offset] = true
+		offsets = append(offsets, offset)
+
+		if _, err := r.ReadAt(data[:2], int64(offset)); err != nil {
+			return nil, fmt.Errorf("tiff: failed to read IFD: %w", err)
+		}
+		entries := int64(order.Uint16(data[:2]))
+		next := int64(offset) + 2 + entries*12
+		if next+4 > size {
+			break
+		}
+		if _, err := r.ReadAt(data[:4], next); err != nil {
+			return nil, fmt.Errorf("tiff: failed to read IFD: %w", err)
+		}
+		offset = order.Uint32(data[:4])
+	}
+
+	if len(offsets) == 0 {
+		return nil, errors.New("tiff: no image directory")
+	}
+	return offsets, nil
+}
+
+// tiffPage returns a copy of data whose header points at the IFD at offset,
+// so the standard decoder reads that page instead of the first one
+func tiffPage(data []byte, offset uint32) []byte {
+	page := make([]byte, len(data))
+	copy(page, data)
+	if string(page[:2]) == "II" {
+		binary.LittleEndian.PutUint32(page[4:8], offset)
+	} else {
+		binary.BigEndian.PutUint32(page[4:8], offset)
+	}
+	return page
+}
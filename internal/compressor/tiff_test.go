@@ -0,0 +1,160 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+func TestTIFFCompress(t *testing.T) {
+	tests := []struct {
+		name     string
+		pages    int
+		allPages bool
+		format   ImageFormat
+		want     []string // Output names, the first page's first
+	}{
+		{"one page", 1, false, "", []string{"scan_compressed.png"}},
+		{"one page of several", 3, false, "", []string{"scan_compressed.png"}},
+		{"every page", 3, true, "", []string{"scan_compressed_page1.png", "scan_compressed_page2.png", "scan_compressed_page3.png"}},
+		{"every page as TIFF", 2, true, FormatTIFF, []string{"scan_compressed_page1.tiff", "scan_compressed_page2.tiff"}},
+		{"all pages of one", 1, true, "", []string{"scan_compressed.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "scan.tiff")
+			if err := os.WriteFile(input, testTIFF(t, tt.pages), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			options := DefaultOptions()
+			options.AllPages = tt.allPages
+			options.OutputFormat = tt.format
+			result, err := NewTIFFCompressor().Compress(input, options)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+
+			outputs := []string{filepath.Base(result.OutputPath)}
+			if len(result.Pages) > 0 {
+				outputs = nil
+				for _, page := range result.Pages {
+					outputs = append(outputs, filepath.Base(page.OutputPath))
+				}
+			}
+			if !reflect.DeepEqual(outputs, tt.want) {
+				t.Fatalf("outputs = %v, want %v", outputs, tt.want)
+			}
+			for _, name := range tt.want {
+				width, height, err := ImageDimensions(filepath.Join(dir, name))
+				if err != nil || width != 4 || height != 4 {
+					t.Errorf("%s is %dx%d, %v, want 4x4", name, width, height, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTIFFPageCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		want      int
+		wantError bool
+	}{
+		{"one page", testTIFFPages(1), 1, false},
+		{"several pages", testTIFFPages(4), 4, false},
+		{"big endian", []byte("MM\x00*\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00"), 1, false},
+		{"loop", []byte("II*\x00\x08\x00\x00\x00\x00\x00\x08\x00\x00\x00"), 0, true},
+		{"offset out of range", []byte("II*\x00\xff\x00\x00\x00"), 0, true},
+		{"BigTIFF", []byte("II+\x00\x08\x00\x00\x00"), 0, true},
+		{"not a TIFF", []byte("GIF89a\x00\x00"), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scan.tiff")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tiffPageCount(path)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("tiffPageCount() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("tiffPageCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBMPCompress(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 6, 3))
+	for x := 0; x < 6; x++ {
+		src.SetNRGBA(x, 1, color.NRGBA{uint8(x * 40), 0, 255, 255})
+	}
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		format ImageFormat
+		want   ImageFormat
+	}{
+		{"default", "", FormatPNG},
+		{"kept as BMP", FormatBMP, FormatBMP},
+		{"to QOI", FormatQOI, FormatQOI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := filepath.Join(t.TempDir(), "icon.bmp")
+			if err := os.WriteFile(input, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			options := DefaultOptions()
+			options.OutputFormat = tt.format
+			result, err := NewBMPCompressor().Compress(input, options)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if result.Format != tt.want || filepath.Ext(result.OutputPath) != tt.want.Extension() {
+				t.Errorf("output %s as %s, want %s", result.OutputPath, result.Format, tt.want)
+			}
+			if result.Width != 6 || result.Height != 3 {
+				t.Errorf("decoded %dx%d, want 6x3", result.Width, result.Height)
+			}
+		})
+	}
+}
+
+func TestTIFFInPlaceMultiPage(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "scan.tiff")
+	original := testTIFF(t, 2)
+	if err := os.WriteFile(input, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, allPages := range []bool{false, true} {
+		options := DefaultOptions()
+		options.InPlace = true
+		options.AllPages = allPages
+		options.BackupDir = filepath.Join(dir, "backup")
+		if _, err := NewTIFFCompressor().Compress(input, options); err == nil {
+			t.Errorf("Compress() with AllPages %v replaced a 2 page TIFF in place", allPages)
+		}
+		assertFile(t, input, string(original), 0644)
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/virakt/imgshrink/internal/api"
 	"github.com/virakt/imgshrink/internal/compressor"
@@ -15,7 +21,7 @@ func main() {
 
 	// If no arguments, show usage and start TUI
 	if len(args) == 0 {
-		if err := tui.Run(nil); err != nil {
+		if err := tui.Run(nil, compressor.DefaultOptions(), api.DefaultScanOptions()); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -30,16 +36,53 @@ func main() {
 
 	// Check for version flag
 	if len(args) == 1 && (args[0] == "-v" || args[0] == "--version") {
-		fmt.Println("ImgShrink v1.0.0")
+		fmt.Println("ImgShrink v" + compressor.Version)
+		return
+	}
+
+	// Subcommands
+	switch args[0] {
+	case "favicon":
+		runFavicon(args[1:])
+		return
+	case "atlas":
+		runAtlas(args[1:])
+		return
+	case "info":
+		runInfo(args[1:])
+		return
+	case "undo":
+		runUndo(args[1:])
+		return
+	case "check-extensions":
+		runExtensions(args[1:], false)
+		return
+	case "fix-extensions":
+		runExtensions(args[1:], true)
 		return
 	}
 
 	// Check for CLI mode flag
 	cliMode := false
 	var files []string
-	var outputDir string
-	quality := 85
-	compressionLevel := 6
+	options := compressor.DefaultOptions()
+	jsonOutput := false
+	var journalPath string
+	useManifest := true
+	scan := api.DefaultScanOptions()
+	stream := false
+
+	// A config file provides the defaults the other flags override
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--config" {
+			loaded, err := compressor.LoadOptions(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			options = loaded
+		}
+	}
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -47,28 +90,167 @@ func main() {
 			cliMode = true
 		case "--output", "-o":
 			if i+1 < len(args) {
-				outputDir = args[i+1]
+				options.OutputDir = args[i+1]
 				i++
 			}
 		case "--quality", "-q":
 			if i+1 < len(args) {
-				fmt.Sscanf(args[i+1], "%d", &quality)
+				fmt.Sscanf(args[i+1], "%d", &options.Quality)
 				i++
 			}
 		case "--level", "-l":
 			if i+1 < len(args) {
-				fmt.Sscanf(args[i+1], "%d", &compressionLevel)
+				fmt.Sscanf(args[i+1], "%d", &options.CompressionLevel)
+				i++
+			}
+		case "--config":
+			i++
+		case "--output-template", "-t":
+			if i+1 < len(args) {
+				if err := compressor.ValidateTemplate(args[i+1]); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				options.OutputTemplate = args[i+1]
+				i++
+			}
+		case "--mirror":
+			options.MirrorTree = true
+		case "--source-root":
+			if i+1 < len(args) {
+				options.SourceRoot = args[i+1]
+				i++
+			}
+		case "--all-pages":
+			options.AllPages = true
+		case "--in-place":
+			options.InPlace = true
+		case "--force":
+			options.Force = true
+		case "--tag":
+			options.TagOutputs = true
+		case "--no-manifest":
+			useManifest = false
+		case "--preserve":
+			options.PreserveAttributes = true
+		case "--backup-dir":
+			if i+1 < len(args) {
+				options.BackupDir = args[i+1]
+				i++
+			}
+		case "--journal":
+			if i+1 < len(args) {
+				journalPath = args[i+1]
+				i++
+			}
+		case "--max-megapixels":
+			if i+1 < len(args) {
+				var megapixels float64
+				fmt.Sscanf(args[i+1], "%g", &megapixels)
+				options.Limits.MaxPixels = int64(megapixels * 1000000)
+				i++
+			}
+		case "--max-dimension":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &options.Limits.MaxDimension)
+				i++
+			}
+		case "--max-file-size":
+			if i+1 < len(args) {
+				var megabytes float64
+				fmt.Sscanf(args[i+1], "%g", &megabytes)
+				options.Limits.MaxFileSize = int64(megabytes * 1024 * 1024)
+				i++
+			}
+		case "--max-frames":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &options.Limits.MaxFrames)
+				i++
+			}
+		case "--workers", "-j":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &options.Workers)
+				i++
+			}
+		case "--memory":
+			if i+1 < len(args) {
+				var megabytes float64
+				fmt.Sscanf(args[i+1], "%g", &megabytes)
+				options.MemoryBudget = int64(megabytes * 1024 * 1024)
+				i++
+			}
+		case "--largest-first":
+			options.LargestFirst = true
+		case "--placeholder":
+			options.Placeholder = true
+		case "--source-quality":
+			if i+1 < len(args) {
+				policy, err := compressor.ParseSourceQuality(args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				options.SourceQuality = policy
+				i++
+			}
+		case "--if-exists":
+			if i+1 < len(args) {
+				options.IfExists = parseExistingPolicy(args[i+1])
+				i++
+			}
+		case "--stream":
+			stream = true
+		case "--json":
+			jsonOutput = true
+		case "--format", "-f":
+			if i+1 < len(args) {
+				format, err := compressor.ParseOutputFormat(args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				options.OutputFormat = format
 				i++
 			}
 		default:
-			// Assume it's a file path
-			files = append(files, args[i])
+			if next, ok := parseScanFlag(args, i, &scan); ok {
+				i = next
+			} else {
+				// Assume it's a file path
+				files = append(files, args[i])
+			}
+		}
+	}
+
+	// Runs into an output directory only redo what changed
+	if cliMode && useManifest && options.OutputDir != "" && !options.InPlace {
+		manifest, err := compressor.OpenManifest(options.OutputDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
+		options.Manifest = manifest
 	}
 
-	// Expand glob patterns
+	// Expand glob patterns; directories contribute every image below them
+	// except earlier outputs. Streamed directories are scanned during the run.
+	stream = stream && cliMode
 	var expandedFiles []string
+	var scanRoots []string
 	for _, pattern := range files {
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			scanRoots = append(scanRoots, pattern)
+			if stream {
+				continue
+			}
+			found, err := api.NewImageAPI().ScanInputs(pattern, scan, options)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			expandedFiles = append(expandedFiles, found...)
+			continue
+		}
 		matches, err := filepath.Glob(pattern)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error expanding pattern %s: %v\n", pattern, err)
@@ -82,12 +264,40 @@ func main() {
 		}
 	}
 
+	if options.InPlace && options.OutputDir != "" {
+		fmt.Fprintln(os.Stderr, "Error: --in-place cannot be combined with --output")
+		os.Exit(1)
+	}
+	if options.MirrorTree && options.OutputTemplate != "" {
+		fmt.Fprintln(os.Stderr, "Error: use {rel} in --output-template instead of --mirror")
+		os.Exit(1)
+	}
+
+	// A single scanned directory is the root mirrored outputs are relative to
+	if options.SourceRoot == "" && len(scanRoots) == 1 {
+		options.SourceRoot = scanRoots[0]
+	}
+
 	if cliMode {
+		if journalPath != "" {
+			journal, err := compressor.OpenJournal(journalPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer journal.Close()
+			options.Journal = journal
+		}
+
 		// Run in CLI mode (no TUI)
-		runCLI(expandedFiles, outputDir, quality, compressionLevel)
+		if stream {
+			runStream(expandedFiles, scanRoots, scan, options, jsonOutput)
+		} else {
+			runCLI(expandedFiles, options, jsonOutput)
+		}
 	} else {
 		// Start TUI with files
-		if err := tui.Run(expandedFiles); err != nil {
+		if err := tui.Run(expandedFiles, options, scan); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -98,7 +308,36 @@ func printUsage() {
 	fmt.Println(`ImgShrink - Image Compression Tool
 
 Usage:
-  imgshrink [options] [files...]
+  imgshrink [options] [files or directories...]
+  imgshrink favicon [-o dir] [--if-exists policy] <image>
+  imgshrink atlas [atlas options] <files or directories...>
+  imgshrink info [--json] [--alpha [--max-megapixels N]] <files...>
+  imgshrink undo <journal>
+  imgshrink check-extensions [--json] [scan options] <files or directories...>
+  imgshrink fix-extensions [-n] [--json] [scan options] <files or directories...>
+
+Commands:
+  favicon          Generate favicon.ico, apple-touch and Android icons,
+                   site.webmanifest and the matching <link> tags
+  atlas            Pack images into one PNG sprite sheet with JSON and CSS maps
+  undo             Restore originals and remove outputs recorded in a journal
+  check-extensions  List images whose extension does not match their
+                   contents, found by file signature (exit status 1 if any)
+  fix-extensions   Rename those images to the right extension, never over an
+                   existing file; -n, --dry-run only shows the renames
+  info             Show color model, bit depth, alpha, DPI, ICC profile,
+                   EXIF highlights and PNG chunks from the headers; --alpha
+                   decodes images up to --max-megapixels (default: 268) to
+                   tell whether their alpha is used
+
+Atlas options:
+  -o, --output     Output directory
+  -n, --name       Base name of the written files (default: atlas)
+  -p, --padding    Pixels between sprites (default: 2)
+      --pot        Power-of-two atlas dimensions
+      --max-size   Maximum atlas width and height (default: 4096)
+      --if-exists  What to do when the atlas exists, as for compression
+                   (also accepted by favicon)
 
 Options:
   -h, --help       Show this help message
@@ -107,6 +346,68 @@ Options:
   -o, --output     Output directory
   -q, --quality    JPEG quality (1-100, default: 85)
   -l, --level      PNG compression level (0-9, default: 6)
+  -f, --format     Output format: jpeg, png, tiff, bmp, qoi or auto
+                   (default: same as input, auto for TIFF/BMP)
+  -t, --output-template  Output path template, relative to --output when set.
+                   Placeholders: {dir} {name} {ext} {fmt} {suffix} {w} {h}
+                   {q} {hash} {hash:N} {date} {rel}
+      --mirror     Reproduce each input's directory under --output instead of
+                   flattening them (relative to a single scanned directory,
+                   or --source-root)
+      --source-root  Directory {rel} and --mirror are relative to
+                   (default: the scanned directory, or the working dir)
+      --config     Load options from a JSON file; other flags override it
+      --all-pages  Write every page of multi-page TIFFs separately
+      --if-exists  When an output already exists: overwrite (default), skip,
+                   skip-newer (skip when it is newer than the source),
+                   rename (name-1.ext, name-2.ext, ...) or fail
+      --in-place   Replace originals when the result is smaller, keeping
+                   their permissions and modification time
+      --tag        Mark written files with a user.imgshrink xattr (or a
+                   .imgshrink-tags.json sidecar) so later --tag runs with
+                   the same version and options skip them
+      --force      Redo tagged inputs and inputs the output directory's
+                   manifest lists as unchanged since the last run
+      --no-manifest  Do not read or write the manifest kept in --output
+      --preserve   Copy each source's permissions, access and modification
+                   times and user xattrs to its output
+      --backup-dir Copy replaced originals and overwritten outputs here,
+                   mirroring their paths
+      --journal    Append every written or replaced file to this JSON lines
+                   journal for "imgshrink undo"; replaced files are backed
+                   up to <journal>.backup unless --backup-dir is set
+      --source-quality  For JPEG sources saved at or below --quality: ignore,
+                   cap (never raise the quality) or skip (leave them alone)
+      --max-megapixels  Refuse images larger than this (default: 268, 0 = no limit)
+      --max-dimension   Refuse images with a longer side (default: 65535)
+      --max-file-size   Refuse files larger than this many MB (default: 1024)
+      --max-frames      Refuse TIFFs/APNGs with more pages or frames (default: 1000)
+  -j, --workers    Concurrent jobs (default: number of CPUs)
+      --memory     Memory budget in MB for images being processed at once
+                   (default: 2048, 0 = no limit)
+      --largest-first  Start the largest images first
+      --placeholder  Compute a BlurHash, dominant color and tiny data-URI
+                   preview for every image
+      --json       Print results as JSON (CLI mode)
+
+Directory scanning (also for check-extensions and fix-extensions):
+      --include    Only take files matching this glob (repeatable)
+      --exclude    Leave out files and directories matching this glob
+                   (repeatable); globs use .gitignore syntax
+      --no-ignore  Do not read .imgshrinkignore files
+      --hidden     Include dot files and dot directories
+      --follow-symlinks  Descend into symlinked directories (each once)
+      --stream     Start compressing while directories are still being
+                   scanned (CLI mode); an input whose output an earlier one
+                   claims fails instead of stopping the batch, and
+                   --largest-first has no effect
+      --scan-workers  Directories read at once (default: number of CPUs)
+      --max-depth  Subdirectory levels to descend (default: 0 = unlimited)
+      --larger-than   Only files of at least this size (e.g. 200K, 1.5M)
+      --smaller-than  Only files of at most this size
+      --min-dimensions  Only images at least this large (e.g. 800x600)
+      --newer-than Only files modified since a date (2006-01-02 or RFC 3339)
+                   or within a duration (e.g. 36h, 7d)
 
 Examples:
   imgshrink                          # Start TUI
@@ -114,72 +415,805 @@ Examples:
   imgshrink *.png                    # Start TUI with multiple files
   imgshrink -c -q 80 image.jpg       # CLI mode with quality 80
   imgshrink -c -o ./output *.jpg     # CLI mode with output directory
+  imgshrink -c -f auto *.png         # CLI mode keeping the smallest format
+  imgshrink -c -t '{dir}/{name}.{w}x{h}.{ext}' *.jpg  # Sizes in names
+  imgshrink -c -t 'dist/{hash:8}.{ext}' assets/*.png  # Content-hashed names
+  imgshrink -c -o out --mirror photos/  # out/ mirrors the tree below photos/
+  imgshrink -c -o out photos/*.jpg   # Rerun: only new or changed photos
+  imgshrink -c --in-place --backup-dir .orig --journal run.jsonl photos/*.jpg
+  imgshrink undo run.jsonl           # Put the originals back
+  imgshrink -c --in-place --tag photos/  # Safe to rerun: tagged files are skipped
+  imgshrink -c --exclude 'thumbs/' --larger-than 500K photos/
+  imgshrink -c -o out --mirror --stream --scan-workers 32 /mnt/nas/photos
+  imgshrink -c --json --placeholder *.jpg  # JSON results with placeholders
+  imgshrink favicon -o public logo.png  # Favicon set in ./public
+  imgshrink atlas --pot -o dist icons/   # Sprite sheet from a directory
+  imgshrink info photo.jpg           # Inspect an image
+  imgshrink fix-extensions -n archive/  # Preview renaming misnamed images
 
-Supported formats: JPEG (.jpg, .jpeg), PNG (.png)`)
+Supported formats: JPEG (.jpg, .jpeg), PNG (.png), TIFF (.tif, .tiff),
+                   BMP (.bmp), QOI (.qoi), SVG (.svg)`)
 }
 
-func runCLI(files []string, outputDir string, quality, compressionLevel int) {
+func runCLI(files []string, options compressor.CompressionOptions, jsonOutput bool) {
 	if len(files) == 0 {
 		fmt.Println("No files specified")
 		os.Exit(1)
 	}
 
 	imageAPI := api.NewImageAPI()
-	options := compressor.DefaultOptions()
-	options.Quality = quality
-	options.CompressionLevel = compressionLevel
-	if outputDir != "" {
-		options.OutputDir = outputDir
+
+	if jsonOutput {
+		runJSON(imageAPI, files, options)
+		return
 	}
 
 	fmt.Printf("Compressing %d file(s)...\n\n", len(files))
 
-	var totalInput, totalOutput int64
-	var successCount, failCount int
+	// Print results as they complete
+	progress := make(chan *compressor.CompressionResult)
+	done := make(chan struct{})
+	go func() {
+		for result := range progress {
+			printResult(result)
+		}
+		close(done)
+	}()
+
+	batch, err := imageAPI.BatchCompress(files, options, progress)
+	close(progress)
+	<-done
+	saveManifest(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printCollisions(err)
+		os.Exit(1)
+	}
+
+	printSummary(batch)
+}
+
+// printSummary prints the totals of a batch
+func printSummary(batch *api.BatchResult) {
+	fmt.Println()
+	fmt.Println("─────────────────────────────────────")
+	fmt.Printf("Completed: %d successful, %d failed", batch.SuccessCount, batch.FailCount)
+	if batch.SkipCount > 0 {
+		fmt.Printf(", %d skipped", batch.SkipCount)
+	}
+	fmt.Println()
+	if batch.SuccessCount > 0 {
+		fmt.Printf("Total: %s → %s (%.1f%% reduction)\n",
+			compressor.FormatBytes(batch.TotalInput),
+			compressor.FormatBytes(batch.TotalOutput),
+			batch.TotalReduction)
+		fmt.Printf("Saved: %s\n", compressor.FormatBytes(batch.TotalInput-batch.TotalOutput))
+	}
+}
+
+func printResult(result *compressor.CompressionResult) {
+	switch {
+	case result.Skipped:
+		fmt.Printf("- %s: skipped (%s)\n", result.InputPath, result.SkipReason)
+	case result.Success:
+		fmt.Printf("✓ %s\n", result.InputPath)
+		fmt.Printf("  %s → %s (%.1f%% reduction)\n",
+			compressor.FormatBytes(result.InputSize),
+			compressor.FormatBytes(result.OutputSize),
+			result.Reduction)
+		fmt.Printf("  Output: %s\n", result.OutputPath)
+		if result.Existing != "" {
+			fmt.Printf("  Existing output: %s\n", result.Existing)
+		}
+		if result.BackupPath != "" {
+			fmt.Printf("  Backup: %s\n", result.BackupPath)
+		}
+		for _, page := range result.Pages[min(1, len(result.Pages)):] {
+			fmt.Printf("          %s\n", page.OutputPath)
+		}
+		if len(result.Candidates) > 0 {
+			printCandidates(result.Candidates)
+		}
+		if p := result.Placeholder; p != nil {
+			fmt.Printf("  BlurHash: %s  Color: %s  Preview: %dx%d, %s\n",
+				p.BlurHash, p.DominantColor, p.Width, p.Height,
+				compressor.FormatBytes(int64(len(p.DataURI))))
+		}
+	default:
+		// Limit errors name their file already
+		var limitErr *compressor.LimitError
+		if errors.As(result.Error, &limitErr) {
+			fmt.Printf("✗ %v\n", result.Error)
+		} else {
+			fmt.Printf("✗ %s: %v\n", result.InputPath, result.Error)
+		}
+	}
+}
+
+// runJSON compresses files and prints every result, failures included, as a
+// JSON array on stdout in input order
+func runJSON(imageAPI *api.ImageAPI, files []string, options compressor.CompressionOptions) {
+	batch, err := imageAPI.BatchCompress(files, options, nil)
+	saveManifest(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printCollisions(err)
+		os.Exit(1)
+	}
+
+	order := make(map[string]int, len(files))
+	for i, file := range files {
+		order[file] = i
+	}
+	results := batch.Results
+	sort.SliceStable(results, func(a, b int) bool {
+		return order[results[a].InputPath] < order[results[b].InputPath]
+	})
+	printJSON(batch)
+}
+
+// printJSON prints the results of a batch as a JSON array and exits with an
+// error status when any failed
+func printJSON(batch *api.BatchResult) {
+	encodeJSON(batch.Results)
+	if batch.FailCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// runStream compresses files and the images below dirs, starting while the
+// directories are still being scanned
+func runStream(files, dirs []string, scan api.ScanOptions, options compressor.CompressionOptions, jsonOutput bool) {
+	imageAPI := api.NewImageAPI()
+
+	inputs := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(inputs)
+		for _, file := range files {
+			inputs <- file
+		}
+		for _, dir := range dirs {
+			s, err := imageAPI.StreamInputs(dir, scan, options)
+			if err != nil {
+				scanErr <- err
+				return
+			}
+			for path := range s.Paths() {
+				inputs <- path
+			}
+			if err := s.Err(); err != nil {
+				scanErr <- err
+				return
+			}
+		}
+	}()
+
+	var progress chan *compressor.CompressionResult
+	done := make(chan struct{})
+	if jsonOutput {
+		close(done)
+	} else {
+		fmt.Printf("Compressing while scanning %s...\n\n", strings.Join(dirs, ", "))
+		progress = make(chan *compressor.CompressionResult)
+		go func() {
+			for result := range progress {
+				printResult(result)
+			}
+			close(done)
+		}()
+	}
+
+	batch, err := imageAPI.BatchCompressStream(inputs, options, progress)
+	if progress != nil {
+		close(progress)
+	}
+	<-done
+	saveManifest(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Images found before a scan failed are still compressed
+	scanFailed := false
+	select {
+	case err := <-scanErr:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		scanFailed = true
+	default:
+	}
+
+	if jsonOutput {
+		sort.SliceStable(batch.Results, func(a, b int) bool {
+			return batch.Results[a].InputPath < batch.Results[b].InputPath
+		})
+		printJSON(batch)
+	} else {
+		printSummary(batch)
+	}
+	if scanFailed {
+		os.Exit(1)
+	}
+}
+
+// parseExistingPolicy parses the value of --if-exists, exiting on a bad one
+func parseExistingPolicy(name string) compressor.ExistingPolicy {
+	policy, err := compressor.ParseExistingPolicy(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return policy
+}
+
+// saveManifest writes the manifest of an incremental run, if there is one
+func saveManifest(options compressor.CompressionOptions) {
+	if options.Manifest == nil {
+		return
+	}
+	if err := options.Manifest.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printCollisions lists every output claimed by several inputs
+func printCollisions(err error) {
+	var collisionErr *compressor.CollisionError
+	if !errors.As(err, &collisionErr) || len(collisionErr.Collisions) < 2 {
+		return
+	}
+	for _, collision := range collisionErr.Collisions {
+		fmt.Fprintf(os.Stderr, "  %s ← %s\n", collision.OutputPath, strings.Join(collision.Inputs, ", "))
+	}
+}
+
+func printCandidates(candidates []compressor.FormatCandidate) {
+	fmt.Printf("  Format candidates:\n")
+	for _, c := range candidates {
+		switch {
+		case c.Selected:
+			fmt.Printf("    ✓ %-12s %s\n", c.Name(), compressor.FormatBytes(c.Size))
+		case c.Eligible:
+			fmt.Printf("      %-12s %s\n", c.Name(), compressor.FormatBytes(c.Size))
+		default:
+			fmt.Printf("      %-12s skipped (%s)\n", c.Name(), c.Reason)
+		}
+	}
+}
+
+func runFavicon(args []string) {
+	var source, outputDir string
+	imageAPI := api.NewImageAPI()
+	options := imageAPI.GetDefaultOptions()
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--output", "-o":
+			if i+1 < len(args) {
+				outputDir = args[i+1]
+				i++
+			}
+		case "--if-exists":
+			if i+1 < len(args) {
+				options.IfExists = parseExistingPolicy(args[i+1])
+				i++
+			}
+		default:
+			source = args[i]
+		}
+	}
+
+	if source == "" {
+		fmt.Println("No source image specified")
+		os.Exit(1)
+	}
+
+	set, err := imageAPI.GenerateFavicons(source, outputDir, options)
+	if err != nil {
+		fmt.Printf("✗ %s: %v\n", source, err)
+		os.Exit(1)
+	}
+
+	for _, file := range set.Files {
+		if file.Skipped {
+			fmt.Printf("- %-40s skipped (%s)\n", file.OutputPath, file.SkipReason)
+			continue
+		}
+		fmt.Printf("✓ %-40s %4dx%-4d %s\n", file.OutputPath, file.Width, file.Height, compressor.FormatBytes(file.OutputSize))
+	}
+	fmt.Printf("✓ %s\n", set.ManifestPath)
+	fmt.Println()
+	fmt.Println("Add to <head>:")
+	fmt.Println(set.HTML)
+}
+
+func runAtlas(args []string) {
+	atlasOptions := compressor.DefaultAtlasOptions()
+	imageAPI := api.NewImageAPI()
+	options := imageAPI.GetDefaultOptions()
+	var inputs []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--if-exists":
+			if i+1 < len(args) {
+				options.IfExists = parseExistingPolicy(args[i+1])
+				i++
+			}
+		case "--output", "-o":
+			if i+1 < len(args) {
+				atlasOptions.OutputDir = args[i+1]
+				i++
+			}
+		case "--name", "-n":
+			if i+1 < len(args) {
+				atlasOptions.Name = args[i+1]
+				i++
+			}
+		case "--padding", "-p":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &atlasOptions.Padding)
+				i++
+			}
+		case "--max-size":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &atlasOptions.MaxSize)
+				i++
+			}
+		case "--pot":
+			atlasOptions.PowerOfTwo = true
+		default:
+			inputs = append(inputs, args[i])
+		}
+	}
 
-	for _, file := range files {
-		// Validate file
-		if err := imageAPI.ValidateImage(file); err != nil {
-			fmt.Printf("✗ %s: %v\n", file, err)
-			failCount++
+	// Directories contribute every image they contain
+	var files []string
+	for _, input := range inputs {
+		if info, err := os.Stat(input); err == nil && info.IsDir() {
+			found, err := imageAPI.ScanDirectory(input, api.DefaultScanOptions())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			files = append(files, found...)
 			continue
 		}
+		matches, _ := filepath.Glob(input)
+		if len(matches) == 0 {
+			matches = []string{input}
+		}
+		files = append(files, matches...)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No files specified")
+		os.Exit(1)
+	}
+
+	result, err := imageAPI.PackAtlas(files, atlasOptions, options)
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		os.Exit(1)
+	}
+	if result.Image.Skipped {
+		fmt.Printf("- %s skipped (%s)\n", result.Image.OutputPath, result.Image.SkipReason)
+		return
+	}
+
+	fmt.Printf("✓ Packed %d images into %s (%dx%d, %s)\n",
+		len(result.Sprites), result.Image.OutputPath,
+		result.Image.Width, result.Image.Height,
+		compressor.FormatBytes(result.Image.OutputSize))
+	fmt.Printf("✓ %s\n", result.JSONPath)
+	fmt.Printf("✓ %s\n", result.CSSPath)
+}
+
+func runInfo(args []string) {
+	jsonOutput := false
+	infoOptions := compressor.InfoOptions{Limits: compressor.DefaultLimits()}
+	var files []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			jsonOutput = true
+		case "--alpha":
+			infoOptions.CheckAlpha = true
+		case "--max-megapixels":
+			if i+1 < len(args) {
+				var megapixels float64
+				fmt.Sscanf(args[i+1], "%g", &megapixels)
+				infoOptions.Limits.MaxPixels = int64(megapixels * 1000000)
+				i++
+			}
+		default:
+			matches, _ := filepath.Glob(args[i])
+			if len(matches) == 0 {
+				matches = []string{args[i]}
+			}
+			files = append(files, matches...)
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No files specified")
+		os.Exit(1)
+	}
+
+	imageAPI := api.NewImageAPI()
+	var infos []*compressor.ImageInfo
+	failed := false
 
-		// Compress
-		result, err := imageAPI.CompressImage(file, options)
+	for i, file := range files {
+		info, err := imageAPI.GetImageInfoWithOptions(file, infoOptions)
 		if err != nil {
-			fmt.Printf("✗ %s: %v\n", file, err)
-			failCount++
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", file, err)
+			failed = true
 			continue
 		}
+		if jsonOutput {
+			infos = append(infos, info)
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printInfo(info)
+	}
 
-		if result.Success {
-			successCount++
-			totalInput += result.InputSize
-			totalOutput += result.OutputSize
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(infos); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
 
-			fmt.Printf("✓ %s\n", file)
-			fmt.Printf("  %s → %s (%.1f%% reduction)\n",
-				compressor.FormatBytes(result.InputSize),
-				compressor.FormatBytes(result.OutputSize),
-				result.Reduction)
-			fmt.Printf("  Output: %s\n", result.OutputPath)
+func printInfo(info *compressor.ImageInfo) {
+	fmt.Println(info.Path)
+	fmt.Printf("  Format:      %s, %dx%d, %s\n", strings.ToUpper(string(info.Format)), info.Width, info.Height, compressor.FormatBytes(info.Size))
+	if info.Frames > 1 {
+		fmt.Printf("  Frames:      %d\n", info.Frames)
+	}
+
+	color := info.ColorMode
+	if info.BitDepth > 0 {
+		color += fmt.Sprintf(", %d-bit", info.BitDepth)
+	}
+	if info.ChromaSubsampling != "" {
+		color += ", " + info.ChromaSubsampling
+	}
+	if info.Quality > 0 {
+		color += fmt.Sprintf(", quality ~%d", info.Quality)
+	}
+	if info.Progressive {
+		if info.Format == compressor.FormatPNG {
+			color += ", interlaced"
 		} else {
-			failCount++
-			fmt.Printf("✗ %s: %v\n", file, result.Error)
+			color += ", progressive"
 		}
 	}
+	fmt.Printf("  Color:       %s\n", color)
 
-	// Summary
-	fmt.Println()
-	fmt.Println("─────────────────────────────────────")
-	fmt.Printf("Completed: %d successful, %d failed\n", successCount, failCount)
-	if successCount > 0 {
-		reduction := compressor.CalculateReduction(totalInput, totalOutput)
-		fmt.Printf("Total: %s → %s (%.1f%% reduction)\n",
-			compressor.FormatBytes(totalInput),
-			compressor.FormatBytes(totalOutput),
-			reduction)
-		fmt.Printf("Saved: %s\n", compressor.FormatBytes(totalInput-totalOutput))
+	switch {
+	case info.AlphaUsed:
+		fmt.Printf("  Alpha:       used\n")
+	case info.HasAlpha && info.AlphaChecked:
+		fmt.Printf("  Alpha:       present, fully opaque\n")
+	case info.HasAlpha:
+		fmt.Printf("  Alpha:       present (--alpha checks whether it is used)\n")
+	default:
+		fmt.Printf("  Alpha:       none\n")
+	}
+
+	if info.DPIX > 0 {
+		fmt.Printf("  DPI:         %.0fx%.0f\n", info.DPIX, info.DPIY)
+	}
+	if info.ICCProfile != "" {
+		fmt.Printf("  ICC profile: %s\n", info.ICCProfile)
+	}
+	if exif := info.EXIF; exif != nil {
+		if camera := exif.Camera(); camera != "" {
+			fmt.Printf("  Camera:      %s\n", camera)
+		}
+		if exif.DateTime != "" {
+			fmt.Printf("  Taken:       %s\n", exif.DateTime)
+		}
+		if exif.Orientation > 1 {
+			fmt.Printf("  Orientation: %d\n", exif.Orientation)
+		}
+		if exif.HasGPS {
+			fmt.Printf("  GPS:         present\n")
+		}
+	}
+	if len(info.Chunks) > 0 {
+		fmt.Printf("  Chunks:      %s\n", strings.Join(info.Chunks, " "))
+	}
+}
+
+func runUndo(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: imgshrink undo <journal>")
+		os.Exit(1)
+	}
+
+	results, err := api.NewImageAPI().Undo(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Error != nil:
+			failed++
+			fmt.Printf("✗ %s: %v\n", result.Entry.OutputPath, result.Error)
+		case result.Action == "unchanged":
+			fmt.Printf("- %s: already undone\n", result.Entry.OutputPath)
+		default:
+			fmt.Printf("✓ %s %s\n", result.Action, result.Entry.OutputPath)
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runExtensions reports the images among files and below directories whose
+// extension does not match their contents, and with fix renames them
+func runExtensions(args []string, fix bool) {
+	scan := api.DefaultScanOptions()
+	dryRun := false
+	jsonOutput := false
+	var paths []string
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--json":
+			jsonOutput = true
+		default:
+			if next, ok := parseScanFlag(args, i, &scan); ok {
+				i = next
+			} else {
+				paths = append(paths, args[i])
+			}
+		}
+	}
+
+	if len(paths) == 0 {
+		if fix {
+			fmt.Println("Usage: imgshrink fix-extensions [--dry-run] [--json] [scan options] <files or directories...>")
+		} else {
+			fmt.Println("Usage: imgshrink check-extensions [--json] [scan options] <files or directories...>")
+		}
+		os.Exit(1)
+	}
+
+	imageAPI := api.NewImageAPI()
+	var misnamed []compressor.Misnamed
+	failed := 0
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if info.IsDir() {
+			found, err := imageAPI.FindMisnamed(path, scan)
+			var unchecked interface{ Unwrap() []error }
+			if errors.As(err, &unchecked) {
+				// Files that could not be checked, the rest was
+				for _, fileErr := range unchecked.Unwrap() {
+					fmt.Fprintf(os.Stderr, "✗ %v\n", fileErr)
+					failed++
+				}
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			misnamed = append(misnamed, found...)
+			continue
+		}
+
+		m, err := compressor.CheckExtension(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		if m != nil {
+			misnamed = append(misnamed, *m)
+		}
+	}
+
+	if !fix {
+		if jsonOutput {
+			encodeJSON(append([]compressor.Misnamed{}, misnamed...))
+		} else {
+			for _, m := range misnamed {
+				fmt.Printf("%s: %s → %s\n", m.Path, describeMisnamed(m), m.Suggested)
+			}
+			fmt.Printf("%d misnamed image(s)\n", len(misnamed))
+		}
+		if failed > 0 || len(misnamed) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	fixes := imageAPI.FixExtensions(misnamed, dryRun)
+	if jsonOutput {
+		encodeJSON(append([]api.ExtensionFix{}, fixes...))
+	}
+	renamed := 0
+	for _, fix := range fixes {
+		switch {
+		case fix.Error != nil:
+			failed++
+			if !jsonOutput {
+				fmt.Printf("✗ %s: %v\n", fix.Path, fix.Error)
+			}
+		case fix.Renamed:
+			renamed++
+			if !jsonOutput {
+				fmt.Printf("✓ %s → %s\n", fix.Path, fix.Suggested)
+			}
+		default:
+			if !jsonOutput {
+				fmt.Printf("  %s → %s (%s)\n", fix.Path, fix.Suggested, describeMisnamed(fix.Misnamed))
+			}
+		}
+	}
+
+	if !jsonOutput {
+		if dryRun {
+			fmt.Printf("Would rename %d file(s), %d failed\n", len(fixes)-failed, failed)
+		} else {
+			fmt.Printf("Renamed %d file(s), %d failed\n", renamed, failed)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// describeMisnamed says what a misnamed image is and what its name claims
+func describeMisnamed(m compressor.Misnamed) string {
+	if m.Named == "" {
+		return fmt.Sprintf("%s without an image extension", m.Format)
+	}
+	return fmt.Sprintf("%s named as %s", m.Format, m.Named)
+}
+
+// encodeJSON prints v as indented JSON on stdout
+func encodeJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseScanFlag applies the directory scanning flag at args[i] to scan and
+// returns the index of its last argument, or false when args[i] is not one
+func parseScanFlag(args []string, i int, scan *api.ScanOptions) (int, bool) {
+	switch args[i] {
+	case "--include":
+		if i+1 < len(args) {
+			scan.Include = append(scan.Include, args[i+1])
+			i++
+		}
+	case "--exclude":
+		if i+1 < len(args) {
+			scan.Exclude = append(scan.Exclude, args[i+1])
+			i++
+		}
+	case "--no-ignore":
+		scan.IgnoreFiles = false
+	case "--hidden":
+		scan.Hidden = true
+	case "--follow-symlinks":
+		scan.FollowSymlinks = true
+	case "--scan-workers":
+		if i+1 < len(args) {
+			fmt.Sscanf(args[i+1], "%d", &scan.Workers)
+			i++
+		}
+	case "--max-depth":
+		if i+1 < len(args) {
+			fmt.Sscanf(args[i+1], "%d", &scan.MaxDepth)
+			i++
+		}
+	case "--larger-than", "--smaller-than":
+		if i+1 < len(args) {
+			size, err := parseSize(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if args[i] == "--larger-than" {
+				scan.MinSize = size
+			} else {
+				scan.MaxSize = size
+			}
+			i++
+		}
+	case "--min-dimensions":
+		if i+1 < len(args) {
+			if _, err := fmt.Sscanf(args[i+1], "%dx%d", &scan.MinWidth, &scan.MinHeight); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid dimensions %q, expected WxH\n", args[i+1])
+				os.Exit(1)
+			}
+			i++
+		}
+	case "--newer-than":
+		if i+1 < len(args) {
+			since, err := parseSince(args[i+1], time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			scan.ModifiedSince = since
+			i++
+		}
+	default:
+		return i, false
+	}
+	return i, true
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix (powers of
+// 1024)
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(value), "B")
+	multiplier := 1.0
+	if n := len(number); n > 0 {
+		switch number[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			number = number[:n-1]
+		}
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return int64(size * multiplier), nil
+}
+
+// parseSince parses a date, an RFC 3339 time, or a duration before now; days
+// are written as "7d"
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n * float64(24*time.Hour))), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
 	}
+	return time.Time{}, fmt.Errorf("invalid date or duration: %s", value)
 }
@@ -0,0 +1,252 @@
+// Package qoi implements a decoder and encoder for the Quite OK Image format.
+//
+// The specification is at https://qoiformat.org/qoi-specification.pdf.
+// Importing this package registers the decoder with the image package.
+package qoi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	magic      = "qoif"
+	headerSize = 14
+
+	opIndex = 0x00 // 00xxxxxx
+	opDiff  = 0x40 // 01xxxxxx
+	opLuma  = 0x80 // 10xxxxxx
+	opRun   = 0xc0 // 11xxxxxx
+	opRGB   = 0xfe // 11111110
+	opRGBA  = 0xff // 11111111
+	mask2   = 0xc0
+
+	// maxPixels guards against headers that claim absurd dimensions
+	maxPixels = 400000000
+)
+
+var padding = [8]byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+// ErrFormat is returned when the input is not a valid QOI image
+var ErrFormat = errors.New("qoi: invalid format")
+
+func init() {
+	image.RegisterFormat("qoi", magic, Decode, DecodeConfig)
+}
+
+type header struct {
+	width, height uint32
+	channels      uint8
+	colorspace    uint8
+}
+
+func readHeader(r io.Reader) (header, error) {
+	var buf [headerSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return header{}, err
+	}
+	if string(buf[:4]) != magic {
+		return header{}, ErrFormat
+	}
+
+	h := header{
+		width:      binary.BigEndian.Uint32(buf[4:8]),
+		height:     binary.BigEndian.Uint32(buf[8:12]),
+		channels:   buf[12],
+		colorspace: buf[13],
+	}
+	if h.width == 0 || h.height == 0 || h.channels < 3 || h.channels > 4 || h.colorspace > 1 {
+		return header{}, ErrFormat
+	}
+	if uint64(h.width)*uint64(h.height) > maxPixels {
+		return header{}, errors.New("qoi: image too large")
+	}
+	return h, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a QOI image without
+// decoding the entire image
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(h.width),
+		Height:     int(h.height),
+	}, nil
+}
+
+// Decode reads a QOI image from r and returns it as an *image.NRGBA
+func Decode(r io.Reader) (image.Image, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	img := image.NewNRGBA(image.Rect(0, 0, int(h.width), int(h.height)))
+
+	var index [64]color.NRGBA
+	px := color.NRGBA{A: 255}
+	run := 0
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			switch {
+			case b == opRGB:
+				var rgb [3]byte
+				if _, err := io.ReadFull(br, rgb[:]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				px.R, px.G, px.B = rgb[0], rgb[1], rgb[2]
+
+			case b == opRGBA:
+				var rgba [4]byte
+				if _, err := io.ReadFull(br, rgba[:]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				px = color.NRGBA{R: rgba[0], G: rgba[1], B: rgba[2], A: rgba[3]}
+
+			case b&mask2 == opIndex:
+				px = index[b]
+
+			case b&mask2 == opDiff:
+				px.R += (b>>4)&0x03 - 2
+				px.G += (b>>2)&0x03 - 2
+				px.B += b&0x03 - 2
+
+			case b&mask2 == opLuma:
+				b2, err := br.ReadByte()
+				if err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				vg := b&0x3f - 32
+				px.R += vg - 8 + (b2>>4)&0x0f
+				px.G += vg
+				px.B += vg - 8 + b2&0x0f
+
+			case b&mask2 == opRun:
+				run = int(b & 0x3f)
+			}
+
+			index[hash(px)] = px
+		}
+
+		img.Pix[i+0] = px.R
+		img.Pix[i+1] = px.G
+		img.Pix[i+2] = px.B
+		img.Pix[i+3] = px.A
+	}
+
+	return img, nil
+}
+
+// Encode writes m to w in QOI format. Images without transparency are stored
+// with three channels.
+func Encode(w io.Writer, m image.Image) error {
+	bounds := m.Bounds()
+	if bounds.Empty() {
+		return errors.New("qoi: empty image")
+	}
+	if uint64(bounds.Dx())*uint64(bounds.Dy()) > maxPixels {
+		return errors.New("qoi: image too large")
+	}
+
+	channels := uint8(4)
+	if o, ok := m.(interface{ Opaque() bool }); ok && o.Opaque() {
+		channels = 3
+	}
+
+	bw := bufio.NewWriter(w)
+
+	var hdr [headerSize]byte
+	copy(hdr[:4], magic)
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(bounds.Dy()))
+	hdr[12] = channels
+	hdr[13] = 0 // sRGB with linear alpha
+	bw.Write(hdr[:])
+
+	var index [64]color.NRGBA
+	prev := color.NRGBA{A: 255}
+	run := 0
+	last := bounds.Dx()*bounds.Dy() - 1
+
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x, n = x+1, n+1 {
+			px := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+
+			if px == prev {
+				run++
+				if run == 62 || n == last {
+					bw.WriteByte(opRun | byte(run-1))
+					run = 0
+				}
+				continue
+			}
+
+			if run > 0 {
+				bw.WriteByte(opRun | byte(run-1))
+				run = 0
+			}
+
+			h := hash(px)
+			switch {
+			case index[h] == px:
+				bw.WriteByte(opIndex | h)
+
+			case px.A == prev.A:
+				index[h] = px
+				vr := int8(px.R - prev.R)
+				vg := int8(px.G - prev.G)
+				vb := int8(px.B - prev.B)
+				vgr := vr - vg
+				vgb := vb - vg
+
+				switch {
+				case vr > -3 && vr < 2 && vg > -3 && vg < 2 && vb > -3 && vb < 2:
+					bw.WriteByte(opDiff | byte(vr+2)<<4 | byte(vg+2)<<2 | byte(vb+2))
+				case vgr > -9 && vgr < 8 && vg > -33 && vg < 32 && vgb > -9 && vgb < 8:
+					bw.WriteByte(opLuma | byte(vg+32))
+					bw.WriteByte(byte(vgr+8)<<4 | byte(vgb+8))
+				default:
+					bw.Write([]byte{opRGB, px.R, px.G, px.B})
+				}
+
+			default:
+				index[h] = px
+				bw.Write([]byte{opRGBA, px.R, px.G, px.B, px.A})
+			}
+
+			prev = px
+		}
+	}
+
+	bw.Write(padding[:])
+	return bw.Flush()
+}
+
+func hash(c color.NRGBA) byte {
+	return byte((int(c.R)*3 + int(c.G)*5 + int(c.B)*7 + int(c.A)*11) % 64)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package qoi
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// testImage fills a w x h image using px
+func testImage(w, h int, px func(x, y int) color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, px(x, y))
+		}
+	}
+	return img
+}
+
+func TestRoundTrip(t *testing.T) {
+	palette := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+
+	tests := []struct {
+		name         string
+		img          image.Image
+		wantChannels byte
+	}{
+		{"single pixel", testImage(1, 1, func(x, y int) color.NRGBA { return color.NRGBA{A: 255} }), 3},
+		{"long run", testImage(300, 2, func(x, y int) color.NRGBA { return color.NRGBA{10, 20, 30, 255} }), 3},
+		{"small differences", testImage(16, 16, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255}
+		}), 3},
+		{"luma differences", testImage(16, 16, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 20), uint8(x*20 + 3), uint8(x*20 - 5), 255}
+		}), 3},
+		{"large differences", testImage(16, 16, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 97), uint8(y * 61), uint8(x * y * 13), 255}
+		}), 3},
+		{"indexed repeats", testImage(9, 9, func(x, y int) color.NRGBA { return palette[(x+y)%len(palette)] }), 3},
+		{"alpha", testImage(16, 16, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 16), 128, uint8(y * 16), uint8(x * y)}
+		}), 4},
+		{"gray", image.NewGray(image.Rect(0, 0, 7, 5)), 3},
+		{"offset bounds", testImage(8, 8, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 30), uint8(y * 30), 0, 255}
+		}).SubImage(image.Rect(2, 3, 7, 8)), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.img); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			data := buf.Bytes()
+			if got := data[12]; got != tt.wantChannels {
+				t.Errorf("channels = %d, want %d", got, tt.wantChannels)
+			}
+			if !bytes.HasSuffix(data, padding[:]) {
+				t.Error("stream does not end with the padding")
+			}
+
+			decoded, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			bounds := tt.img.Bounds()
+			if decoded.Bounds() != image.Rect(0, 0, bounds.Dx(), bounds.Dy()) {
+				t.Fatalf("decoded bounds = %v, want %dx%d", decoded.Bounds(), bounds.Dx(), bounds.Dy())
+			}
+			for y := 0; y < bounds.Dy(); y++ {
+				for x := 0; x < bounds.Dx(); x++ {
+					want := color.NRGBAModel.Convert(tt.img.At(bounds.Min.X+x, bounds.Min.Y+y))
+					if got := decoded.At(x, y); got != want {
+						t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 12, 34))); err != nil {
+		t.Fatal(err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+	if format != "qoi" || config.Width != 12 || config.Height != 34 || config.ColorModel != color.NRGBAModel {
+		t.Errorf("DecodeConfig() = %+v, %q", config, format)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, testImage(8, 8, func(x, y int) color.NRGBA {
+		return color.NRGBA{uint8(x * 97), uint8(y * 61), 7, 255}
+	})); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	header := func(width, height uint32, channels, colorspace byte) []byte {
+		return []byte{'q', 'o', 'i', 'f',
+			byte(width >> 24), byte(width >> 16), byte(width >> 8), byte(width),
+			byte(height >> 24), byte(height >> 16), byte(height >> 8), byte(height),
+			channels, colorspace}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error // Nil accepts any error
+	}{
+		{"empty", nil, io.EOF},
+		{"bad magic", append([]byte("qoiF"), valid[4:]...), ErrFormat},
+		{"zero width", header(0, 1, 4, 0), ErrFormat},
+		{"two channels", header(1, 1, 2, 0), ErrFormat},
+		{"unknown colorspace", header(1, 1, 4, 2), ErrFormat},
+		{"too large", header(1<<16, 1<<16, 4, 0), nil},
+		{"truncated", valid[:headerSize+10], io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatal("Decode() succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	if err := Encode(io.Discard, image.NewNRGBA(image.Rectangle{})); err == nil {
+		t.Error("Encode() accepted an empty image")
+	}
+}
@@ -2,7 +2,10 @@ package tui
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -39,6 +42,9 @@ type Model struct {
 	progressModel ProgressModel
 	resultModel   ResultModel
 
+	// Journal of the running compression, for reverting it
+	journal *compressor.Journal
+
 	// Error handling
 	err error
 
@@ -52,7 +58,13 @@ type HomeModel struct {
 	cursor    int
 	inputPath string
 	mode      string // "single" or "batch"
+	infos     map[string]*compressor.ImageInfo
 	err       error
+
+	// Path being typed after "a", and the filters directories are scanned with
+	adding bool
+	scan   api.ScanOptions
+	status string
 }
 
 // OptionsModel is a simplified options view model
@@ -60,6 +72,14 @@ type OptionsModel struct {
 	options    compressor.CompressionOptions
 	focusIndex int
 	format     compressor.ImageFormat
+
+	// Output template being typed, applied once it validates
+	editingTemplate bool
+	templateInput   string
+	templateErr     string
+
+	// Why compression could not start
+	startErr string
 }
 
 // ProgressModel is a simplified progress view model
@@ -74,6 +94,8 @@ type ProgressModel struct {
 type ResultModel struct {
 	results []*compressor.CompressionResult
 	cursor  int
+	journal string // Journal of the session, empty when none was kept
+	status  string
 }
 
 // NewModel creates a new TUI application model
@@ -89,6 +111,8 @@ func NewModel() Model {
 		homeModel: HomeModel{
 			files: []string{},
 			mode:  "single",
+			infos: make(map[string]*compressor.ImageInfo),
+			scan:  api.DefaultScanOptions(),
 		},
 		optionsModel: OptionsModel{
 			options: compressor.DefaultOptions(),
@@ -110,10 +134,19 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
+		// Typing a template takes every key
+		if m.state == ViewOptions && m.optionsModel.editingTemplate {
+			return m.updateTemplateInput(msg)
+		}
+		if m.state == ViewHome && m.homeModel.adding {
+			return m.updatePathInput(msg)
+		}
+
 		// Global key bindings
 		switch msg.String() {
 		case "ctrl+c", "q":
 			if m.state == ViewResult || m.state == ViewHome {
+				m.discardJournal()
 				m.quitting = true
 				return m, tea.Quit
 			}
@@ -158,8 +191,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 			case ViewOptions:
+				// Refuse to start when inputs would overwrite each other's outputs
+				collisions, err := compressor.FindCollisions(m.homeModel.files, m.optionsModel.options)
+				if err == nil && len(collisions) > 0 {
+					err = &compressor.CollisionError{Collisions: collisions}
+				}
+				if err != nil {
+					m.optionsModel.startErr = err.Error()
+					return m, nil
+				}
+				m.optionsModel.startErr = ""
+
 				m.options = m.optionsModel.options
 				m.files = m.homeModel.files
+				m.journal = openSessionJournal()
+				m.options.Journal = m.journal
 				m.state = ViewProgress
 				m.progressModel = ProgressModel{
 					files:   m.files,
@@ -172,6 +218,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.resultModel = ResultModel{
 						results: m.results,
 					}
+					if m.journal != nil {
+						m.resultModel.journal = m.journal.Path()
+					}
 					m.state = ViewResult
 					return m, nil
 				}
@@ -180,6 +229,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "r":
 			// Restart from home
 			if m.state == ViewResult {
+				m.discardJournal()
 				m.state = ViewHome
 				m.homeModel.files = []string{}
 				m.results = nil
@@ -204,6 +254,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.progressModel.currentIndex++
 		if m.progressModel.currentIndex >= len(m.progressModel.files) {
 			m.progressModel.done = true
+			if m.journal != nil {
+				m.journal.Close()
+			}
 		}
 
 		// Continue with next file
@@ -259,9 +312,17 @@ func (m Model) renderFooter() string {
 
 	switch m.state {
 	case ViewHome:
-		hints = []string{"a: add file", "d: remove", "→: continue", "q: quit"}
+		if m.homeModel.adding {
+			hints = []string{"enter: add", "esc: cancel"}
+		} else {
+			hints = []string{"a: add file or directory", "d: remove", "→: continue", "q: quit"}
+		}
 	case ViewOptions:
-		hints = []string{"←: back", "→: compress", "tab: next field"}
+		if m.optionsModel.editingTemplate {
+			hints = []string{"enter: apply", "esc: cancel"}
+		} else {
+			hints = []string{"←: back", "→: compress", "tab: next field", "f: format", "n: name template"}
+		}
 	case ViewProgress:
 		if m.progressModel.done {
 			hints = []string{"→: view results"}
@@ -269,7 +330,7 @@ func (m Model) renderFooter() string {
 			hints = []string{"compressing..."}
 		}
 	case ViewResult:
-		hints = []string{"r: restart", "q: quit", "↑↓: navigate"}
+		hints = []string{"r: restart", "u: revert", "q: quit", "↑↓: navigate"}
 	}
 
 	var rendered []string
@@ -291,9 +352,18 @@ func (m Model) renderFooter() string {
 func (m Model) updateHome(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "a":
-		// Add a file (simplified - in real app would use file picker)
-		// For now, we'll use a text input approach
-		return m, nil
+		m.homeModel.adding = true
+		m.homeModel.inputPath = ""
+		m.homeModel.err = nil
+
+	case ".":
+		m.homeModel.scan.Hidden = !m.homeModel.scan.Hidden
+
+	case "s":
+		m.homeModel.scan.FollowSymlinks = !m.homeModel.scan.FollowSymlinks
+
+	case "i":
+		m.homeModel.scan.IgnoreFiles = !m.homeModel.scan.IgnoreFiles
 
 	case "d", "backspace":
 		if len(m.homeModel.files) > 0 && m.homeModel.cursor < len(m.homeModel.files) {
@@ -327,6 +397,102 @@ func (m Model) updateHome(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updatePathInput edits the path to add; enter adds a file, or every image a
+// scan of a directory finds
+func (m Model) updatePathInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		path := strings.TrimSpace(m.homeModel.inputPath)
+		if path == "" {
+			m.homeModel.adding = false
+			return m, nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			m.homeModel.err = err
+			return m, nil
+		}
+
+		before := len(m.homeModel.files)
+		if info.IsDir() {
+			files, err := m.api.ScanInputs(path, m.homeModel.scan, m.optionsModel.options)
+			if err != nil {
+				m.homeModel.err = err
+				return m, nil
+			}
+			m.AddFiles(files)
+			m.homeModel.status = fmt.Sprintf("Found %d images in %s, added %d",
+				len(files), path, len(m.homeModel.files)-before)
+		} else {
+			m.AddFiles([]string{path})
+			if len(m.homeModel.files) == before {
+				m.homeModel.err = fmt.Errorf("%s is not a supported image or is already added", path)
+				return m, nil
+			}
+			m.homeModel.status = "Added " + path
+		}
+		m.homeModel.adding = false
+		m.homeModel.err = nil
+
+	case tea.KeyEsc:
+		m.homeModel.adding = false
+		m.homeModel.err = nil
+
+	case tea.KeyBackspace:
+		if input := []rune(m.homeModel.inputPath); len(input) > 0 {
+			m.homeModel.inputPath = string(input[:len(input)-1])
+		}
+
+	case tea.KeySpace:
+		m.homeModel.inputPath += " "
+
+	case tea.KeyRunes:
+		m.homeModel.inputPath += string(msg.Runes)
+	}
+
+	return m, nil
+}
+
+// describeScan summarizes the filters directory scans apply
+func describeScan(scan api.ScanOptions) string {
+	parts := []string{
+		"hidden " + onOff(scan.Hidden) + " [.]",
+		"symlinks " + onOff(scan.FollowSymlinks) + " [s]",
+		"ignore files " + onOff(scan.IgnoreFiles) + " [i]",
+	}
+	if !scan.Recursive {
+		parts = append(parts, "top level only")
+	} else if scan.MaxDepth > 0 {
+		parts = append(parts, fmt.Sprintf("depth %d", scan.MaxDepth))
+	}
+	if len(scan.Include) > 0 {
+		parts = append(parts, "include "+strings.Join(scan.Include, ","))
+	}
+	if len(scan.Exclude) > 0 {
+		parts = append(parts, "exclude "+strings.Join(scan.Exclude, ","))
+	}
+	if scan.MinSize > 0 {
+		parts = append(parts, "≥ "+compressor.FormatBytes(scan.MinSize))
+	}
+	if scan.MaxSize > 0 {
+		parts = append(parts, "≤ "+compressor.FormatBytes(scan.MaxSize))
+	}
+	if scan.MinWidth > 0 || scan.MinHeight > 0 {
+		parts = append(parts, fmt.Sprintf("≥ %dx%d", scan.MinWidth, scan.MinHeight))
+	}
+	if !scan.ModifiedSince.IsZero() {
+		parts = append(parts, "since "+scan.ModifiedSince.Format("2006-01-02 15:04"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
 func (m Model) viewHome() string {
 	var b strings.Builder
 
@@ -341,15 +507,25 @@ func (m Model) viewHome() string {
 	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, singleTab, "  ", batchTab))
 	b.WriteString("\n\n")
 
-	b.WriteString(m.styles.Subtitle.Render("Add images to compress (JPEG/PNG only):"))
+	b.WriteString(m.styles.Subtitle.Render("Add images to compress (JPEG/PNG/TIFF/BMP/QOI/SVG):"))
 	b.WriteString("\n\n")
 
 	// Instructions
-	b.WriteString(m.styles.TextMuted.Render("  Drag and drop files or use 'a' to add files"))
+	b.WriteString(m.styles.TextMuted.Render("  Drag and drop files or use 'a' to add files or directories"))
 	b.WriteString("\n")
 	b.WriteString(m.styles.TextMuted.Render("  Pass file paths as command line arguments"))
+	b.WriteString("\n")
+	b.WriteString(m.styles.TextMuted.Render("  Directory scan: " + describeScan(m.homeModel.scan)))
 	b.WriteString("\n\n")
 
+	if m.homeModel.adding {
+		b.WriteString(m.styles.TextBold.Render(fmt.Sprintf("  File or directory: %s▏", m.homeModel.inputPath)))
+		b.WriteString("\n\n")
+	} else if m.homeModel.status != "" {
+		b.WriteString(m.styles.TextMuted.Render("  " + m.homeModel.status))
+		b.WriteString("\n\n")
+	}
+
 	// File list
 	if len(m.homeModel.files) == 0 {
 		b.WriteString(m.styles.Box.Render(
@@ -368,17 +544,35 @@ func (m Model) viewHome() string {
 				style = m.styles.ListItemSelected
 			}
 
-			info, _ := m.api.GetImageInfo(file)
+			info := m.imageInfo(file)
 			sizeStr := ""
 			if info != nil {
 				sizeStr = fmt.Sprintf(" (%s, %dx%d)",
 					compressor.FormatBytes(info.Size),
 					info.Width, info.Height)
+				if info.Frames > 1 {
+					unit := "pages"
+					if info.Format == compressor.FormatPNG {
+						unit = "frames"
+					}
+					sizeStr = fmt.Sprintf(" (%s, %dx%d, %d %s)",
+						compressor.FormatBytes(info.Size),
+						info.Width, info.Height, info.Frames, unit)
+				}
 			}
 
 			b.WriteString(style.Render(prefix + file + m.styles.TextMuted.Render(sizeStr)))
 			b.WriteString("\n")
 		}
+
+		// Details of the selected file
+		if m.homeModel.cursor < len(m.homeModel.files) {
+			if info := m.imageInfo(m.homeModel.files[m.homeModel.cursor]); info != nil {
+				b.WriteString("\n")
+				b.WriteString(m.styles.Box.Render(strings.Join(describeInfo(info), "\n")))
+				b.WriteString("\n")
+			}
+		}
 	}
 
 	if m.homeModel.err != nil {
@@ -389,6 +583,73 @@ func (m Model) viewHome() string {
 	return m.styles.Content.Render(b.String())
 }
 
+// imageInfo returns the cached info of a file, reading it on first use
+func (m Model) imageInfo(file string) *compressor.ImageInfo {
+	if info, ok := m.homeModel.infos[file]; ok {
+		return info
+	}
+	info, _ := m.api.GetImageInfo(file)
+	if m.homeModel.infos != nil {
+		m.homeModel.infos[file] = info
+	}
+	return info
+}
+
+// describeInfo returns the detail lines shown for the selected file
+func describeInfo(info *compressor.ImageInfo) []string {
+	color := info.ColorMode
+	if info.BitDepth > 0 {
+		color += fmt.Sprintf(", %d-bit", info.BitDepth)
+	}
+	if info.ChromaSubsampling != "" {
+		color += ", " + info.ChromaSubsampling
+	}
+	if info.Quality > 0 {
+		color += fmt.Sprintf(", quality ~%d", info.Quality)
+	}
+	if info.Progressive {
+		color += ", progressive"
+	}
+	switch {
+	case info.AlphaUsed:
+		color += ", alpha"
+	case info.HasAlpha && info.AlphaChecked:
+		color += ", alpha (unused)"
+	case info.HasAlpha:
+		color += ", alpha"
+	}
+	lines := []string{"Color: " + color}
+
+	if info.DPIX > 0 {
+		lines = append(lines, fmt.Sprintf("DPI: %.0fx%.0f", info.DPIX, info.DPIY))
+	}
+	if info.ICCProfile != "" {
+		lines = append(lines, "ICC: "+info.ICCProfile)
+	}
+	if exif := info.EXIF; exif != nil {
+		var parts []string
+		if camera := exif.Camera(); camera != "" {
+			parts = append(parts, camera)
+		}
+		if exif.DateTime != "" {
+			parts = append(parts, exif.DateTime)
+		}
+		if exif.Orientation > 1 {
+			parts = append(parts, fmt.Sprintf("orientation %d", exif.Orientation))
+		}
+		if exif.HasGPS {
+			parts = append(parts, "GPS")
+		}
+		if len(parts) > 0 {
+			lines = append(lines, "EXIF: "+strings.Join(parts, ", "))
+		}
+	}
+	if len(info.Chunks) > 0 {
+		lines = append(lines, "Chunks: "+strings.Join(info.Chunks, " "))
+	}
+	return lines
+}
+
 // Options view methods
 func (m Model) updateOptions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
@@ -436,6 +697,61 @@ func (m Model) updateOptions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case "m":
 		m.optionsModel.options.StripMetadata = !m.optionsModel.options.StripMetadata
+
+	case "t":
+		m.optionsModel.options.PreserveAttributes = !m.optionsModel.options.PreserveAttributes
+
+	case "f":
+		m.optionsModel.options.OutputFormat = nextOutputFormat(m.optionsModel.options.OutputFormat)
+
+	case "a":
+		m.optionsModel.options.AllPages = !m.optionsModel.options.AllPages
+
+	case "s":
+		m.optionsModel.options.SourceQuality = nextSourceQuality(m.optionsModel.options.SourceQuality)
+
+	case "e":
+		m.optionsModel.options.IfExists = nextExistingPolicy(m.optionsModel.options.IfExists)
+
+	case "n":
+		m.optionsModel.editingTemplate = true
+		m.optionsModel.templateInput = m.optionsModel.options.OutputTemplate
+		m.optionsModel.templateErr = ""
+	}
+
+	return m, nil
+}
+
+// updateTemplateInput edits the output template; enter applies it once it
+// validates, an empty template restores suffix naming
+func (m Model) updateTemplateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		if m.optionsModel.templateInput != "" {
+			if err := compressor.ValidateTemplate(m.optionsModel.templateInput); err != nil {
+				m.optionsModel.templateErr = err.Error()
+				return m, nil
+			}
+		}
+		m.optionsModel.options.OutputTemplate = m.optionsModel.templateInput
+		m.optionsModel.editingTemplate = false
+		m.optionsModel.templateErr = ""
+		m.optionsModel.startErr = ""
+
+	case tea.KeyEsc:
+		m.optionsModel.editingTemplate = false
+		m.optionsModel.templateErr = ""
+
+	case tea.KeyBackspace:
+		if input := []rune(m.optionsModel.templateInput); len(input) > 0 {
+			m.optionsModel.templateInput = string(input[:len(input)-1])
+		}
+
+	case tea.KeySpace:
+		m.optionsModel.templateInput += " "
+
+	case tea.KeyRunes:
+		m.optionsModel.templateInput += string(msg.Runes)
 	}
 
 	return m, nil
@@ -456,6 +772,16 @@ func (m Model) viewOptions() string {
 			fmt.Sprintf("%d%%", opts.Quality),
 			RenderProgressBar(float64(opts.Quality), 20),
 			"+/- to adjust"))
+
+		sourceQuality := "ignore"
+		switch opts.SourceQuality {
+		case compressor.SourceQualityCap:
+			sourceQuality = "cap at source"
+		case compressor.SourceQualitySkip:
+			sourceQuality = "skip if lower"
+		}
+		b.WriteString(m.styles.TextMuted.Render(fmt.Sprintf("  Source Quality: %s  [s]", sourceQuality)))
+		b.WriteString("\n")
 	}
 
 	// Compression level (PNG)
@@ -473,9 +799,13 @@ func (m Model) viewOptions() string {
 	// Toggle options
 	b.WriteString(m.renderToggle("Progressive", opts.Progressive, "p"))
 	b.WriteString(m.renderToggle("Strip Metadata", opts.StripMetadata, "m"))
+	b.WriteString(m.renderToggle("Preserve Attributes", opts.PreserveAttributes, "t"))
 	if format == compressor.FormatPNG {
 		b.WriteString(m.renderToggle("Interlaced", opts.Interlaced, "i"))
 	}
+	if format == compressor.FormatTIFF {
+		b.WriteString(m.renderToggle("All Pages", opts.AllPages, "a"))
+	}
 
 	b.WriteString("\n")
 	b.WriteString(m.styles.TextBold.Render("Output Settings:"))
@@ -483,12 +813,45 @@ func (m Model) viewOptions() string {
 	b.WriteString(m.styles.TextMuted.Render(fmt.Sprintf("  Suffix: %s", opts.OutputSuffix)))
 	b.WriteString("\n")
 
+	switch {
+	case m.optionsModel.editingTemplate:
+		b.WriteString(m.styles.TextBold.Render(fmt.Sprintf("  Name Template: %s▏", m.optionsModel.templateInput)))
+		b.WriteString("\n")
+		b.WriteString(m.styles.TextMuted.Render("  {dir} {name} {ext} {fmt} {suffix} {w} {h} {q} {hash:N} {date} {rel}"))
+		b.WriteString("\n")
+		if m.optionsModel.templateErr != "" {
+			b.WriteString(m.styles.TextError.Render("  " + m.optionsModel.templateErr))
+			b.WriteString("\n")
+		}
+	case opts.OutputTemplate != "":
+		b.WriteString(m.styles.TextMuted.Render(fmt.Sprintf("  Name Template: %s  [n]", opts.OutputTemplate)))
+		b.WriteString("\n")
+	default:
+		b.WriteString(m.styles.TextMuted.Render("  Name Template: (suffix)  [n]"))
+		b.WriteString("\n")
+	}
+
+	outputFormat := string(opts.OutputFormat)
+	if outputFormat == "" {
+		outputFormat = "(same as input)"
+	}
+	b.WriteString(m.styles.TextMuted.Render(fmt.Sprintf("  Format: %s  [f]", outputFormat)))
+	b.WriteString("\n")
+
+	b.WriteString(m.styles.TextMuted.Render(fmt.Sprintf("  If Exists: %s  [e]", opts.IfExists)))
+	b.WriteString("\n")
+
 	outputDir := opts.OutputDir
 	if outputDir == "" {
 		outputDir = "(same as input)"
 	}
 	b.WriteString(m.styles.TextMuted.Render(fmt.Sprintf("  Output Dir: %s", outputDir)))
 
+	if m.optionsModel.startErr != "" {
+		b.WriteString("\n\n")
+		b.WriteString(m.styles.TextError.Render("✗ " + m.optionsModel.startErr))
+	}
+
 	return m.styles.Content.Render(b.String())
 }
 
@@ -603,10 +966,66 @@ func (m Model) updateResult(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.resultModel.cursor < len(m.resultModel.results)-1 {
 			m.resultModel.cursor++
 		}
+	case "u":
+		var reverted bool
+		m.resultModel.status, reverted = m.revert()
+		if reverted {
+			m.discardJournal()
+		}
 	}
 	return m, nil
 }
 
+// revert undoes the session's journal, describes the outcome and reports
+// whether every entry was undone
+func (m Model) revert() (string, bool) {
+	if m.resultModel.journal == "" {
+		return "Nothing to revert", false
+	}
+
+	results, err := m.api.Undo(m.resultModel.journal)
+	if err != nil {
+		return "Revert failed: " + err.Error(), false
+	}
+
+	var reverted, failed int
+	for _, result := range results {
+		switch {
+		case result.Error != nil:
+			failed++
+		case result.Action != "unchanged":
+			reverted++
+		}
+	}
+	if failed > 0 {
+		return fmt.Sprintf("Reverted %d files, %d could not be reverted", reverted, failed), false
+	}
+	return fmt.Sprintf("Reverted %d files", reverted), true
+}
+
+// discardJournal deletes the session's temporary journal and the backups
+// kept next to it once the session can no longer be reverted
+func (m *Model) discardJournal() {
+	if m.journal != nil {
+		m.journal.Close()
+		os.Remove(m.journal.Path())
+		os.RemoveAll(m.journal.BackupDir())
+	}
+	m.journal = nil
+	m.resultModel.journal = ""
+}
+
+// openSessionJournal starts a journal for one compression run in the
+// temporary directory, or returns nil when it cannot be created
+func openSessionJournal() *compressor.Journal {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("imgshrink-%d.jsonl", time.Now().UnixNano()))
+	journal, err := compressor.OpenJournal(path)
+	if err != nil {
+		return nil
+	}
+	return journal
+}
+
 func (m Model) viewResult() string {
 	var b strings.Builder
 
@@ -644,6 +1063,11 @@ func (m Model) viewResult() string {
 	b.WriteString(m.styles.Box.Render(summary))
 	b.WriteString("\n\n")
 
+	if m.resultModel.status != "" {
+		b.WriteString(m.styles.TextBold.Render(m.resultModel.status))
+		b.WriteString("\n\n")
+	}
+
 	// Results list
 	b.WriteString(m.styles.TextBold.Render("Details:"))
 	b.WriteString("\n")
@@ -654,13 +1078,21 @@ func (m Model) viewResult() string {
 			prefix = "▸ "
 		}
 
-		if result.Success {
+		if result.Skipped {
+			b.WriteString(m.styles.TextMuted.Render(prefix + "- " + result.InputPath + " skipped: " + result.SkipReason))
+		} else if result.Success {
 			b.WriteString(m.styles.TextSuccess.Render(prefix + "✓ "))
 			b.WriteString(m.styles.Text.Render(result.InputPath))
 			b.WriteString(m.styles.TextMuted.Render(fmt.Sprintf(" (%s → %s) ",
 				compressor.FormatBytes(result.InputSize),
 				compressor.FormatBytes(result.OutputSize))))
 			b.WriteString(RenderReduction(result.Reduction, m.styles))
+			if len(result.Candidates) > 0 {
+				b.WriteString(m.styles.TextMuted.Render(" " + describeCandidates(result.Candidates)))
+			}
+			if result.Existing != "" {
+				b.WriteString(m.styles.TextMuted.Render(" existing output: " + result.Existing))
+			}
 		} else {
 			b.WriteString(m.styles.TextError.Render(prefix + "✗ "))
 			b.WriteString(m.styles.Text.Render(result.InputPath))
@@ -674,6 +1106,60 @@ func (m Model) viewResult() string {
 	return m.styles.Content.Render(b.String())
 }
 
+// nextOutputFormat cycles through the selectable output formats
+func nextOutputFormat(current compressor.ImageFormat) compressor.ImageFormat {
+	formats := []compressor.ImageFormat{"", compressor.FormatJPEG, compressor.FormatPNG, compressor.FormatQOI, compressor.FormatAuto}
+	for i, f := range formats {
+		if f == current {
+			return formats[(i+1)%len(formats)]
+		}
+	}
+	return formats[0]
+}
+
+// nextSourceQuality cycles through the source quality policies
+func nextSourceQuality(current compressor.SourceQualityPolicy) compressor.SourceQualityPolicy {
+	switch current {
+	case compressor.SourceQualityIgnore:
+		return compressor.SourceQualityCap
+	case compressor.SourceQualityCap:
+		return compressor.SourceQualitySkip
+	default:
+		return compressor.SourceQualityIgnore
+	}
+}
+
+// nextExistingPolicy cycles through the policies for existing outputs
+func nextExistingPolicy(current compressor.ExistingPolicy) compressor.ExistingPolicy {
+	policies := []compressor.ExistingPolicy{
+		compressor.ExistingOverwrite,
+		compressor.ExistingSkip,
+		compressor.ExistingSkipNewer,
+		compressor.ExistingRename,
+		compressor.ExistingFail,
+	}
+	for i, p := range policies {
+		if p == current {
+			return policies[(i+1)%len(policies)]
+		}
+	}
+	return policies[0]
+}
+
+// describeCandidates summarizes an automatic format decision, e.g. "[png-palette 4.1 KB ✓, png 12.0 KB]"
+func describeCandidates(candidates []compressor.FormatCandidate) string {
+	var parts []string
+	for _, c := range candidates {
+		switch {
+		case c.Selected:
+			parts = append(parts, fmt.Sprintf("%s %s ✓", c.Name(), compressor.FormatBytes(c.Size)))
+		case c.Eligible:
+			parts = append(parts, fmt.Sprintf("%s %s", c.Name(), compressor.FormatBytes(c.Size)))
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
 // Compression commands
 type compressionResultMsg struct {
 	result *compressor.CompressionResult
@@ -725,9 +1211,14 @@ func (m *Model) AddFiles(files []string) {
 	}
 }
 
-// Run starts the TUI application
-func Run(files []string) error {
+// Run starts the TUI application with files preselected, options as the
+// starting point of the options view and scan as the filters for added
+// directories
+func Run(files []string, options compressor.CompressionOptions, scan api.ScanOptions) error {
 	m := NewModel()
+	m.options = options
+	m.optionsModel.options = options
+	m.homeModel.scan = scan
 	m.AddFiles(files)
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
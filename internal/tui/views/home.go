@@ -32,7 +32,7 @@ type HomeView struct {
 // NewHomeView creates a new home view
 func NewHomeView(imageAPI *api.ImageAPI, styles *tui.Styles) HomeView {
 	fp := filepicker.New()
-	fp.AllowedTypes = []string{".jpg", ".jpeg", ".png"}
+	fp.AllowedTypes = []string{".jpg", ".jpeg", ".png", ".tif", ".tiff", ".bmp", ".qoi", ".svg"}
 	fp.CurrentDirectory, _ = os.Getwd()
 
 	return HomeView{
@@ -70,7 +70,7 @@ func (v HomeView) Update(msg tea.Msg) (HomeView, tea.Cmd) {
 		case "enter":
 			if v.mode == "batch" && v.directory != "" {
 				// Scan directory for images
-				files, err := v.api.ScanDirectory(v.directory, true)
+				files, err := v.api.ScanDirectory(v.directory, api.DefaultScanOptions())
 				if err != nil {
 					v.err = err
 				} else {
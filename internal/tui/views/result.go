@@ -183,6 +183,7 @@ func (v ResultView) View() string {
 		detailsBox := v.styles.FileInfo.Render(
 			tui.RenderKeyValue("Input", result.InputPath, v.styles) + "\n" +
 				tui.RenderKeyValue("Output", result.OutputPath, v.styles) + "\n" +
+				tui.RenderKeyValue("Format", string(result.Format), v.styles) + "\n" +
 				tui.RenderKeyValue("Dimensions", fmt.Sprintf("%dx%d", result.Width, result.Height), v.styles),
 		)
 		b.WriteString(detailsBox)